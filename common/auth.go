@@ -0,0 +1,458 @@
+package common
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// AuthMode selects how the server authenticates to Kusto.
+type AuthMode string
+
+const (
+	AuthDefault           AuthMode = "default"
+	AuthClientSecret      AuthMode = "client-secret"
+	AuthClientCertificate AuthMode = "client-certificate"
+	AuthManagedIdentity   AuthMode = "managed-identity"
+	AuthAzureCLI          AuthMode = "azcli"
+	AuthWorkloadIdentity  AuthMode = "workload-identity"
+	AuthDeviceCode        AuthMode = "device-code"
+	AuthToken             AuthMode = "token"
+	AuthNone              AuthMode = "none"
+)
+
+// AuthModes lists the supported authentication modes.
+var AuthModes = []AuthMode{
+	AuthDefault,
+	AuthClientSecret,
+	AuthClientCertificate,
+	AuthManagedIdentity,
+	AuthAzureCLI,
+	AuthWorkloadIdentity,
+	AuthDeviceCode,
+	AuthToken,
+	AuthNone,
+}
+
+// defaultTokenEnv holds the bearer token for AuthToken unless a token file or another variable is configured.
+const defaultTokenEnv = "KUSTO_ACCESS_TOKEN"
+
+// defaultProbeScope is used to check credentials at startup when no cluster is configured.
+const defaultProbeScope = "https://kusto.kusto.windows.net/.default"
+
+// AuthConfig holds the settings for an authentication mode.
+// Only the fields relevant to Mode are used.
+type AuthConfig struct {
+	Mode AuthMode `yaml:"mode,omitempty"`
+
+	TenantID string `yaml:"tenantId,omitempty"`
+	// ClientID of the service principal, workload identity or user-assigned managed identity.
+	ClientID     string `yaml:"clientId,omitempty"`
+	ClientSecret string `yaml:"clientSecret,omitempty"`
+
+	CertificatePath     string `yaml:"certificatePath,omitempty"`
+	CertificatePassword string `yaml:"certificatePassword,omitempty"`
+
+	// FederatedTokenFile is the service account token file used for workload identity.
+	FederatedTokenFile string `yaml:"federatedTokenFile,omitempty"`
+
+	// TokenFile or TokenEnv point to a pre-acquired bearer token. The file is re-read
+	// on every request so that it can be refreshed externally. TokenEnv defaults to KUSTO_ACCESS_TOKEN.
+	TokenFile string `yaml:"tokenFile,omitempty"`
+	TokenEnv  string `yaml:"tokenEnv,omitempty"`
+
+	// Caller is the ID of the caller the credential acts on behalf of. It is set per tool call
+	// when on-behalf-of is enabled, and never read from the configuration.
+	Caller string `yaml:"-"`
+	// obo is the on-behalf-of credential of the caller, so that a client can be created for the caller
+	// after the pool evicted the credential along with the caller's last client.
+	obo *oboCredential
+}
+
+// ApplyEnv overrides the settings with the ones defined by environment variables.
+func (a *AuthConfig) ApplyEnv() {
+	setFromEnv((*string)(&a.Mode), "KUSTO_AUTH_MODE")
+	setFromEnv(&a.TenantID, "AZURE_TENANT_ID")
+	setFromEnv(&a.ClientID, "AZURE_CLIENT_ID")
+	setFromEnv(&a.ClientSecret, "AZURE_CLIENT_SECRET")
+	setFromEnv(&a.CertificatePath, "AZURE_CLIENT_CERTIFICATE_PATH")
+	setFromEnv(&a.CertificatePassword, "AZURE_CLIENT_CERTIFICATE_PASSWORD")
+	setFromEnv(&a.FederatedTokenFile, "AZURE_FEDERATED_TOKEN_FILE")
+	setFromEnv(&a.TokenFile, "KUSTO_TOKEN_FILE")
+	setFromEnv(&a.TokenEnv, "KUSTO_TOKEN_ENV")
+}
+
+func setFromEnv(target *string, name string) {
+	if value := os.Getenv(name); value != "" {
+		*target = value
+	}
+}
+
+// Validate checks that the settings required by the mode are present.
+func (a AuthConfig) Validate() error {
+	switch a.mode() {
+	case AuthDefault, AuthAzureCLI, AuthDeviceCode, AuthManagedIdentity, AuthWorkloadIdentity, AuthToken, AuthNone:
+	case AuthClientSecret:
+		if a.TenantID == "" || a.ClientID == "" || a.ClientSecret == "" {
+			return fmt.Errorf("auth mode %s requires a tenant ID, client ID and client secret", AuthClientSecret)
+		}
+	case AuthClientCertificate:
+		if a.TenantID == "" || a.ClientID == "" || a.CertificatePath == "" {
+			return fmt.Errorf("auth mode %s requires a tenant ID, client ID and certificate path", AuthClientCertificate)
+		}
+	default:
+		return fmt.Errorf("unknown auth mode %q, expected one of %s", a.Mode, joinModes())
+	}
+	return nil
+}
+
+// Key identifies the credential settings. Secrets are not part of the key.
+func (a AuthConfig) Key() string {
+	return strings.Join([]string{
+		string(a.mode()), a.TenantID, a.ClientID, a.CertificatePath, a.FederatedTokenFile, a.TokenFile, a.TokenEnv, a.Caller,
+	}, "|")
+}
+
+func (a AuthConfig) mode() AuthMode {
+	if a.Mode == "" {
+		return AuthDefault
+	}
+	return a.Mode
+}
+
+// confidential reports whether the mode authenticates an app registration that can exchange tokens on behalf of a caller.
+func (a AuthConfig) confidential() bool {
+	return a.mode() == AuthClientSecret || a.mode() == AuthClientCertificate
+}
+
+// Describe returns a short, secret free description of the mode for diagnostics.
+func (a AuthConfig) Describe() string {
+	mode := a.mode()
+	switch {
+	case a.Caller != "":
+		return fmt.Sprintf("%s on behalf of %s (tenant %s, client ID %s)", mode, a.Caller, a.TenantID, a.ClientID)
+	case mode == AuthManagedIdentity && a.ClientID == "":
+		return "managed-identity (system-assigned)"
+	case mode == AuthManagedIdentity:
+		return fmt.Sprintf("managed-identity (user-assigned, client ID %s)", a.ClientID)
+	case mode == AuthClientSecret || mode == AuthClientCertificate || mode == AuthWorkloadIdentity:
+		return fmt.Sprintf("%s (tenant %s, client ID %s)", mode, a.TenantID, a.ClientID)
+	case mode == AuthToken && a.TokenFile != "":
+		return fmt.Sprintf("token (file %s)", a.TokenFile)
+	case mode == AuthToken:
+		return fmt.Sprintf("token (environment variable %s)", a.tokenEnv())
+	}
+	return string(mode)
+}
+
+func (a AuthConfig) tokenEnv() string {
+	if a.TokenEnv == "" {
+		return defaultTokenEnv
+	}
+	return a.TokenEnv
+}
+
+func joinModes() string {
+	names := make([]string, 0, len(AuthModes))
+	for _, mode := range AuthModes {
+		names = append(names, string(mode))
+	}
+	return strings.Join(names, ", ")
+}
+
+var defaultAuth = AuthConfig{Mode: AuthDefault}
+
+// SetDefaultAuth sets the authentication settings used by GetClient.
+func SetDefaultAuth(auth AuthConfig) error {
+	if err := auth.Validate(); err != nil {
+		return err
+	}
+	defaultAuth = auth
+	return nil
+}
+
+// DefaultAuth returns the authentication settings used by GetClient.
+func DefaultAuth() AuthConfig {
+	return defaultAuth
+}
+
+var (
+	credentialsMu sync.Mutex
+	credentials   = map[string]azcore.TokenCredential{}
+)
+
+// credential returns the token credential for the settings. Credentials are shared
+// between clients so that e.g. a device code login only happens once.
+// It returns nil for AuthNone.
+func credential(auth AuthConfig) (azcore.TokenCredential, error) {
+	if auth.mode() == AuthNone {
+		return nil, nil
+	}
+
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+
+	key := auth.Key()
+	if cred, ok := credentials[key]; ok {
+		return cred, nil
+	}
+
+	if auth.obo != nil {
+		oboCredentials[key] = auth.obo
+		credentials[key] = &modeCredential{description: auth.Describe(), cred: auth.obo}
+		return credentials[key], nil
+	}
+
+	cred, err := newCredential(auth)
+	if err != nil {
+		return nil, fmt.Errorf("%s authentication could not be configured: %w", auth.Describe(), err)
+	}
+	cred = &modeCredential{description: auth.Describe(), cred: cred}
+	credentials[key] = cred
+
+	return cred, nil
+}
+
+func newCredential(auth AuthConfig) (azcore.TokenCredential, error) {
+	if auth.Caller != "" {
+		// on-behalf-of credentials are created by onBehalfOf, which has the token of the caller
+		return nil, fmt.Errorf("no token of caller %s", auth.Caller)
+	}
+
+	switch auth.mode() {
+	case AuthDefault:
+		return azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{TenantID: auth.TenantID})
+	case AuthClientSecret:
+		return azidentity.NewClientSecretCredential(auth.TenantID, auth.ClientID, auth.ClientSecret, nil)
+	case AuthClientCertificate:
+		certs, key, err := parseCertificate(auth)
+		if err != nil {
+			return nil, err
+		}
+		return azidentity.NewClientCertificateCredential(auth.TenantID, auth.ClientID, certs, key, nil)
+	case AuthManagedIdentity:
+		options := &azidentity.ManagedIdentityCredentialOptions{}
+		if auth.ClientID != "" {
+			options.ID = azidentity.ClientID(auth.ClientID)
+		}
+		return azidentity.NewManagedIdentityCredential(options)
+	case AuthAzureCLI:
+		return azidentity.NewAzureCLICredential(&azidentity.AzureCLICredentialOptions{TenantID: auth.TenantID})
+	case AuthWorkloadIdentity:
+		return azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+			TenantID:      auth.TenantID,
+			ClientID:      auth.ClientID,
+			TokenFilePath: auth.FederatedTokenFile,
+		})
+	case AuthDeviceCode:
+		return azidentity.NewDeviceCodeCredential(&azidentity.DeviceCodeCredentialOptions{
+			TenantID: auth.TenantID,
+			ClientID: auth.ClientID,
+			// stdout carries the MCP protocol, so the prompt must go to stderr
+			UserPrompt: func(ctx context.Context, message azidentity.DeviceCodeMessage) error {
+				fmt.Fprintln(os.Stderr, message.Message)
+				return nil
+			},
+		})
+	case AuthToken:
+		return &bearerTokenCredential{file: auth.TokenFile, env: auth.tokenEnv()}, nil
+	}
+	return nil, fmt.Errorf("unknown auth mode %q", auth.Mode)
+}
+
+func parseCertificate(auth AuthConfig) ([]*x509.Certificate, crypto.PrivateKey, error) {
+	data, err := os.ReadFile(auth.CertificatePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var password []byte
+	if auth.CertificatePassword != "" {
+		password = []byte(auth.CertificatePassword)
+	}
+	return azidentity.ParseCertificates(data, password)
+}
+
+// onBehalfOf returns the settings for acting on behalf of the caller with the app registration of auth,
+// and hands the latest token of the caller to the credential of those settings.
+func onBehalfOf(auth AuthConfig, caller Caller) (AuthConfig, error) {
+	if !auth.confidential() {
+		return auth, fmt.Errorf("on-behalf-of requires auth mode %s or %s, not %s", AuthClientSecret, AuthClientCertificate, auth.mode())
+	}
+	if caller.Token == "" {
+		return auth, fmt.Errorf("caller %s has no token to act on behalf of", caller.ID)
+	}
+	auth.Caller = caller.ID
+
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+
+	key := auth.Key()
+	cred, ok := oboCredentials[key]
+	if !ok {
+		cred = &oboCredential{auth: auth}
+		oboCredentials[key] = cred
+		credentials[key] = &modeCredential{description: auth.Describe(), cred: cred}
+	}
+
+	if err := cred.setAssertion(caller.Token); err != nil {
+		return auth, fmt.Errorf("%s authentication could not be configured: %w", auth.Describe(), err)
+	}
+	auth.obo = cred
+	return auth, nil
+}
+
+// oboCredentials holds the on-behalf-of credential of each caller, guarded by credentialsMu.
+// Credentials are evicted by forgetCaller once the pool closed the last client of the caller.
+var oboCredentials = map[string]*oboCredential{}
+
+// forgetCaller removes the credential of the caller the settings act on behalf of.
+func forgetCaller(auth AuthConfig) {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+
+	key := auth.Key()
+	delete(oboCredentials, key)
+	delete(credentials, key)
+}
+
+// oboCredential exchanges the latest token of a caller for tokens of Kusto. Pooled clients keep their credential,
+// so a caller's credential is updated whenever they present a new token rather than replaced.
+type oboCredential struct {
+	auth AuthConfig
+
+	mu        sync.Mutex
+	assertion string
+	cred      azcore.TokenCredential
+}
+
+func (o *oboCredential) setAssertion(assertion string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if assertion == o.assertion {
+		return nil
+	}
+
+	var cred azcore.TokenCredential
+	var err error
+	switch o.auth.mode() {
+	case AuthClientSecret:
+		cred, err = azidentity.NewOnBehalfOfCredentialWithSecret(o.auth.TenantID, o.auth.ClientID, assertion, o.auth.ClientSecret, nil)
+	case AuthClientCertificate:
+		certs, key, parseErr := parseCertificate(o.auth)
+		if parseErr != nil {
+			return parseErr
+		}
+		cred, err = azidentity.NewOnBehalfOfCredentialWithCertificate(o.auth.TenantID, o.auth.ClientID, assertion, certs, key, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	o.assertion = assertion
+	o.cred = cred
+	return nil
+}
+
+func (o *oboCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	o.mu.Lock()
+	cred := o.cred
+	o.mu.Unlock()
+
+	return cred.GetToken(ctx, options)
+}
+
+// connectionString builds the connection string for an endpoint with the given settings.
+func connectionString(endpoint string, auth AuthConfig) (*azkustodata.ConnectionStringBuilder, error) {
+	kcsb := azkustodata.NewConnectionStringBuilder(endpoint)
+
+	cred, err := credential(auth)
+	if err != nil {
+		return nil, err
+	}
+	if cred != nil {
+		kcsb = kcsb.WithTokenCredential(cred)
+	}
+	return kcsb, nil
+}
+
+// CheckAuth tries to acquire a token for the cluster with its settings and reports a failure along with the mode
+// that was tried. Without an endpoint, a token for the public cloud is requested. Interactive modes and AuthNone
+// are not checked.
+func CheckAuth(ctx context.Context, cluster Cluster) error {
+	auth := cluster.Auth
+	mode := auth.mode()
+	if mode == AuthNone || mode == AuthDeviceCode {
+		return nil
+	}
+
+	cred, err := credential(auth)
+	if err != nil {
+		return err
+	}
+
+	_, err = cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{probeScope(cluster.Endpoint)}})
+	return err
+}
+
+// probeScope returns the scope of tokens for the cluster, so that sovereign clouds and other hosts are checked
+// against their own resource, e.g. https://help.kusto.windows.net/.default.
+func probeScope(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return defaultProbeScope
+	}
+	return u.Scheme + "://" + u.Host + "/.default"
+}
+
+// modeCredential adds the authentication mode to token errors, so failures say which mode was tried.
+type modeCredential struct {
+	description string
+	cred        azcore.TokenCredential
+}
+
+func (m *modeCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	token, err := m.cred.GetToken(ctx, options)
+	if err != nil {
+		return token, fmt.Errorf("%s authentication failed: %w", m.description, err)
+	}
+	return token, nil
+}
+
+// bearerTokenCredential serves a pre-acquired token from a file or an environment variable.
+type bearerTokenCredential struct {
+	file string
+	env  string
+}
+
+func (b *bearerTokenCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	var token string
+	if b.file != "" {
+		data, err := os.ReadFile(b.file)
+		if err != nil {
+			return azcore.AccessToken{}, fmt.Errorf("error reading token file: %w", err)
+		}
+		token = string(data)
+	} else {
+		token = os.Getenv(b.env)
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return azcore.AccessToken{}, fmt.Errorf("no bearer token found")
+	}
+
+	// the expiry is unknown, so report a short lifetime to make callers come back for a fresh token
+	return azcore.AccessToken{Token: token, ExpiresOn: time.Now().Add(5 * time.Minute)}, nil
+}
@@ -0,0 +1,164 @@
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+func TestAuthConfigValidate(t *testing.T) {
+	valid := []AuthConfig{
+		{},
+		{Mode: AuthAzureCLI},
+		{Mode: AuthManagedIdentity},
+		{Mode: AuthManagedIdentity, ClientID: "client"},
+		{Mode: AuthClientSecret, TenantID: "tenant", ClientID: "client", ClientSecret: "secret"},
+		{Mode: AuthClientCertificate, TenantID: "tenant", ClientID: "client", CertificatePath: "cert.pem"},
+		{Mode: AuthToken, TokenFile: "token.txt"},
+		{Mode: AuthToken},
+		{Mode: AuthNone},
+	}
+	for _, auth := range valid {
+		if err := auth.Validate(); err != nil {
+			t.Fatalf("Expected %+v to be valid, got %v", auth.Describe(), err)
+		}
+	}
+
+	invalid := []AuthConfig{
+		{Mode: "kerberos"},
+		{Mode: AuthClientSecret, TenantID: "tenant", ClientID: "client"},
+		{Mode: AuthClientCertificate, TenantID: "tenant"},
+	}
+	for _, auth := range invalid {
+		if err := auth.Validate(); err == nil {
+			t.Fatalf("Expected mode %s to be invalid", auth.Mode)
+		}
+	}
+}
+
+func TestAuthConfigKeyExcludesSecrets(t *testing.T) {
+	auth := AuthConfig{Mode: AuthClientSecret, TenantID: "tenant", ClientID: "client", ClientSecret: "top-secret"}
+
+	if strings.Contains(auth.Key(), "top-secret") || strings.Contains(auth.Describe(), "top-secret") {
+		t.Fatal("Secrets must not be part of the key or description")
+	}
+	if auth.Key() == (AuthConfig{Mode: AuthClientSecret, TenantID: "tenant", ClientID: "other"}).Key() {
+		t.Fatal("Expected different client IDs to produce different keys")
+	}
+}
+
+func TestBearerTokenCredential(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := (&bearerTokenCredential{file: file}).GetToken(context.Background(), policy.TokenRequestOptions{})
+	if err != nil || token.Token != "file-token" {
+		t.Fatalf("Unexpected token from file: %q, %v", token.Token, err)
+	}
+
+	t.Setenv("TEST_KUSTO_TOKEN", "env-token")
+	token, err = (&bearerTokenCredential{env: "TEST_KUSTO_TOKEN"}).GetToken(context.Background(), policy.TokenRequestOptions{})
+	if err != nil || token.Token != "env-token" {
+		t.Fatalf("Unexpected token from env: %q, %v", token.Token, err)
+	}
+
+	if _, err := (&bearerTokenCredential{env: "TEST_KUSTO_TOKEN_MISSING"}).GetToken(context.Background(), policy.TokenRequestOptions{}); err == nil {
+		t.Fatal("Expected an error for a missing token")
+	}
+}
+
+func TestCredentialErrorsNameTheMode(t *testing.T) {
+	cred, err := credential(AuthConfig{Mode: AuthToken, TokenEnv: "TEST_KUSTO_TOKEN_MISSING"})
+	if err != nil {
+		t.Fatalf("credential failed: %v", err)
+	}
+
+	_, err = cred.GetToken(context.Background(), policy.TokenRequestOptions{})
+	if err == nil || !strings.Contains(err.Error(), "token (environment variable TEST_KUSTO_TOKEN_MISSING)") {
+		t.Fatalf("Expected the error to name the auth mode, got %v", err)
+	}
+
+	if cred, err := credential(AuthConfig{Mode: AuthNone}); cred != nil || err != nil {
+		t.Fatalf("Expected no credential for mode none, got %v, %v", cred, err)
+	}
+}
+
+// scopeCredential records the scopes it is asked for.
+type scopeCredential struct {
+	scopes []string
+}
+
+func (s *scopeCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	s.scopes = append(s.scopes, options.Scopes...)
+	return azcore.AccessToken{Token: "token"}, nil
+}
+
+func TestCheckAuthProbesTheCluster(t *testing.T) {
+	auth := AuthConfig{Mode: AuthClientSecret, TenantID: "tenant", ClientID: "probe", ClientSecret: "secret"}
+	cred := &scopeCredential{}
+	credentialsMu.Lock()
+	credentials[auth.Key()] = cred
+	credentialsMu.Unlock()
+	t.Cleanup(func() {
+		credentialsMu.Lock()
+		delete(credentials, auth.Key())
+		credentialsMu.Unlock()
+	})
+
+	for _, endpoint := range []string{"https://help.kusto.windows.net", "https://sovereign.kusto.usgovcloudapi.net/", ""} {
+		if err := CheckAuth(context.Background(), Cluster{Endpoint: endpoint, Auth: auth}); err != nil {
+			t.Fatalf("CheckAuth failed: %v", err)
+		}
+	}
+	expected := []string{"https://help.kusto.windows.net/.default", "https://sovereign.kusto.usgovcloudapi.net/.default", defaultProbeScope}
+	if strings.Join(cred.scopes, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Expected scopes %v, got %v", expected, cred.scopes)
+	}
+
+	if err := CheckAuth(context.Background(), Cluster{Endpoint: "http://localhost:8080", Auth: AuthConfig{Mode: AuthNone}}); err != nil {
+		t.Fatalf("Expected mode none not to be checked, got %v", err)
+	}
+}
+
+func TestOnBehalfOf(t *testing.T) {
+	app := AuthConfig{Mode: AuthClientSecret, TenantID: "tenant", ClientID: "client", ClientSecret: "secret"}
+
+	alice, err := onBehalfOf(app, Caller{ID: "alice", Token: "token-1"})
+	if err != nil {
+		t.Fatalf("onBehalfOf failed: %v", err)
+	}
+	bob, _ := onBehalfOf(app, Caller{ID: "bob", Token: "token-2"})
+	if alice.Key() == bob.Key() || alice.Key() == app.Key() {
+		t.Fatal("Expected every caller to get their own clients")
+	}
+	if strings.Contains(alice.Key(), "token-1") {
+		t.Fatal("Tokens must not be part of the key")
+	}
+
+	cred, err := credential(alice)
+	if err != nil {
+		t.Fatalf("credential failed: %v", err)
+	}
+
+	// a new token of the caller updates the credential the pooled clients already use
+	if _, err := onBehalfOf(app, Caller{ID: "alice", Token: "token-3"}); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := credential(alice); again != cred || oboCredentials[alice.Key()].assertion != "token-3" {
+		t.Fatal("Expected the credential of the caller to be updated in place")
+	}
+
+	if _, err := onBehalfOf(AuthConfig{Mode: AuthManagedIdentity}, Caller{ID: "alice", Token: "token-1"}); err == nil {
+		t.Fatal("Expected on-behalf-of to require a confidential client")
+	}
+	if _, err := onBehalfOf(app, Caller{ID: "ci"}); err == nil {
+		t.Fatal("Expected on-behalf-of to require the token of the caller")
+	}
+}
@@ -1,15 +1,80 @@
 package common
 
 import (
+	"context"
+	"errors"
+	"net/http"
+
 	"github.com/Azure/azure-kusto-go/azkustodata"
+	"github.com/Azure/azure-kusto-go/azkustodata/query"
+	v1 "github.com/Azure/azure-kusto-go/azkustodata/query/v1"
 )
 
-func GetClient(endpoint string) (*azkustodata.Client, error) {
+// KustoClient is the part of the Kusto client the tools use. *Client implements it, and tests
+// or alternate backends can provide their own implementation.
+type KustoClient interface {
+	Mgmt(ctx context.Context, db string, command azkustodata.Statement, options ...azkustodata.QueryOption) (v1.Dataset, error)
+	Query(ctx context.Context, db string, stmt azkustodata.Statement, options ...azkustodata.QueryOption) (query.Dataset, error)
+	QueryToJson(ctx context.Context, db string, stmt azkustodata.Statement, options ...azkustodata.QueryOption) (string, error)
+	// Close releases the client. It must be called once the tool call is done with the client.
+	Close() error
+}
+
+var _ KustoClient = (*Client)(nil)
+
+// ClientFactory returns a client for a resolved cluster. ctx is the context of the tool call,
+// which carries the caller of an authenticated HTTP transport.
+type ClientFactory func(ctx context.Context, cluster Cluster) (KustoClient, error)
+
+// PooledClients is the ClientFactory of the server. It returns clients from the client pool.
+// When on-behalf-of is enabled, the clients act as the caller, so every caller gets their own clients.
+func PooledClients(ctx context.Context, cluster Cluster) (KustoClient, error) {
+	if GetConfig().InboundAuth.OnBehalfOf {
+		caller, ok := CallerFromContext(ctx)
+		if !ok {
+			return nil, errors.New("on-behalf-of is enabled but the request has no authenticated caller")
+		}
+		auth, err := onBehalfOf(cluster.Auth, caller)
+		if err != nil {
+			return nil, err
+		}
+		cluster.Auth = auth
+	}
+
+	client, err := GetClusterClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// GetClient returns a pooled client for the endpoint. Close it to return it to the pool.
+func GetClient(endpoint string) (*Client, error) {
+	return defaultPool.Get(endpoint, DefaultAuth())
+}
+
+// GetClusterClient returns a pooled client for a resolved cluster, using the credential settings configured for it.
+func GetClusterClient(cluster Cluster) (*Client, error) {
+	return defaultPool.Get(cluster.Endpoint, cluster.Auth)
+}
+
+func newKustoClient(endpoint string, auth AuthConfig) (*azkustodata.Client, error) {
 	// Create a connection string builder with authentication
-	kustoConnectionString := azkustodata.NewConnectionStringBuilder(endpoint).WithDefaultAzureCredential()
+	kustoConnectionString, err := connectionString(endpoint, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{
+		Transport: retryAfterTransport{base: http.DefaultTransport},
+		// same as the default client of the SDK
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
 
 	// Initialize the client
-	client, err := azkustodata.New(kustoConnectionString)
+	client, err := azkustodata.New(kustoConnectionString, azkustodata.WithHttpClient(httpClient))
 	if err != nil {
 		return nil, err
 	}
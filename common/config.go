@@ -0,0 +1,504 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the server configuration. It is read from a YAML or JSON file and
+// can be overridden with environment variables and command line flags.
+type Config struct {
+	// DefaultCluster is used when a tool call does not specify a cluster.
+	DefaultCluster string `yaml:"defaultCluster,omitempty"`
+	// DefaultDatabase is used when neither the tool call nor the cluster specify a database.
+	DefaultDatabase string `yaml:"defaultDatabase,omitempty"`
+	// Auth is the authentication used for clusters that do not configure their own.
+	Auth     AuthConfig      `yaml:"auth,omitempty"`
+	Clusters []ClusterConfig `yaml:"clusters,omitempty"`
+
+	// InboundAuth authenticates the clients of the HTTP transports.
+	InboundAuth InboundAuthConfig `yaml:"inboundAuth,omitempty"`
+	// RestrictClusters limits the cluster argument of the tools to the configured clusters, the default
+	// cluster and the cluster aliases, so that callers cannot send the credential of the server to any host.
+	// It defaults to on when inbound authentication is enabled.
+	RestrictClusters *bool `yaml:"restrictClusters,omitempty"`
+
+	// ToolTimeout is the deadline for a tool call, unless the tool has its own in ToolTimeouts.
+	ToolTimeout  time.Duration            `yaml:"toolTimeout,omitempty"`
+	ToolTimeouts map[string]time.Duration `yaml:"toolTimeouts,omitempty"`
+
+	// MaxResultRows and MaxResultBytes limit the query results returned by a tool call.
+	// Larger results are truncated.
+	MaxResultRows  int `yaml:"maxResultRows,omitempty"`
+	MaxResultBytes int `yaml:"maxResultBytes,omitempty"`
+
+	// Results that do not fit the budget are kept for ResultTTL, so that later pages can be fetched
+	// with a cursor. At most MaxStoredResults results of MaxStoredResultBytes in total are kept.
+	ResultTTL            time.Duration `yaml:"resultTTL,omitempty"`
+	MaxStoredResults     int           `yaml:"maxStoredResults,omitempty"`
+	MaxStoredResultBytes int           `yaml:"maxStoredResultBytes,omitempty"`
+
+	// Retry is the retry policy for throttled requests and transient failures of reads.
+	Retry RetryConfig `yaml:"retry,omitempty"`
+
+	// SchemaCacheTTL is how long database lists, table lists and table schemas are cached, unless the cluster
+	// has its own TTL. A negative TTL disables the cache.
+	SchemaCacheTTL time.Duration `yaml:"schemaCacheTTL,omitempty"`
+	// WarmSchemaCache fetches the table lists and schemas of the configured databases at startup.
+	WarmSchemaCache bool `yaml:"warmSchemaCache,omitempty"`
+}
+
+// defaultToolTimeout matches the default query timeout of Kusto.
+const defaultToolTimeout = 4 * time.Minute
+
+// The default result budget keeps query results small enough for the context window of a model.
+const (
+	defaultMaxResultRows  = 500
+	defaultMaxResultBytes = 64 * 1024
+)
+
+const (
+	defaultResultTTL            = 15 * time.Minute
+	defaultMaxStoredResults     = 20
+	defaultMaxStoredResultBytes = 256 * 1024 * 1024
+)
+
+// defaultSchemaCacheTTL is short enough that schema changes show up within a session.
+const defaultSchemaCacheTTL = 5 * time.Minute
+
+// ClusterConfig describes a named cluster.
+type ClusterConfig struct {
+	Name    string   `yaml:"name"`
+	Aliases []string `yaml:"aliases,omitempty"`
+	// Endpoint is a short cluster name or a full cluster URI.
+	Endpoint         string      `yaml:"endpoint"`
+	Auth             *AuthConfig `yaml:"auth,omitempty"`
+	DefaultDatabase  string      `yaml:"defaultDatabase,omitempty"`
+	AllowedDatabases []string    `yaml:"allowedDatabases,omitempty"`
+	// SchemaCacheTTL overrides the schema cache TTL of the server for the cluster. A negative TTL disables the cache.
+	SchemaCacheTTL time.Duration `yaml:"schemaCacheTTL,omitempty"`
+}
+
+// Cluster is a cluster resolved from a tool argument.
+type Cluster struct {
+	Name     string
+	Endpoint string
+	Auth     AuthConfig
+	// Config is nil if the cluster is not in the configuration file.
+	Config *ClusterConfig
+}
+
+// LoadConfig reads the configuration file. JSON files are parsed as YAML, which is a superset of JSON.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return config, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// ApplyEnv overrides the configuration with the settings defined by environment variables.
+func (c *Config) ApplyEnv() error {
+	setFromEnv(&c.DefaultCluster, "KUSTO_CLUSTER")
+	setFromEnv(&c.DefaultDatabase, "KUSTO_DATABASE")
+	c.Auth.ApplyEnv()
+	if err := c.InboundAuth.ApplyEnv(); err != nil {
+		return err
+	}
+
+	if value := os.Getenv("KUSTO_TOOL_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid KUSTO_TOOL_TIMEOUT: %w", err)
+		}
+		c.ToolTimeout = timeout
+	}
+
+	if value := os.Getenv("KUSTO_RESULT_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid KUSTO_RESULT_TTL: %w", err)
+		}
+		c.ResultTTL = ttl
+	}
+
+	if value := os.Getenv("KUSTO_RESTRICT_CLUSTERS"); value != "" {
+		restrict, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid KUSTO_RESTRICT_CLUSTERS: %w", err)
+		}
+		c.RestrictClusters = &restrict
+	}
+
+	if value := os.Getenv("KUSTO_SCHEMA_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid KUSTO_SCHEMA_CACHE_TTL: %w", err)
+		}
+		c.SchemaCacheTTL = ttl
+	}
+
+	if err := setIntFromEnv(&c.Retry.MaxAttempts, "KUSTO_RETRY_MAX_ATTEMPTS"); err != nil {
+		return err
+	}
+	if err := setIntFromEnv(&c.MaxResultRows, "KUSTO_MAX_RESULT_ROWS"); err != nil {
+		return err
+	}
+	return setIntFromEnv(&c.MaxResultBytes, "KUSTO_MAX_RESULT_BYTES")
+}
+
+func setIntFromEnv(field *int, name string) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*field = n
+	return nil
+}
+
+// TimeoutFor returns the deadline for a call to the tool.
+func (c Config) TimeoutFor(tool string) time.Duration {
+	if timeout, ok := c.ToolTimeouts[tool]; ok {
+		return timeout
+	}
+	if c.ToolTimeout > 0 {
+		return c.ToolTimeout
+	}
+	return defaultToolTimeout
+}
+
+// ResultBudget returns the maximum number of rows and bytes of query results returned by a tool call.
+func (c Config) ResultBudget() (maxRows, maxBytes int) {
+	maxRows, maxBytes = c.MaxResultRows, c.MaxResultBytes
+	if maxRows == 0 {
+		maxRows = defaultMaxResultRows
+	}
+	if maxBytes == 0 {
+		maxBytes = defaultMaxResultBytes
+	}
+	return maxRows, maxBytes
+}
+
+// ResultStoreLimits returns how long results are kept for pagination, and how many results and bytes are kept at most.
+func (c Config) ResultStoreLimits() (ttl time.Duration, maxResults, maxBytes int) {
+	ttl, maxResults, maxBytes = c.ResultTTL, c.MaxStoredResults, c.MaxStoredResultBytes
+	if ttl == 0 {
+		ttl = defaultResultTTL
+	}
+	if maxResults == 0 {
+		maxResults = defaultMaxStoredResults
+	}
+	if maxBytes == 0 {
+		maxBytes = defaultMaxStoredResultBytes
+	}
+	return ttl, maxResults, maxBytes
+}
+
+// ClustersRestricted reports whether tools may only use the configured clusters.
+func (c Config) ClustersRestricted() bool {
+	if c.RestrictClusters != nil {
+		return *c.RestrictClusters
+	}
+	return c.InboundAuth.Enabled()
+}
+
+// SchemaCacheTTLFor returns how long schema metadata of the cluster is cached, or 0 if it is not cached.
+func (c Config) SchemaCacheTTLFor(cluster Cluster) time.Duration {
+	ttl := c.SchemaCacheTTL
+	if cluster.Config != nil && cluster.Config.SchemaCacheTTL != 0 {
+		ttl = cluster.Config.SchemaCacheTTL
+	}
+	if ttl < 0 {
+		return 0
+	}
+	if ttl == 0 {
+		return defaultSchemaCacheTTL
+	}
+	return ttl
+}
+
+// Validate checks the configuration for missing or conflicting settings.
+func (c Config) Validate() error {
+	if err := c.Auth.Validate(); err != nil {
+		return err
+	}
+	if err := c.InboundAuth.Validate(); err != nil {
+		return err
+	}
+	if c.InboundAuth.OnBehalfOf && !c.Auth.confidential() {
+		return fmt.Errorf("on-behalf-of requires auth mode %s or %s", AuthClientSecret, AuthClientCertificate)
+	}
+
+	if c.ToolTimeout < 0 {
+		return errors.New("tool timeout must not be negative")
+	}
+	for tool, timeout := range c.ToolTimeouts {
+		if timeout <= 0 {
+			return fmt.Errorf("timeout for tool %s must be positive", tool)
+		}
+	}
+
+	if c.MaxResultRows < 0 || c.MaxResultBytes < 0 {
+		return errors.New("result budget must not be negative")
+	}
+	if c.ResultTTL < 0 || c.MaxStoredResults < 0 || c.MaxStoredResultBytes < 0 {
+		return errors.New("result store limits must not be negative")
+	}
+	if c.Retry.MaxAttempts < 0 || c.Retry.InitialDelay < 0 || c.Retry.MaxDelay < 0 {
+		return errors.New("retry settings must not be negative")
+	}
+
+	names := map[string]string{}
+	for _, cluster := range c.Clusters {
+		if cluster.Name == "" {
+			return errors.New("every cluster in the config file needs a name")
+		}
+		if cluster.Endpoint == "" {
+			return fmt.Errorf("cluster %s has no endpoint", cluster.Name)
+		}
+		if _, err := ResolveEndpoint(cluster.Endpoint); err != nil {
+			return fmt.Errorf("cluster %s: %w", cluster.Name, err)
+		}
+		if cluster.Auth != nil {
+			if err := cluster.Auth.Validate(); err != nil {
+				return fmt.Errorf("cluster %s: %w", cluster.Name, err)
+			}
+			if c.InboundAuth.OnBehalfOf && !cluster.Auth.confidential() {
+				return fmt.Errorf("cluster %s: on-behalf-of requires auth mode %s or %s", cluster.Name, AuthClientSecret, AuthClientCertificate)
+			}
+		}
+		if cluster.DefaultDatabase != "" && !(Cluster{Config: &cluster}).DatabaseAllowed(cluster.DefaultDatabase) {
+			return fmt.Errorf("cluster %s: default database %s is not in the allowed databases", cluster.Name, cluster.DefaultDatabase)
+		}
+
+		for _, name := range append([]string{cluster.Name}, cluster.Aliases...) {
+			key := strings.ToLower(name)
+			if other, ok := names[key]; ok {
+				return fmt.Errorf("name or alias %s is used by clusters %s and %s", name, other, cluster.Name)
+			}
+			names[key] = cluster.Name
+		}
+	}
+	return nil
+}
+
+var (
+	configMu     sync.RWMutex
+	activeConfig Config
+)
+
+// SetConfig validates the configuration and makes it the active one.
+// Cluster names and aliases become valid values for the cluster argument of the tools.
+func SetConfig(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	if err := SetDefaultAuth(c.Auth); err != nil {
+		return err
+	}
+
+	for _, cluster := range c.Clusters {
+		RegisterClusterAlias(cluster.Name, cluster.Endpoint)
+		for _, alias := range cluster.Aliases {
+			RegisterClusterAlias(alias, cluster.Endpoint)
+		}
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	activeConfig = c
+	return nil
+}
+
+// GetConfig returns the active configuration.
+func GetConfig() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	return activeConfig
+}
+
+// ResolveCluster resolves the cluster argument of a tool, falling back to the default cluster when it is empty.
+func ResolveCluster(name string) (Cluster, error) {
+	c := GetConfig()
+
+	if strings.TrimSpace(name) == "" {
+		name = c.DefaultCluster
+	}
+	if strings.TrimSpace(name) == "" {
+		return Cluster{}, errors.New("cluster name missing and no default cluster is configured")
+	}
+
+	endpoint, err := ResolveEndpoint(name)
+	if err != nil {
+		return Cluster{}, err
+	}
+
+	cluster := Cluster{Name: name, Endpoint: endpoint, Auth: DefaultAuth()}
+
+	for i := range c.Clusters {
+		configured, err := ResolveEndpoint(c.Clusters[i].Endpoint)
+		if err != nil || configured != endpoint {
+			continue
+		}
+		cluster.Config = &c.Clusters[i]
+		if cluster.Config.Auth != nil {
+			cluster.Auth = *cluster.Config.Auth
+		}
+		break
+	}
+
+	if cluster.Config == nil && c.ClustersRestricted() && !c.knownEndpoint(endpoint) {
+		return Cluster{}, fmt.Errorf("cluster %s is not configured, and the server only queries configured clusters: %s", name, strings.Join(c.knownClusterNames(), ", "))
+	}
+
+	return cluster, nil
+}
+
+// knownEndpoint reports whether the endpoint is the default cluster or the target of a cluster alias,
+// which are set up by whoever runs the server, unlike the URIs passed in tool arguments.
+func (c Config) knownEndpoint(endpoint string) bool {
+	known := []string{c.DefaultCluster}
+	for _, target := range ClusterAliases() {
+		known = append(known, target)
+	}
+	for _, name := range known {
+		if name == "" {
+			continue
+		}
+		if resolved, err := ResolveEndpoint(name); err == nil && resolved == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// knownClusterNames lists the names that resolve to the configured clusters, for error messages.
+func (c Config) knownClusterNames() []string {
+	names := []string{}
+	for _, cluster := range c.Clusters {
+		names = append(names, cluster.Name)
+	}
+	if c.DefaultCluster != "" && !slices.Contains(names, c.DefaultCluster) {
+		names = append(names, c.DefaultCluster)
+	}
+	for alias := range ClusterAliases() {
+		if !slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, alias) }) {
+			names = append(names, alias)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return []string{"none"}
+	}
+	return names
+}
+
+// ResolveDatabase returns the database to use on the cluster, falling back to the configured default
+// database when it is empty. Databases outside the allowed list of the cluster are rejected.
+func (c Cluster) ResolveDatabase(name string) (string, error) {
+	if strings.TrimSpace(name) == "" && c.Config != nil {
+		name = c.Config.DefaultDatabase
+	}
+	if strings.TrimSpace(name) == "" {
+		name = GetConfig().DefaultDatabase
+	}
+	if strings.TrimSpace(name) == "" {
+		return "", errors.New("database name missing and no default database is configured")
+	}
+
+	if !c.DatabaseAllowed(name) {
+		return "", fmt.Errorf("database %s is not allowed on cluster %s, allowed databases are: %s", name, c.Name, strings.Join(c.Config.AllowedDatabases, ", "))
+	}
+	return name, nil
+}
+
+// DatabaseAllowed reports whether the configuration allows access to the database.
+func (c Cluster) DatabaseAllowed(name string) bool {
+	if c.Config == nil || len(c.Config.AllowedDatabases) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(c.Config.AllowedDatabases, func(allowed string) bool {
+		return strings.EqualFold(allowed, name)
+	})
+}
+
+// HasDefaultDatabase reports whether a default database is configured for the server or any cluster.
+func (c Config) HasDefaultDatabase() bool {
+	if c.DefaultDatabase != "" {
+		return true
+	}
+	return slices.ContainsFunc(c.Clusters, func(cluster ClusterConfig) bool {
+		return cluster.DefaultDatabase != ""
+	})
+}
+
+// KnownClusters resolves the default cluster and the configured clusters. Clusters that resolve to the same
+// endpoint and credential settings, e.g. a configured cluster that is also the default, are returned once.
+func KnownClusters() []Cluster {
+	c := GetConfig()
+
+	names := []string{}
+	if c.DefaultCluster != "" {
+		names = append(names, c.DefaultCluster)
+	}
+	for _, cluster := range c.Clusters {
+		names = append(names, cluster.Name)
+	}
+
+	clusters := []Cluster{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		cluster, err := ResolveCluster(name)
+		if err != nil || seen[clientKey(cluster.Endpoint, cluster.Auth)] {
+			continue
+		}
+		seen[clientKey(cluster.Endpoint, cluster.Auth)] = true
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// ConfiguredClusters returns a description of each configured cluster, e.g. "prod (aliases: p, production)".
+func ConfiguredClusters() []string {
+	c := GetConfig()
+
+	descriptions := []string{}
+	for _, cluster := range c.Clusters {
+		description := cluster.Name
+		if len(cluster.Aliases) > 0 {
+			aliases := slices.Clone(cluster.Aliases)
+			sort.Strings(aliases)
+			description += " (aliases: " + strings.Join(aliases, ", ") + ")"
+		}
+		descriptions = append(descriptions, description)
+	}
+	return descriptions
+}
@@ -0,0 +1,269 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+defaultCluster: prod
+auth:
+  mode: azcli
+clusters:
+  - name: prod
+    aliases: [production, p]
+    endpoint: https://prodcluster.westeurope.kusto.windows.net
+    defaultDatabase: Logs
+    allowedDatabases: [Logs, Metrics]
+  - name: local
+    endpoint: http://localhost:8080
+    auth:
+      mode: none
+`
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	config, err := LoadConfig(writeConfig(t, "config.yaml", testConfig))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if config.DefaultCluster != "prod" || config.Auth.Mode != AuthAzureCLI || len(config.Clusters) != 2 {
+		t.Fatalf("Unexpected config: %+v", config)
+	}
+	if config.Clusters[1].Auth == nil || config.Clusters[1].Auth.Mode != AuthNone {
+		t.Fatalf("Expected per-cluster auth for local, got %+v", config.Clusters[1].Auth)
+	}
+
+	jsonConfig, err := LoadConfig(writeConfig(t, "config.json", `{"defaultCluster": "help", "clusters": [{"name": "help", "endpoint": "help"}]}`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed for JSON: %v", err)
+	}
+	if jsonConfig.DefaultCluster != "help" || jsonConfig.Clusters[0].Endpoint != "help" {
+		t.Fatalf("Unexpected JSON config: %+v", jsonConfig)
+	}
+
+	if _, err := LoadConfig(writeConfig(t, "typo.yaml", "defaultClustr: prod")); err == nil {
+		t.Fatal("Expected unknown fields to be rejected")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	invalid := map[string]Config{
+		"missing endpoint":    {Clusters: []ClusterConfig{{Name: "prod"}}},
+		"duplicate alias":     {Clusters: []ClusterConfig{{Name: "a", Endpoint: "a", Aliases: []string{"x"}}, {Name: "b", Endpoint: "b", Aliases: []string{"X"}}}},
+		"bad auth":            {Clusters: []ClusterConfig{{Name: "a", Endpoint: "a", Auth: &AuthConfig{Mode: "kerberos"}}}},
+		"default not allowed": {Clusters: []ClusterConfig{{Name: "a", Endpoint: "a", DefaultDatabase: "x", AllowedDatabases: []string{"y"}}}},
+		"negative max rows":   {MaxResultRows: -1},
+		"obo with api keys":   {InboundAuth: InboundAuthConfig{Mode: InboundAuthAPIKey, APIKeys: []APIKey{{Name: "a", Key: "k"}}, OnBehalfOf: true}},
+		"obo with azcli":      {Auth: AuthConfig{Mode: AuthAzureCLI}, InboundAuth: InboundAuthConfig{Mode: InboundAuthJWT, TenantID: "t", Audience: "a", OnBehalfOf: true}},
+	}
+
+	for name, config := range invalid {
+		if err := config.Validate(); err == nil {
+			t.Fatalf("Expected config with %s to be invalid", name)
+		}
+	}
+}
+
+func TestInboundAuthConfig(t *testing.T) {
+	valid := []InboundAuthConfig{
+		{},
+		{Mode: InboundAuthJWT, TenantID: "tenant", Audience: "api://kusto-mcp"},
+		{Mode: InboundAuthJWT, Issuer: "https://issuer.example/", JWKSURL: "https://issuer.example/keys", Audience: "aud", OnBehalfOf: true},
+		{Mode: InboundAuthAPIKey, APIKeys: []APIKey{{Name: "ci", Key: "key"}}},
+	}
+	for _, config := range valid {
+		if err := config.Validate(); err != nil {
+			t.Fatalf("Expected %+v to be valid, got %v", config, err)
+		}
+	}
+
+	invalid := []InboundAuthConfig{
+		{Mode: "basic"},
+		{Mode: InboundAuthJWT, TenantID: "tenant"},
+		{Mode: InboundAuthJWT, Issuer: "https://issuer.example/", Audience: "aud"},
+		{Mode: InboundAuthAPIKey},
+		{Mode: InboundAuthAPIKey, APIKeys: []APIKey{{Name: "ci"}}},
+		{OnBehalfOf: true},
+	}
+	for _, config := range invalid {
+		if err := config.Validate(); err == nil {
+			t.Fatalf("Expected %+v to be invalid", config)
+		}
+	}
+
+	entra := InboundAuthConfig{TenantID: "tenant"}
+	if entra.KeySetURL() != "https://login.microsoftonline.com/tenant/discovery/v2.0/keys" || len(entra.Issuers()) != 2 {
+		t.Fatalf("Unexpected Entra ID defaults %s, %v", entra.KeySetURL(), entra.Issuers())
+	}
+
+	t.Setenv("KUSTO_MCP_INBOUND_AUTH", "api-key")
+	t.Setenv("KUSTO_MCP_API_KEYS", "key-1, key-2")
+	var config InboundAuthConfig
+	if err := config.ApplyEnv(); err != nil || config.Mode != InboundAuthAPIKey || len(config.APIKeys) != 2 || config.APIKeys[1].Key != "key-2" {
+		t.Fatalf("Unexpected settings from the environment %+v, %v", config, err)
+	}
+}
+
+func TestResultBudget(t *testing.T) {
+	rows, bytes := Config{}.ResultBudget()
+	if rows != defaultMaxResultRows || bytes != defaultMaxResultBytes {
+		t.Fatalf("Expected default budget, got %d rows and %d bytes", rows, bytes)
+	}
+
+	t.Setenv("KUSTO_MAX_RESULT_ROWS", "10")
+	t.Setenv("KUSTO_MAX_RESULT_BYTES", "2048")
+
+	var config Config
+	if err := config.ApplyEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if rows, bytes := config.ResultBudget(); rows != 10 || bytes != 2048 {
+		t.Fatalf("Expected budget from environment, got %d rows and %d bytes", rows, bytes)
+	}
+
+	t.Setenv("KUSTO_MAX_RESULT_ROWS", "many")
+	if err := config.ApplyEnv(); err == nil {
+		t.Fatal("Expected invalid KUSTO_MAX_RESULT_ROWS to be rejected")
+	}
+}
+
+func TestSchemaCacheTTL(t *testing.T) {
+	prod := Cluster{Config: &ClusterConfig{Name: "prod", SchemaCacheTTL: time.Hour}}
+	live := Cluster{Config: &ClusterConfig{Name: "live", SchemaCacheTTL: -time.Second}}
+
+	if ttl := (Config{}).SchemaCacheTTLFor(Cluster{}); ttl != defaultSchemaCacheTTL {
+		t.Fatalf("Expected the default TTL, got %v", ttl)
+	}
+	if ttl := (Config{SchemaCacheTTL: time.Minute}).SchemaCacheTTLFor(prod); ttl != time.Hour {
+		t.Fatalf("Expected the TTL of the cluster, got %v", ttl)
+	}
+	if ttl := (Config{SchemaCacheTTL: time.Minute}).SchemaCacheTTLFor(live); ttl != 0 {
+		t.Fatalf("Expected the cache to be disabled for the cluster, got %v", ttl)
+	}
+	if ttl := (Config{SchemaCacheTTL: -1}).SchemaCacheTTLFor(Cluster{}); ttl != 0 {
+		t.Fatalf("Expected the cache to be disabled, got %v", ttl)
+	}
+
+	t.Setenv("KUSTO_SCHEMA_CACHE_TTL", "10m")
+	var config Config
+	if err := config.ApplyEnv(); err != nil || config.SchemaCacheTTL != 10*time.Minute {
+		t.Fatalf("Expected the TTL from the environment, got %v, %v", config.SchemaCacheTTL, err)
+	}
+}
+
+func TestResolveClusterAndDatabase(t *testing.T) {
+	config, err := LoadConfig(writeConfig(t, "config.yaml", testConfig))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if err := SetConfig(config); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+	defer SetConfig(Config{})
+
+	cluster, err := ResolveCluster("")
+	if err != nil {
+		t.Fatalf("ResolveCluster failed: %v", err)
+	}
+	if cluster.Endpoint != "https://prodcluster.westeurope.kusto.windows.net" || cluster.Auth.Mode != AuthAzureCLI {
+		t.Fatalf("Unexpected default cluster: %+v", cluster)
+	}
+
+	db, err := cluster.ResolveDatabase("")
+	if err != nil || db != "Logs" {
+		t.Fatalf("Expected default database Logs, got %s, %v", db, err)
+	}
+	if _, err := cluster.ResolveDatabase("Secrets"); err == nil {
+		t.Fatal("Expected a database outside the allowed list to be rejected")
+	}
+
+	// aliases and full URIs map to the configured cluster
+	for _, name := range []string{"production", "P", "https://prodcluster.westeurope.kusto.windows.net/"} {
+		cluster, err := ResolveCluster(name)
+		if err != nil || cluster.Config == nil || cluster.Config.Name != "prod" {
+			t.Fatalf("Expected %s to resolve to the prod cluster, got %+v, %v", name, cluster, err)
+		}
+	}
+
+	local, err := ResolveCluster("local")
+	if err != nil || local.Auth.Mode != AuthNone {
+		t.Fatalf("Expected per-cluster auth for local, got %+v, %v", local, err)
+	}
+	if _, err := local.ResolveDatabase(""); err == nil {
+		t.Fatal("Expected an error when no default database is configured")
+	}
+
+	descriptions := strings.Join(ConfiguredClusters(), "; ")
+	if descriptions != "prod (aliases: p, production); local" {
+		t.Fatalf("Unexpected cluster descriptions: %s", descriptions)
+	}
+}
+
+func TestKnownClusters(t *testing.T) {
+	config, err := LoadConfig(writeConfig(t, "config.yaml", testConfig))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if err := SetConfig(config); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+	defer SetConfig(Config{})
+
+	// the default cluster is the configured prod cluster, so it is only returned once
+	clusters := KnownClusters()
+	if len(clusters) != 2 {
+		t.Fatalf("Expected 2 clusters, got %+v", clusters)
+	}
+	if clusters[0].Name != "prod" || clusters[0].Auth.Mode != AuthAzureCLI {
+		t.Fatalf("Unexpected default cluster: %+v", clusters[0])
+	}
+	if clusters[1].Endpoint != "http://localhost:8080" || clusters[1].Auth.Mode != AuthNone {
+		t.Fatalf("Expected the local cluster with its own auth, got %+v", clusters[1])
+	}
+}
+
+func TestRestrictClusters(t *testing.T) {
+	restrict := true
+	err := SetConfig(Config{
+		DefaultCluster:   "help",
+		RestrictClusters: &restrict,
+		Clusters:         []ClusterConfig{{Name: "prod", Endpoint: "https://prodcluster.westeurope.kusto.windows.net"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetConfig(Config{})
+	RegisterClusterAlias("local-emulator", "http://localhost:8080")
+
+	for _, name := range []string{"prod", "https://prodcluster.westeurope.kusto.windows.net", "help", "https://help.kusto.windows.net", "local-emulator", "http://localhost:8080"} {
+		if _, err := ResolveCluster(name); err != nil {
+			t.Fatalf("Expected %s to be allowed, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"https://attacker.example.com", "othercluster", "http://169.254.169.254"} {
+		if _, err := ResolveCluster(name); err == nil || !strings.Contains(err.Error(), "not configured") {
+			t.Fatalf("Expected %s to be rejected, got %v", name, err)
+		}
+	}
+
+	// inbound authentication turns the restriction on unless it is configured
+	if (Config{}).ClustersRestricted() || !(Config{InboundAuth: InboundAuthConfig{Mode: InboundAuthAPIKey}}).ClustersRestricted() {
+		t.Fatal("Expected clusters to be restricted with inbound authentication only")
+	}
+	off := false
+	if (Config{InboundAuth: InboundAuthConfig{Mode: InboundAuthAPIKey}, RestrictClusters: &off}).ClustersRestricted() {
+		t.Fatal("Expected the restriction to be turned off")
+	}
+}
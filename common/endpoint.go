@@ -0,0 +1,140 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const clusterNameFormat = "https://%s.kusto.windows.net"
+
+// knownHostSuffixes are Kusto host suffixes that can be used without a scheme,
+// e.g. "mycluster.kusto.usgovcloudapi.net".
+var knownHostSuffixes = []string{
+	".kusto.windows.net",
+	".kusto.usgovcloudapi.net",
+	".kusto.chinacloudapi.cn",
+	".kusto.cloudapi.de",
+	".kusto.fabric.microsoft.com",
+	".kusto.data.microsoft.com",
+	".kustomfa.windows.net",
+}
+
+// clusterNamePattern matches a short cluster name, optionally with a region (e.g. "mycluster.westeurope").
+var clusterNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*(\.[A-Za-z0-9][A-Za-z0-9-]*)?$`)
+
+var (
+	aliasesMu sync.RWMutex
+	aliases   = map[string]string{}
+)
+
+// RegisterClusterAlias maps an alias to a cluster (a short name or a full URI).
+func RegisterClusterAlias(alias, cluster string) {
+	aliasesMu.Lock()
+	defer aliasesMu.Unlock()
+
+	aliases[strings.ToLower(alias)] = cluster
+}
+
+// ClusterAliases returns the registered aliases and the clusters they map to.
+func ClusterAliases() map[string]string {
+	aliasesMu.RLock()
+	defer aliasesMu.RUnlock()
+
+	result := make(map[string]string, len(aliases))
+	for alias, cluster := range aliases {
+		result[alias] = cluster
+	}
+	return result
+}
+
+// LoadClusterAliasesFromEnv registers aliases from KUSTO_CLUSTER_ALIASES,
+// a comma separated list of alias=cluster pairs.
+func LoadClusterAliasesFromEnv() error {
+	value := os.Getenv("KUSTO_CLUSTER_ALIASES")
+	if value == "" {
+		return nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		alias, cluster, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(alias) == "" || strings.TrimSpace(cluster) == "" {
+			return fmt.Errorf("invalid cluster alias %q in KUSTO_CLUSTER_ALIASES, expected alias=cluster", pair)
+		}
+		RegisterClusterAlias(strings.TrimSpace(alias), strings.TrimSpace(cluster))
+	}
+	return nil
+}
+
+// ResolveEndpoint turns the cluster argument of a tool into a validated cluster URI.
+// It accepts an alias, a full URI (https://mycluster.kusto.usgovcloudapi.net, http://localhost:8080),
+// a host name with a known Kusto suffix, or a short name such as "mycluster" or "mycluster.westeurope".
+func ResolveEndpoint(cluster string) (string, error) {
+	cluster = strings.TrimSpace(cluster)
+	if cluster == "" {
+		return "", fmt.Errorf("cluster name missing")
+	}
+
+	aliasesMu.RLock()
+	target, ok := aliases[strings.ToLower(cluster)]
+	aliasesMu.RUnlock()
+	if ok {
+		cluster = target
+	}
+
+	switch {
+	case strings.Contains(cluster, "://"):
+		return validateEndpoint(cluster)
+	case isLocalHost(cluster):
+		return validateEndpoint("http://" + cluster)
+	case hasKnownHostSuffix(cluster):
+		return validateEndpoint("https://" + cluster)
+	case clusterNamePattern.MatchString(cluster):
+		return validateEndpoint(fmt.Sprintf(clusterNameFormat, cluster))
+	}
+
+	return "", fmt.Errorf("invalid cluster %q: expected a cluster name, a cluster URI or a configured alias", cluster)
+}
+
+func validateEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid cluster URI %q: %w", endpoint, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("invalid cluster URI %q: scheme must be http or https", endpoint)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("invalid cluster URI %q: host is missing", endpoint)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid cluster URI %q: credentials, query and fragment are not allowed", endpoint)
+	}
+
+	return u.Scheme + "://" + strings.ToLower(u.Host) + strings.TrimSuffix(u.Path, "/"), nil
+}
+
+func isLocalHost(cluster string) bool {
+	host := strings.ToLower(cluster)
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h
+	}
+	return host == "localhost" || host == "127.0.0.1"
+}
+
+func hasKnownHostSuffix(cluster string) bool {
+	host := strings.ToLower(cluster)
+	for _, suffix := range knownHostSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// InboundAuthMode selects how clients of the HTTP transports authenticate to the server.
+type InboundAuthMode string
+
+const (
+	InboundAuthNone   InboundAuthMode = "none"
+	InboundAuthJWT    InboundAuthMode = "jwt"
+	InboundAuthAPIKey InboundAuthMode = "api-key"
+)
+
+// InboundAuthConfig holds the settings for authenticating the clients of the HTTP transports.
+// Only the fields relevant to Mode are used.
+type InboundAuthConfig struct {
+	Mode InboundAuthMode `yaml:"mode,omitempty"`
+
+	// TenantID accepts Microsoft Entra ID tokens issued by the tenant. It provides the default Issuer and JWKSURL.
+	TenantID string `yaml:"tenantId,omitempty"`
+	// Issuer is the expected iss claim of the tokens, Audience the expected aud claim.
+	Issuer   string `yaml:"issuer,omitempty"`
+	Audience string `yaml:"audience,omitempty"`
+	// JWKSURL is the URL of the key set the tokens are signed with.
+	JWKSURL string `yaml:"jwksUrl,omitempty"`
+
+	APIKeys []APIKey `yaml:"apiKeys,omitempty"`
+
+	// OnBehalfOf exchanges the token of the caller for a Kusto token, so that the cluster authorizes
+	// the caller rather than the server. It requires jwt mode and client-secret or client-certificate auth.
+	OnBehalfOf bool `yaml:"onBehalfOf,omitempty"`
+}
+
+// APIKey is a static key accepted in api-key mode. The name identifies the caller in logs.
+type APIKey struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+// ApplyEnv overrides the settings with the ones defined by environment variables.
+// KUSTO_MCP_API_KEYS is a comma separated list of keys.
+func (a *InboundAuthConfig) ApplyEnv() error {
+	setFromEnv((*string)(&a.Mode), "KUSTO_MCP_INBOUND_AUTH")
+	setFromEnv(&a.TenantID, "KUSTO_MCP_INBOUND_TENANT_ID")
+	setFromEnv(&a.Issuer, "KUSTO_MCP_ISSUER")
+	setFromEnv(&a.Audience, "KUSTO_MCP_AUDIENCE")
+	setFromEnv(&a.JWKSURL, "KUSTO_MCP_JWKS_URL")
+
+	if value := os.Getenv("KUSTO_MCP_API_KEYS"); value != "" {
+		a.APIKeys = nil
+		for i, key := range strings.Split(value, ",") {
+			a.APIKeys = append(a.APIKeys, APIKey{Name: fmt.Sprintf("env-%d", i+1), Key: strings.TrimSpace(key)})
+		}
+	}
+
+	if value := os.Getenv("KUSTO_MCP_ON_BEHALF_OF"); value != "" {
+		onBehalfOf, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid KUSTO_MCP_ON_BEHALF_OF: %w", err)
+		}
+		a.OnBehalfOf = onBehalfOf
+	}
+	return nil
+}
+
+// Validate checks that the settings required by the mode are present.
+func (a InboundAuthConfig) Validate() error {
+	switch a.mode() {
+	case InboundAuthNone:
+	case InboundAuthJWT:
+		if a.Audience == "" {
+			return errors.New("inbound auth mode jwt requires an audience")
+		}
+		if len(a.Issuers()) == 0 || a.KeySetURL() == "" {
+			return errors.New("inbound auth mode jwt requires a tenant ID, or an issuer and a JWKS URL")
+		}
+	case InboundAuthAPIKey:
+		if len(a.APIKeys) == 0 {
+			return errors.New("inbound auth mode api-key requires at least one API key")
+		}
+		for _, key := range a.APIKeys {
+			if key.Key == "" {
+				return fmt.Errorf("API key %s is empty", key.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown inbound auth mode %q, expected none, jwt or api-key", a.Mode)
+	}
+
+	if a.OnBehalfOf && a.mode() != InboundAuthJWT {
+		return errors.New("on-behalf-of requires inbound auth mode jwt, as it needs the token of the caller")
+	}
+	return nil
+}
+
+func (a InboundAuthConfig) mode() InboundAuthMode {
+	if a.Mode == "" {
+		return InboundAuthNone
+	}
+	return a.Mode
+}
+
+// Enabled reports whether clients have to authenticate.
+func (a InboundAuthConfig) Enabled() bool {
+	return a.mode() != InboundAuthNone
+}
+
+// Issuers returns the accepted issuers. Entra ID issues v1.0 and v2.0 tokens with different issuers.
+func (a InboundAuthConfig) Issuers() []string {
+	if a.Issuer != "" {
+		return []string{a.Issuer}
+	}
+	if a.TenantID != "" {
+		return []string{
+			"https://login.microsoftonline.com/" + a.TenantID + "/v2.0",
+			"https://sts.windows.net/" + a.TenantID + "/",
+		}
+	}
+	return nil
+}
+
+// KeySetURL returns the URL of the signing keys.
+func (a InboundAuthConfig) KeySetURL() string {
+	if a.JWKSURL == "" && a.TenantID != "" {
+		return "https://login.microsoftonline.com/" + a.TenantID + "/discovery/v2.0/keys"
+	}
+	return a.JWKSURL
+}
+
+// Caller is an authenticated client of an HTTP transport.
+type Caller struct {
+	// ID identifies the caller, e.g. the object ID of an Entra ID principal or the name of an API key.
+	ID string
+	// Name is a display name for logs, e.g. the user principal name.
+	Name string
+	// Token is the bearer token the caller presented. It is only set for JWT callers.
+	Token string
+}
+
+type callerKey struct{}
+
+// WithCaller returns a context carrying the authenticated caller of a request.
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the authenticated caller of a request, if any.
+func CallerFromContext(ctx context.Context) (Caller, bool) {
+	caller, ok := ctx.Value(callerKey{}).(Caller)
+	return caller, ok
+}
@@ -0,0 +1,245 @@
+package common
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+)
+
+const (
+	defaultMaxLifetime  = time.Hour
+	defaultIdleTimeout  = 10 * time.Minute
+	defaultReapInterval = time.Minute
+)
+
+var errPoolClosed = errors.New("kusto client pool is closed")
+
+// Client is a Kusto client borrowed from a ClientPool.
+// Calling Close returns it to the pool instead of tearing down the connection.
+type Client struct {
+	*azkustodata.Client
+	entry *poolEntry
+	once  sync.Once
+}
+
+// Close releases the client back to the pool it was borrowed from.
+func (c *Client) Close() error {
+	c.once.Do(func() {
+		c.entry.pool.release(c.entry)
+	})
+	return nil
+}
+
+type poolEntry struct {
+	pool     *ClientPool
+	key      string
+	auth     AuthConfig
+	client   *azkustodata.Client
+	created  time.Time
+	lastUsed time.Time
+	refs     int
+	retired  bool
+}
+
+// ClientPool caches Kusto clients keyed by endpoint and credential settings so that
+// consecutive tool calls reuse the same credential, token cache and connections.
+type ClientPool struct {
+	mu          sync.Mutex
+	entries     map[string]*poolEntry
+	newClient   func(endpoint string, auth AuthConfig) (*azkustodata.Client, error)
+	maxLifetime time.Duration
+	idleTimeout time.Duration
+	closed      bool
+	stop        chan struct{}
+	now         func() time.Time
+}
+
+// NewClientPool creates a pool whose clients are recreated after maxLifetime and evicted
+// once they have been idle for idleTimeout. A zero value disables the respective limit.
+func NewClientPool(maxLifetime, idleTimeout time.Duration) *ClientPool {
+	p := &ClientPool{
+		entries:     map[string]*poolEntry{},
+		newClient:   newKustoClient,
+		maxLifetime: maxLifetime,
+		idleTimeout: idleTimeout,
+		stop:        make(chan struct{}),
+		now:         time.Now,
+	}
+	go p.reapLoop(defaultReapInterval)
+	return p
+}
+
+// Get returns a pooled client for the endpoint and credential settings, creating one if needed.
+// The caller must Close the returned client when done with it.
+// Clients are created without holding the lock, since creating the credential may fetch a token,
+// which must not block the clients of other clusters.
+func (p *ClientPool) Get(endpoint string, auth AuthConfig) (*Client, error) {
+	key := clientKey(endpoint, auth)
+
+	if client, err := p.borrow(key); client != nil || err != nil {
+		return client, err
+	}
+
+	created, err := p.newClient(endpoint, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		created.Close()
+		return nil, errPoolClosed
+	}
+
+	// another call may have created a client for the key in the meantime
+	if client := p.borrowLocked(key); client != nil {
+		created.Close()
+		return client, nil
+	}
+
+	entry := &poolEntry{pool: p, key: key, auth: auth, client: created, created: p.now()}
+	p.entries[key] = entry
+	return p.lend(entry), nil
+}
+
+// borrow returns the pooled client for the key, or nil if there is none.
+func (p *ClientPool) borrow(key string) (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, errPoolClosed
+	}
+	return p.borrowLocked(key), nil
+}
+
+// borrowLocked returns the pooled client for the key, retiring it if it expired. Must be called with p.mu held.
+func (p *ClientPool) borrowLocked(key string) *Client {
+	entry, ok := p.entries[key]
+	if !ok {
+		return nil
+	}
+	if p.expired(entry, p.now()) {
+		p.retire(entry)
+		return nil
+	}
+	return p.lend(entry)
+}
+
+// lend hands out the client of the entry. Must be called with p.mu held.
+func (p *ClientPool) lend(entry *poolEntry) *Client {
+	entry.refs++
+	entry.lastUsed = p.now()
+
+	return &Client{Client: entry.client, entry: entry}
+}
+
+// Close shuts down every pooled client. Clients that are still borrowed are closed
+// as soon as they are released.
+func (p *ClientPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.stop)
+
+	for _, entry := range p.entries {
+		p.retire(entry)
+	}
+}
+
+func (p *ClientPool) release(entry *poolEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry.refs--
+	entry.lastUsed = p.now()
+
+	if entry.retired && entry.refs == 0 {
+		entry.client.Close()
+	}
+}
+
+// retire removes the entry from the pool and closes it once nobody is using it. The on-behalf-of credential
+// of a caller is forgotten along with their last client, so that callers who went away are not kept forever.
+// Must be called with p.mu held.
+func (p *ClientPool) retire(entry *poolEntry) {
+	if p.entries[entry.key] == entry {
+		delete(p.entries, entry.key)
+	}
+	entry.retired = true
+
+	if entry.refs == 0 {
+		entry.client.Close()
+	}
+
+	if entry.auth.Caller != "" && !p.hasCaller(entry.auth) {
+		forgetCaller(entry.auth)
+	}
+}
+
+// hasCaller reports whether the pool has a client for the caller of the settings, e.g. for another cluster.
+// Must be called with p.mu held.
+func (p *ClientPool) hasCaller(auth AuthConfig) bool {
+	key := auth.Key()
+	for _, entry := range p.entries {
+		if entry.auth.Key() == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ClientPool) expired(entry *poolEntry, now time.Time) bool {
+	return p.maxLifetime > 0 && now.Sub(entry.created) >= p.maxLifetime
+}
+
+func (p *ClientPool) idle(entry *poolEntry, now time.Time) bool {
+	return p.idleTimeout > 0 && entry.refs == 0 && now.Sub(entry.lastUsed) >= p.idleTimeout
+}
+
+// reap evicts idle and expired clients that are not currently borrowed.
+func (p *ClientPool) reap() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	for _, entry := range p.entries {
+		if entry.refs == 0 && (p.idle(entry, now) || p.expired(entry, now)) {
+			p.retire(entry)
+		}
+	}
+}
+
+func (p *ClientPool) reapLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.reap()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// clientKey identifies a pooled client by endpoint and credential settings.
+func clientKey(endpoint string, auth AuthConfig) string {
+	return endpoint + "|" + auth.Key()
+}
+
+var defaultPool = NewClientPool(defaultMaxLifetime, defaultIdleTimeout)
+
+// CloseClients closes all clients in the default pool. It should be called on shutdown.
+func CloseClients() {
+	defaultPool.Close()
+}
@@ -0,0 +1,214 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+)
+
+func newTestPool(maxLifetime, idleTimeout time.Duration) (*ClientPool, *time.Time, *int) {
+	now := time.Now()
+	created := 0
+
+	p := &ClientPool{
+		entries: map[string]*poolEntry{},
+		newClient: func(endpoint string, auth AuthConfig) (*azkustodata.Client, error) {
+			created++
+			return &azkustodata.Client{}, nil
+		},
+		maxLifetime: maxLifetime,
+		idleTimeout: idleTimeout,
+		stop:        make(chan struct{}),
+		now:         func() time.Time { return now },
+	}
+	return p, &now, &created
+}
+
+func TestClientPoolReusesClients(t *testing.T) {
+	p, _, created := newTestPool(time.Hour, time.Minute)
+	defer p.Close()
+
+	first, err := p.Get("https://help.kusto.windows.net/", AuthConfig{})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	first.Close()
+
+	second, err := p.Get("https://help.kusto.windows.net/", AuthConfig{})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer second.Close()
+
+	if *created != 1 {
+		t.Fatalf("Expected 1 client to be created, got %d", *created)
+	}
+	if first.Client != second.Client {
+		t.Fatal("Expected the same underlying client to be reused")
+	}
+
+	other, err := p.Get("https://other.kusto.windows.net/", AuthConfig{})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer other.Close()
+
+	if *created != 2 {
+		t.Fatalf("Expected a new client for a different endpoint, got %d created", *created)
+	}
+
+	cli, err := p.Get("https://help.kusto.windows.net/", AuthConfig{Mode: AuthAzureCLI})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer cli.Close()
+
+	if *created != 3 {
+		t.Fatalf("Expected a new client for different credential settings, got %d created", *created)
+	}
+}
+
+func TestClientPoolIdleEviction(t *testing.T) {
+	p, now, created := newTestPool(time.Hour, time.Minute)
+	defer p.Close()
+
+	inUse, _ := p.Get("https://a.kusto.windows.net/", AuthConfig{})
+	idle, _ := p.Get("https://b.kusto.windows.net/", AuthConfig{})
+	idle.Close()
+
+	*now = now.Add(2 * time.Minute)
+	p.reap()
+
+	if _, ok := p.entries[clientKey("https://a.kusto.windows.net/", AuthConfig{})]; !ok {
+		t.Fatal("Borrowed client must not be evicted")
+	}
+	if _, ok := p.entries[clientKey("https://b.kusto.windows.net/", AuthConfig{})]; ok {
+		t.Fatal("Expected idle client to be evicted")
+	}
+	inUse.Close()
+
+	c, _ := p.Get("https://b.kusto.windows.net/", AuthConfig{})
+	defer c.Close()
+
+	if *created != 3 {
+		t.Fatalf("Expected evicted client to be recreated, got %d created", *created)
+	}
+}
+
+func TestClientPoolForgetsIdleCallers(t *testing.T) {
+	p, now, _ := newTestPool(time.Hour, time.Minute)
+	defer p.Close()
+
+	app := AuthConfig{Mode: AuthClientSecret, TenantID: "tenant", ClientID: "client", ClientSecret: "secret"}
+	alice, err := onBehalfOf(app, Caller{ID: "alice", Token: "token-1"})
+	if err != nil {
+		t.Fatalf("onBehalfOf failed: %v", err)
+	}
+
+	a, _ := p.Get("https://a.kusto.windows.net/", alice)
+	b, _ := p.Get("https://b.kusto.windows.net/", alice)
+	a.Close()
+
+	// the caller still has a client for another cluster
+	*now = now.Add(2 * time.Minute)
+	p.reap()
+	if _, ok := oboCredentials[alice.Key()]; !ok {
+		t.Fatal("Expected the credential to be kept while the caller has clients")
+	}
+
+	b.Close()
+	*now = now.Add(2 * time.Minute)
+	p.reap()
+	if _, ok := oboCredentials[alice.Key()]; ok {
+		t.Fatal("Expected the credential to be forgotten with the last client of the caller")
+	}
+	if _, ok := credentials[alice.Key()]; ok {
+		t.Fatal("Expected the credential to be forgotten with the last client of the caller")
+	}
+
+	// a client created right after the eviction still gets the credential of the caller
+	if cred, err := credential(alice); err != nil || cred == nil || oboCredentials[alice.Key()] == nil {
+		t.Fatalf("Expected the credential to be registered again, got %v, %v", cred, err)
+	}
+}
+
+func TestClientPoolMaxLifetime(t *testing.T) {
+	p, now, created := newTestPool(time.Hour, 0)
+	defer p.Close()
+
+	old, _ := p.Get("https://a.kusto.windows.net/", AuthConfig{})
+
+	*now = now.Add(2 * time.Hour)
+
+	fresh, _ := p.Get("https://a.kusto.windows.net/", AuthConfig{})
+	defer fresh.Close()
+
+	if *created != 2 {
+		t.Fatalf("Expected expired client to be replaced, got %d created", *created)
+	}
+	if !old.entry.retired {
+		t.Fatal("Expected expired entry to be retired")
+	}
+	old.Close()
+}
+
+func TestClientPoolClose(t *testing.T) {
+	p, _, _ := newTestPool(time.Hour, time.Minute)
+
+	c, _ := p.Get("https://a.kusto.windows.net/", AuthConfig{})
+	p.Close()
+
+	if !c.entry.retired {
+		t.Fatal("Expected entries to be retired on Close")
+	}
+	c.Close()
+
+	if _, err := p.Get("https://a.kusto.windows.net/", AuthConfig{}); err == nil {
+		t.Fatal("Expected Get to fail on a closed pool")
+	}
+}
+
+func TestClientPoolCreatesClientsOutsideLock(t *testing.T) {
+	p, _, _ := newTestPool(time.Hour, time.Minute)
+	defer p.Close()
+
+	unblock := make(chan struct{})
+	p.newClient = func(endpoint string, auth AuthConfig) (*azkustodata.Client, error) {
+		if endpoint == "https://slow.kusto.windows.net/" {
+			<-unblock
+		}
+		return &azkustodata.Client{}, nil
+	}
+
+	slow := make(chan *Client)
+	go func() {
+		client, _ := p.Get("https://slow.kusto.windows.net/", AuthConfig{})
+		slow <- client
+	}()
+
+	// a client whose credential hangs does not hold up the clients of other clusters
+	done := make(chan error)
+	go func() {
+		client, err := p.Get("https://help.kusto.windows.net/", AuthConfig{})
+		if err == nil {
+			client.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get was blocked by the creation of another client")
+	}
+
+	close(unblock)
+	if client := <-slow; client == nil {
+		t.Fatal("Expected the slow client to be created")
+	} else {
+		client.Close()
+	}
+}
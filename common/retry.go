@@ -0,0 +1,197 @@
+package common
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	kustoerrors "github.com/Azure/azure-kusto-go/azkustodata/errors"
+	"github.com/Azure/azure-kusto-go/azkustodata/query"
+	v1 "github.com/Azure/azure-kusto-go/azkustodata/query/v1"
+)
+
+// RetryConfig is the retry policy for throttled requests and transient failures.
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts of a request, including the first one. 1 disables retries.
+	MaxAttempts int `yaml:"maxAttempts,omitempty"`
+	// InitialDelay is the delay before the first retry. It doubles with every retry, up to MaxDelay.
+	InitialDelay time.Duration `yaml:"initialDelay,omitempty"`
+	MaxDelay     time.Duration `yaml:"maxDelay,omitempty"`
+}
+
+const (
+	defaultMaxAttempts  = 4
+	defaultInitialDelay = 500 * time.Millisecond
+	defaultMaxDelay     = 30 * time.Second
+)
+
+func (r RetryConfig) withDefaults() RetryConfig {
+	if r.MaxAttempts == 0 {
+		r.MaxAttempts = defaultMaxAttempts
+	}
+	if r.InitialDelay == 0 {
+		r.InitialDelay = defaultInitialDelay
+	}
+	if r.MaxDelay == 0 {
+		r.MaxDelay = defaultMaxDelay
+	}
+	return r
+}
+
+// backoff returns the delay before the retry following the attempt: exponential, with jitter
+// so that concurrent calls do not retry in lockstep.
+func (r RetryConfig) backoff(attempt int) time.Duration {
+	delay := r.InitialDelay << (attempt - 1)
+	if delay > r.MaxDelay || delay <= 0 {
+		delay = r.MaxDelay
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// CallStats records the Kusto requests made for a tool call.
+type CallStats struct {
+	attempts atomic.Int32
+	// retryAfter is the delay the service asked for in the last response, in nanoseconds
+	retryAfter atomic.Int64
+}
+
+// Attempts returns the number of requests sent to Kusto, including retries.
+func (s *CallStats) Attempts() int {
+	return int(s.attempts.Load())
+}
+
+type callStatsKey struct{}
+
+// WithCallStats returns a context that records the Kusto requests made with it.
+func WithCallStats(ctx context.Context) (context.Context, *CallStats) {
+	stats := &CallStats{}
+	return context.WithValue(ctx, callStatsKey{}, stats), stats
+}
+
+// withRetry calls the function until it succeeds, the error is not transient, the attempts are
+// used up or the deadline of the context leaves no time for another attempt.
+func withRetry[T any](ctx context.Context, policy RetryConfig, call func(ctx context.Context) (T, error)) (T, error) {
+	policy = policy.withDefaults()
+
+	// the transport reports Retry-After through the context of the request
+	stats, ok := ctx.Value(callStatsKey{}).(*CallStats)
+	if !ok {
+		ctx, stats = WithCallStats(ctx)
+	}
+
+	for attempt := 1; ; attempt++ {
+		stats.attempts.Add(1)
+		stats.retryAfter.Store(0)
+
+		result, err := call(ctx)
+		if err == nil || attempt >= policy.MaxAttempts || !isTransient(ctx, err) {
+			return result, err
+		}
+
+		delay := policy.backoff(attempt)
+		// the service may ask for a long wait, which is limited like the backoff
+		if retryAfter := time.Duration(stats.retryAfter.Load()); retryAfter > 0 {
+			delay = min(retryAfter, policy.MaxDelay)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return result, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		}
+	}
+}
+
+// isTransient reports whether a request failed because of throttling or a transient network or gateway error.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	// errors.As cannot be used, since combined Kusto errors unwrap to themselves
+	switch err := err.(type) {
+	case *kustoerrors.HttpError:
+		switch err.StatusCode {
+		case http.StatusTooManyRequests, http.StatusRequestTimeout, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	case *kustoerrors.Error:
+		// the SDK reports network failures as HTTP errors without a status code
+		return err.Kind == kustoerrors.KHTTPError || err.Kind == kustoerrors.KIO
+	}
+	return false
+}
+
+// isReadCommand reports whether a control command only reads, so that it can be retried safely.
+func isReadCommand(command string) bool {
+	return strings.HasPrefix(strings.TrimSpace(command), ".show ")
+}
+
+// Mgmt runs a control command. Commands that only read (.show) are retried on transient failures.
+func (c *Client) Mgmt(ctx context.Context, db string, command azkustodata.Statement, options ...azkustodata.QueryOption) (v1.Dataset, error) {
+	policy := RetryConfig{MaxAttempts: 1}
+	if isReadCommand(command.String()) {
+		policy = GetConfig().Retry
+	}
+	return withRetry(ctx, policy, func(ctx context.Context) (v1.Dataset, error) {
+		return c.Client.Mgmt(ctx, db, command, options...)
+	})
+}
+
+// Query runs a query, retrying on transient failures.
+func (c *Client) Query(ctx context.Context, db string, stmt azkustodata.Statement, options ...azkustodata.QueryOption) (query.Dataset, error) {
+	return withRetry(ctx, GetConfig().Retry, func(ctx context.Context) (query.Dataset, error) {
+		return c.Client.Query(ctx, db, stmt, options...)
+	})
+}
+
+// QueryToJson runs a query and returns the raw response, retrying on transient failures.
+func (c *Client) QueryToJson(ctx context.Context, db string, stmt azkustodata.Statement, options ...azkustodata.QueryOption) (string, error) {
+	return withRetry(ctx, GetConfig().Retry, func(ctx context.Context) (string, error) {
+		return c.Client.QueryToJson(ctx, db, stmt, options...)
+	})
+}
+
+// retryAfterTransport records the Retry-After header of throttled responses in the CallStats of the request.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+
+	if delay := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); delay > 0 {
+		if stats, ok := req.Context().Value(callStatsKey{}).(*CallStats); ok {
+			stats.retryAfter.Store(int64(delay))
+		}
+	}
+	return resp, nil
+}
+
+// parseRetryAfter parses a Retry-After header, which holds either seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now)
+	}
+	return 0
+}
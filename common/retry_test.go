@@ -0,0 +1,147 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	kustoerrors "github.com/Azure/azure-kusto-go/azkustodata/errors"
+)
+
+func throttledError() error {
+	return kustoerrors.HTTP(kustoerrors.OpQuery, "429 Too Many Requests", http.StatusTooManyRequests, io.NopCloser(strings.NewReader(`{"error": {"code": "TooManyRequests"}}`)), "error from Kusto endpoint")
+}
+
+var fastRetries = RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func TestWithRetryTransientErrors(t *testing.T) {
+	ctx, stats := WithCallStats(context.Background())
+
+	calls := 0
+	result, err := withRetry(ctx, fastRetries, func(ctx context.Context) (string, error) {
+		calls++
+		if calls < 3 {
+			return "", throttledError()
+		}
+		return "ok", nil
+	})
+
+	if err != nil || result != "ok" {
+		t.Fatalf("Expected success after retries, got %q, %v", result, err)
+	}
+	if stats.Attempts() != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", stats.Attempts())
+	}
+}
+
+func TestWithRetryGivesUp(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		attempts int
+	}{
+		"attempts used up": {throttledError(), 3},
+		"bad request":      {kustoerrors.HTTP(kustoerrors.OpQuery, "400 Bad Request", http.StatusBadRequest, io.NopCloser(strings.NewReader("{}")), ""), 1},
+		"other error":      {errors.New("semantic error"), 1},
+		"network error":    {kustoerrors.E(kustoerrors.OpQuery, kustoerrors.KHTTPError, errors.New("connection reset")), 3},
+	}
+
+	for name, test := range tests {
+		ctx, stats := WithCallStats(context.Background())
+		_, err := withRetry(ctx, fastRetries, func(ctx context.Context) (string, error) {
+			return "", test.err
+		})
+		if err != test.err || stats.Attempts() != test.attempts {
+			t.Fatalf("%s: expected %d attempts and the error, got %d attempts and %v", name, test.attempts, stats.Attempts(), err)
+		}
+	}
+}
+
+func TestWithRetryRespectsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ctx, stats := WithCallStats(ctx)
+
+	// the delay asked for by the service does not fit the deadline
+	policy := RetryConfig{MaxAttempts: 5, InitialDelay: time.Second, MaxDelay: time.Second}
+	start := time.Now()
+	_, err := withRetry(ctx, policy, func(ctx context.Context) (string, error) {
+		return "", throttledError()
+	})
+
+	if err == nil || stats.Attempts() != 1 || time.Since(start) > 40*time.Millisecond {
+		t.Fatalf("Expected to give up without waiting, got %d attempts after %s", stats.Attempts(), time.Since(start))
+	}
+}
+
+func TestWithRetryLimitsRetryAfter(t *testing.T) {
+	ctx, stats := WithCallStats(context.Background())
+
+	start := time.Now()
+	_, err := withRetry(ctx, fastRetries, func(ctx context.Context) (string, error) {
+		stats.retryAfter.Store(int64(24 * time.Hour))
+		return "", throttledError()
+	})
+
+	if err == nil || stats.Attempts() != 3 || time.Since(start) > 5*time.Second {
+		t.Fatalf("Expected Retry-After to be limited to the maximum delay, got %d attempts after %s", stats.Attempts(), time.Since(start))
+	}
+}
+
+func TestRetryAfterTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, stats := WithCallStats(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, nil)
+
+	client := &http.Client{Transport: retryAfterTransport{base: http.DefaultTransport}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if delay := time.Duration(stats.retryAfter.Load()); delay != 7*time.Second {
+		t.Fatalf("Expected Retry-After of 7s, got %s", delay)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"Wed, 01 Jan 2025 12:00:10 GMT": 10 * time.Second,
+		"soon":                          0,
+	}
+	for value, expected := range tests {
+		if delay := parseRetryAfter(value, now); delay != expected {
+			t.Fatalf("Expected %s for %q, got %s", expected, value, delay)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryConfig{}.withDefaults()
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		delay := policy.backoff(attempt)
+		ceiling := min(defaultInitialDelay<<(attempt-1), defaultMaxDelay)
+		if delay < ceiling/2 || delay > ceiling {
+			t.Fatalf("Expected delay of attempt %d between %s and %s, got %s", attempt, ceiling/2, ceiling, delay)
+		}
+	}
+
+	if !isReadCommand(".show databases") || isReadCommand(".drop table T") {
+		t.Fatal("Expected only .show commands to be read commands")
+	}
+}
@@ -0,0 +1,89 @@
+package kustotest
+
+import (
+	"net/http"
+	"time"
+)
+
+// OneAPIError is an error in the OneAPI format of Kusto responses.
+type OneAPIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Type is the exception type, e.g. Kusto.Data.Exceptions.SyntaxException.
+	Type string `json:"@type,omitempty"`
+	// Description is the detailed message.
+	Description string `json:"@message,omitempty"`
+	Permanent   bool   `json:"@permanent"`
+}
+
+// Fault makes the fake cluster fail requests instead of answering them.
+type Fault struct {
+	// Endpoint limits the fault to MgmtPath or QueryPath. Empty matches both.
+	Endpoint string
+	// Count is the number of requests that fail. 0 fails every request.
+	Count int
+	// StatusCode is the HTTP status of the failed requests. With 0, queries return their rows
+	// followed by the error, as Kusto reports partial query failures.
+	StatusCode int
+	// RetryAfter is the value of the Retry-After header, e.g. "1".
+	RetryAfter string
+	Error      OneAPIError
+	// Delay holds the response back, or until the client gives up on the request. A fault with only a
+	// delay answers the request as usual afterwards.
+	Delay time.Duration
+}
+
+// delayOnly reports whether the fault only delays the response.
+func (f *Fault) delayOnly() bool {
+	return f.StatusCode == 0 && f.Error == (OneAPIError{})
+}
+
+// InjectFault adds a fault. Faults apply in the order they were added.
+func (s *Server) InjectFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &fault)
+}
+
+// Throttled fails the next count requests with 429 Too Many Requests.
+func Throttled(count int, retryAfter string) Fault {
+	return Fault{
+		Count:      count,
+		StatusCode: http.StatusTooManyRequests,
+		RetryAfter: retryAfter,
+		Error: OneAPIError{
+			Code:        "TooManyRequests",
+			Message:     "Request is throttled.",
+			Type:        "Kusto.DataNode.Exceptions.ControlCommandThrottledException",
+			Description: "The control command was aborted due to throttling. Retrying after some backoff might succeed.",
+		},
+	}
+}
+
+// Unauthorized fails every request with 401 Unauthorized.
+func Unauthorized() Fault {
+	return Fault{
+		StatusCode: http.StatusUnauthorized,
+		Error:      OneAPIError{Code: "Unauthorized", Message: "The caller is not authenticated.", Permanent: true},
+	}
+}
+
+// PartialFailure makes queries return their rows followed by a limits exceeded error.
+func PartialFailure() Fault {
+	return Fault{
+		Endpoint: QueryPath,
+		Error: OneAPIError{
+			Code:        "LimitsExceeded",
+			Message:     "Request is invalid and cannot be executed.",
+			Type:        "Kusto.Data.Exceptions.KustoServicePartialQueryFailureLimitsExceededException",
+			Description: "Query execution has exceeded the allowed limits (80DA0003): The results of this query exceed the set limit of records, so not all records were returned (E_QUERY_RESULT_SET_TOO_LARGE, 0x80DA0003).",
+			Permanent:   true,
+		},
+	}
+}
+
+// Slow delays the response to every query, e.g. to test that a query can be cancelled.
+func Slow(delay time.Duration) Fault {
+	return Fault{Endpoint: QueryPath, Delay: delay}
+}
@@ -0,0 +1,256 @@
+package kustotest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// columnTypes maps KQL types to the data types of v1 responses and the .NET types of table schemas.
+var columnTypes = map[string]struct {
+	dataType   string
+	dotnetType string
+}{
+	"bool":     {"Boolean", "System.SByte"},
+	"datetime": {"DateTime", "System.DateTime"},
+	"decimal":  {"Decimal", "System.Data.SqlTypes.SqlDecimal"},
+	"dynamic":  {"Object", "System.Object"},
+	"guid":     {"Guid", "System.Guid"},
+	"int":      {"Int32", "System.Int32"},
+	"long":     {"Int64", "System.Int64"},
+	"real":     {"Double", "System.Double"},
+	"string":   {"String", "System.String"},
+	"timespan": {"TimeSpan", "System.TimeSpan"},
+}
+
+// schema is the result of .show table T schema as json.
+type schema struct {
+	Name           string         `json:"Name"`
+	OrderedColumns []schemaColumn `json:"OrderedColumns"`
+}
+
+type schemaColumn struct {
+	Name    string `json:"Name"`
+	Type    string `json:"Type"`
+	CslType string `json:"CslType"`
+}
+
+func tableSchema(table Table) schema {
+	s := schema{Name: table.Name, OrderedColumns: []schemaColumn{}}
+	for _, column := range table.Columns {
+		s.OrderedColumns = append(s.OrderedColumns, schemaColumn{Name: column.Name, Type: columnTypes[column.Type].dotnetType, CslType: column.Type})
+	}
+	return s
+}
+
+// databasesSchema is the result of .show database D schema as json and .show databases (D1, D2) schema as json.
+func databasesSchema(dbs []*database) map[string]any {
+	schemas := map[string]any{}
+	for _, db := range dbs {
+		schemas[db.name] = databaseSchema(db)
+	}
+	return map[string]any{"Databases": schemas}
+}
+
+func databaseSchema(db *database) map[string]any {
+	tables := map[string]any{}
+	for _, table := range db.tables {
+		tables[table.Name] = tableSchema(table)
+	}
+
+	functions := map[string]any{}
+	for _, function := range db.functions {
+		functions[function.Name] = map[string]any{
+			"Name":            function.Name,
+			"InputParameters": inputParameters(function.Parameters),
+			"Body":            function.Body,
+			"Folder":          function.Folder,
+			"DocString":       function.DocString,
+		}
+	}
+
+	return map[string]any{
+		"Name":              db.name,
+		"Tables":            tables,
+		"ExternalTables":    map[string]any{},
+		"MaterializedViews": map[string]any{},
+		"Functions":         functions,
+	}
+}
+
+type inputParameter struct {
+	Name            string  `json:"Name"`
+	Type            string  `json:"Type"`
+	CslType         string  `json:"CslType"`
+	CslDefaultValue *string `json:"CslDefaultValue"`
+}
+
+// inputParameters parses a scalar parameter list such as (state:string, limit:long = 10).
+func inputParameters(parameters string) []inputParameter {
+	result := []inputParameter{}
+	for _, parameter := range strings.Split(strings.Trim(parameters, "()"), ",") {
+		declaration, defaultValue, hasDefault := strings.Cut(parameter, "=")
+		name, cslType, ok := strings.Cut(declaration, ":")
+		if !ok {
+			continue
+		}
+		cslType = strings.TrimSpace(cslType)
+
+		p := inputParameter{Name: strings.TrimSpace(name), Type: columnTypes[cslType].dotnetType, CslType: cslType}
+		if hasDefault {
+			value := strings.TrimSpace(defaultValue)
+			p.CslDefaultValue = &value
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+type v1Column struct {
+	ColumnName string `json:"ColumnName"`
+	DataType   string `json:"DataType"`
+	ColumnType string `json:"ColumnType"`
+}
+
+// writeV1 writes the result of a control command in the v1 format, as a single table.
+func writeV1(w http.ResponseWriter, table Table) {
+	columns := []v1Column{}
+	for _, column := range table.Columns {
+		columns = append(columns, v1Column{ColumnName: column.Name, DataType: columnTypes[column.Type].dataType, ColumnType: column.Type})
+	}
+	rows := table.Rows
+	if rows == nil {
+		rows = [][]any{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"Tables": []any{map[string]any{"TableName": "Table_0", "Columns": columns, "Rows": rows}},
+	})
+}
+
+type v2Column struct {
+	ColumnName string `json:"ColumnName"`
+	ColumnType string `json:"ColumnType"`
+}
+
+func v2Columns(columns []Column) []v2Column {
+	result := []v2Column{}
+	for _, column := range columns {
+		result = append(result, v2Column{ColumnName: column.Name, ColumnType: column.Type})
+	}
+	return result
+}
+
+// The frames of a v2 response. The SDK expects FrameType to be the first field of every frame.
+type dataSetHeader struct {
+	FrameType               string
+	IsProgressive           bool
+	Version                 string
+	IsFragmented            bool
+	ErrorReportingPlacement string
+}
+
+type dataTable struct {
+	FrameType string
+	TableId   int
+	TableKind string
+	TableName string
+	Columns   []v2Column
+	Rows      [][]any
+}
+
+type tableHeader struct {
+	FrameType string
+	TableId   int
+	TableKind string
+	TableName string
+	Columns   []v2Column
+}
+
+type tableFragment struct {
+	FrameType         string
+	TableFragmentType string
+	TableId           int
+	Rows              [][]any
+}
+
+type tableCompletion struct {
+	FrameType    string
+	TableId      int
+	RowCount     int
+	OneApiErrors []map[string]OneAPIError `json:",omitempty"`
+}
+
+type dataSetCompletion struct {
+	FrameType    string
+	HasErrors    bool
+	Cancelled    bool
+	OneApiErrors []map[string]OneAPIError `json:",omitempty"`
+}
+
+// writeV2 writes the result of a query in the fragmented v2 format the SDK asks for, one frame per line.
+// A partial error is reported at the end of the table, after the rows.
+func writeV2(w http.ResponseWriter, table Table, partial *OneAPIError) {
+	rows := table.Rows
+	if rows == nil {
+		rows = [][]any{}
+	}
+
+	var errors []map[string]OneAPIError
+	if partial != nil {
+		errors = []map[string]OneAPIError{{"error": *partial}}
+	}
+
+	frames := []any{
+		dataSetHeader{FrameType: "DataSetHeader", Version: "v2.0", IsFragmented: true, ErrorReportingPlacement: "EndOfTable"},
+		dataTable{
+			FrameType: "DataTable", TableId: 0, TableKind: "QueryProperties", TableName: "@ExtendedProperties",
+			Columns: v2Columns([]Column{{"TableId", "int"}, {"Key", "string"}, {"Value", "dynamic"}}),
+			Rows:    [][]any{},
+		},
+		tableHeader{FrameType: "TableHeader", TableId: 1, TableKind: "PrimaryResult", TableName: table.Name, Columns: v2Columns(table.Columns)},
+		tableFragment{FrameType: "TableFragment", TableFragmentType: "DataAppend", TableId: 1, Rows: rows},
+		tableCompletion{FrameType: "TableCompletion", TableId: 1, RowCount: len(rows), OneApiErrors: errors},
+		dataTable{
+			FrameType: "DataTable", TableId: 2, TableKind: "QueryCompletionInformation", TableName: "QueryCompletionInformation",
+			Columns: v2Columns([]Column{{"Timestamp", "datetime"}, {"ClientRequestId", "string"}, {"ActivityId", "guid"}, {"SubActivityId", "guid"}, {"ParentActivityId", "guid"}, {"Level", "int"}, {"LevelName", "string"}, {"StatusCode", "int"}, {"StatusCodeName", "string"}, {"EventType", "int"}, {"EventTypeName", "string"}, {"Payload", "string"}}),
+			Rows:    [][]any{},
+		},
+		dataSetCompletion{FrameType: "DataSetCompletion", HasErrors: partial != nil, OneApiErrors: errors},
+	}
+
+	lines := []string{}
+	for i, frame := range frames {
+		data, err := json.Marshal(frame)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, OneAPIError{Code: "InternalServiceError", Message: err.Error()})
+			return
+		}
+		prefix := ","
+		if i == 0 {
+			prefix = "["
+		}
+		lines = append(lines, prefix+string(data))
+	}
+	lines = append(lines, "]")
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strings.Join(lines, "\n") + "\n"))
+}
+
+// writeError writes a failed request with an error in the OneAPI format.
+func writeError(w http.ResponseWriter, statusCode int, e OneAPIError) {
+	writeJSON(w, statusCode, map[string]OneAPIError{"error": e})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	w.Write(data)
+}
@@ -0,0 +1,461 @@
+// Package kustotest provides a fake Kusto cluster for tests. It serves the REST endpoints the Kusto SDK
+// uses, answering control commands and simple queries from in-memory tables, so that the tools can be
+// tested without Azure access. Faults can be injected to test throttling, authentication failures,
+// partial query failures and slow queries.
+package kustotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The endpoints of the Kusto REST API served by the fake cluster.
+const (
+	MgmtPath     = "/v1/rest/mgmt"
+	QueryPath    = "/v2/rest/query"
+	metadataPath = "/v1/rest/auth/metadata"
+)
+
+// Column is a column of a table. Type is the KQL type, e.g. string, long or datetime.
+type Column struct {
+	Name string
+	Type string
+}
+
+// Table is an in-memory table. Rows hold JSON values in the format of the Kusto REST API,
+// e.g. strings for datetime and timespan values.
+type Table struct {
+	Name    string
+	Columns []Column
+	Rows    [][]any
+}
+
+// Function is a stored function. Parameters is the parameter list as returned by .show functions,
+// e.g. (state:string, limit:long), and Body includes the enclosing braces.
+type Function struct {
+	Name       string
+	Parameters string
+	Body       string
+	Folder     string
+	DocString  string
+}
+
+type database struct {
+	name      string
+	tables    []Table
+	functions []Function
+}
+
+// Request is a request received by the fake cluster.
+type Request struct {
+	// Endpoint is MgmtPath or QueryPath.
+	Endpoint string
+	Database string
+	CSL      string
+	// Parameters are the query parameters sent along with the query, by name.
+	Parameters map[string]string
+	// Authorization is the Authorization header of the request.
+	Authorization string
+}
+
+// Server is a fake Kusto cluster. Its URL can be used as the cluster of the tools.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	databases []*database
+	faults    []*Fault
+	requests  []Request
+}
+
+// NewServer starts a fake cluster without databases. Close it when done.
+func NewServer() *Server {
+	s := &Server{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(MgmtPath, s.handle)
+	mux.HandleFunc(QueryPath, s.handle)
+	// without metadata, the SDK uses the settings of the public cloud
+	mux.HandleFunc(metadataPath, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AddDatabase adds an empty database.
+func (s *Server) AddDatabase(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.database(name, true)
+}
+
+// AddTable adds a table to a database, adding the database if it does not exist yet.
+func (s *Server) AddTable(databaseName string, table Table) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db := s.database(databaseName, true)
+	db.tables = append(db.tables, table)
+}
+
+// AddFunction adds a stored function to a database, adding the database if it does not exist yet.
+func (s *Server) AddFunction(databaseName string, function Function) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db := s.database(databaseName, true)
+	db.functions = append(db.functions, function)
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.requests)
+}
+
+func (s *Server) database(name string, create bool) *database {
+	for _, db := range s.databases {
+		if strings.EqualFold(db.name, name) {
+			return db
+		}
+	}
+	if !create {
+		return nil
+	}
+	db := &database{name: name}
+	s.databases = append(s.databases, db)
+	return db
+}
+
+func (db *database) function(name string) (Function, bool) {
+	for _, function := range db.functions {
+		if function.Name == name {
+			return function, true
+		}
+	}
+	return Function{}, false
+}
+
+func (db *database) table(name string) (Table, bool) {
+	for _, table := range db.tables {
+		if table.Name == name {
+			return table, true
+		}
+	}
+	return Table{}, false
+}
+
+// queryMessage is the body of mgmt and query requests.
+type queryMessage struct {
+	DB         string `json:"db"`
+	CSL        string `json:"csl"`
+	Properties struct {
+		Parameters map[string]string `json:"Parameters"`
+	} `json:"properties"`
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var message queryMessage
+	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+		writeError(w, http.StatusBadRequest, OneAPIError{Code: "BadRequest_InvalidBody", Message: "Request is invalid and cannot be processed: " + err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Endpoint:      r.URL.Path,
+		Database:      message.DB,
+		CSL:           message.CSL,
+		Parameters:    message.Properties.Parameters,
+		Authorization: r.Header.Get("Authorization"),
+	})
+	fault := s.nextFault(r.URL.Path)
+	s.mu.Unlock()
+
+	if fault != nil && fault.Delay > 0 {
+		select {
+		case <-time.After(fault.Delay):
+		case <-r.Context().Done():
+			return
+		}
+		if fault.delayOnly() {
+			fault = nil
+		}
+	}
+
+	if fault != nil && fault.StatusCode != 0 {
+		if fault.RetryAfter != "" {
+			w.Header().Set("Retry-After", fault.RetryAfter)
+		}
+		writeError(w, fault.StatusCode, fault.Error)
+		return
+	}
+
+	if r.URL.Path == MgmtPath {
+		s.mgmt(w, message)
+		return
+	}
+
+	var partial *OneAPIError
+	if fault != nil {
+		partial = &fault.Error
+	}
+	s.query(w, message, partial)
+}
+
+// nextFault returns the fault for a request to the endpoint, if any.
+func (s *Server) nextFault(endpoint string) *Fault {
+	for i, fault := range s.faults {
+		if fault.Endpoint != "" && fault.Endpoint != endpoint {
+			continue
+		}
+		// partial failures only exist for queries
+		if fault.StatusCode == 0 && !fault.delayOnly() && endpoint != QueryPath {
+			continue
+		}
+
+		if fault.Count > 0 {
+			fault.Count--
+			if fault.Count == 0 {
+				s.faults = slices.Delete(s.faults, i, i+1)
+			}
+		}
+		return fault
+	}
+	return nil
+}
+
+var (
+	showTableSchemaPattern     = regexp.MustCompile(`(?i)^\.show\s+table\s+(\S+)\s+schema\s+as\s+json$`)
+	showFunctionPattern        = regexp.MustCompile(`(?i)^\.show\s+function\s+(\S+)$`)
+	showDatabaseSchemaPattern  = regexp.MustCompile(`(?i)^\.show\s+database\s+(\S+)\s+schema\s+as\s+json$`)
+	showDatabasesSchemaPattern = regexp.MustCompile(`(?i)^\.show\s+databases\s+\((.*)\)\s+schema\s+as\s+json$`)
+)
+
+// emptyListColumns are the columns of the listings of entities the fake cluster does not have.
+var emptyListColumns = map[string][]Column{
+	".show materialized-views": {{"Name", "string"}, {"SourceTable", "string"}, {"Query", "string"}, {"MaterializedTo", "datetime"}, {"LastRun", "datetime"}, {"LastRunResult", "string"}, {"IsHealthy", "bool"}, {"IsEnabled", "bool"}, {"Folder", "string"}, {"DocString", "string"}, {"AutoUpdateSchema", "bool"}, {"EffectiveDateTime", "datetime"}, {"Lookback", "timespan"}},
+	".show external tables":    {{"TableName", "string"}, {"TableType", "string"}, {"Folder", "string"}, {"DocString", "string"}, {"Properties", "string"}, {"ConnectionStrings", "dynamic"}, {"Partitions", "dynamic"}, {"PathFormat", "string"}},
+	".show entity_groups":      {{"Name", "string"}, {"Entities", "dynamic"}},
+}
+
+var functionColumns = []Column{{"Name", "string"}, {"Parameters", "string"}, {"Body", "string"}, {"Folder", "string"}, {"DocString", "string"}}
+
+// mgmt answers the control commands the tools use.
+func (s *Server) mgmt(w http.ResponseWriter, message queryMessage) {
+	command := strings.Join(strings.Fields(message.CSL), " ")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.EqualFold(command, ".show databases") {
+		table := Table{Columns: []Column{{"DatabaseName", "string"}, {"PersistentStorage", "string"}, {"Version", "string"}, {"IsCurrent", "bool"}, {"DatabaseAccessMode", "string"}, {"PrettyName", "string"}}}
+		for _, db := range s.databases {
+			table.Rows = append(table.Rows, []any{db.name, "", "v1.0", strings.EqualFold(db.name, message.DB), "ReadWrite", nil})
+		}
+		writeV1(w, table)
+		return
+	}
+
+	if match := showDatabasesSchemaPattern.FindStringSubmatch(command); match != nil {
+		dbs := []*database{}
+		for _, name := range strings.Split(match[1], ",") {
+			db := s.database(unquoteName(strings.TrimSpace(name)), false)
+			if db == nil {
+				writeError(w, http.StatusBadRequest, databaseNotFound(unquoteName(strings.TrimSpace(name))))
+				return
+			}
+			dbs = append(dbs, db)
+		}
+
+		schema, err := json.Marshal(databasesSchema(dbs))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, OneAPIError{Code: "InternalServiceError", Message: err.Error()})
+			return
+		}
+		writeV1(w, Table{Columns: []Column{{"DatabaseSchema", "string"}}, Rows: [][]any{{string(schema)}}})
+		return
+	}
+
+	db := s.database(message.DB, false)
+	if db == nil {
+		writeError(w, http.StatusBadRequest, databaseNotFound(message.DB))
+		return
+	}
+
+	if strings.EqualFold(command, ".show tables") {
+		table := Table{Columns: []Column{{"TableName", "string"}, {"DatabaseName", "string"}, {"Folder", "string"}, {"DocString", "string"}}}
+		for _, t := range db.tables {
+			table.Rows = append(table.Rows, []any{t.Name, db.name, "", ""})
+		}
+		writeV1(w, table)
+		return
+	}
+
+	// the fake cluster has no materialized views, external tables or entity groups
+	if columns, ok := emptyListColumns[strings.ToLower(command)]; ok {
+		writeV1(w, Table{Columns: columns})
+		return
+	}
+
+	if match := showTableSchemaPattern.FindStringSubmatch(command); match != nil {
+		t, ok := db.table(unquoteName(match[1]))
+		if !ok {
+			writeError(w, http.StatusBadRequest, entityNotFound(unquoteName(match[1]), "Table"))
+			return
+		}
+
+		schema, err := json.Marshal(tableSchema(t))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, OneAPIError{Code: "InternalServiceError", Message: err.Error()})
+			return
+		}
+		table := Table{
+			Columns: []Column{{"TableName", "string"}, {"Schema", "string"}, {"DatabaseName", "string"}, {"Folder", "string"}, {"DocString", "string"}},
+			Rows:    [][]any{{t.Name, string(schema), db.name, "", ""}},
+		}
+		writeV1(w, table)
+		return
+	}
+
+	if match := showDatabaseSchemaPattern.FindStringSubmatch(command); match != nil {
+		if !strings.EqualFold(unquoteName(match[1]), db.name) {
+			writeError(w, http.StatusBadRequest, databaseNotFound(unquoteName(match[1])))
+			return
+		}
+
+		schema, err := json.Marshal(databasesSchema([]*database{db}))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, OneAPIError{Code: "InternalServiceError", Message: err.Error()})
+			return
+		}
+		writeV1(w, Table{Columns: []Column{{"DatabaseSchema", "string"}}, Rows: [][]any{{string(schema)}}})
+		return
+	}
+
+	if strings.EqualFold(command, ".show functions") {
+		table := Table{Columns: functionColumns}
+		for _, f := range db.functions {
+			table.Rows = append(table.Rows, []any{f.Name, f.Parameters, f.Body, f.Folder, f.DocString})
+		}
+		writeV1(w, table)
+		return
+	}
+
+	if match := showFunctionPattern.FindStringSubmatch(command); match != nil {
+		f, ok := db.function(unquoteName(match[1]))
+		if !ok {
+			writeError(w, http.StatusBadRequest, entityNotFound(unquoteName(match[1]), "Function"))
+			return
+		}
+		writeV1(w, Table{Columns: functionColumns, Rows: [][]any{{f.Name, f.Parameters, f.Body, f.Folder, f.DocString}}})
+		return
+	}
+
+	writeError(w, http.StatusBadRequest, syntaxError(fmt.Sprintf("the fake cluster does not support the command %q", message.CSL)))
+}
+
+var (
+	takePattern  = regexp.MustCompile(`^(?:take|limit)\s+(\d+)$`)
+	countPattern = regexp.MustCompile(`^count$`)
+)
+
+// query answers queries of the form T, T | take N and T | count. Declarations of query parameters
+// and let statements before the query are skipped.
+func (s *Server) query(w http.ResponseWriter, message queryMessage, partial *OneAPIError) {
+	statement := ""
+	for _, part := range strings.Split(message.CSL, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" || strings.HasPrefix(part, "declare ") || strings.HasPrefix(part, "let ") {
+			continue
+		}
+		statement = part
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db := s.database(message.DB, false)
+	if db == nil {
+		writeError(w, http.StatusBadRequest, databaseNotFound(message.DB))
+		return
+	}
+
+	operators := strings.Split(statement, "|")
+	name := unquoteName(strings.TrimSpace(operators[0]))
+	table, ok := db.table(name)
+	if !ok {
+		writeError(w, http.StatusBadRequest, OneAPIError{
+			Code:        "General_BadRequest",
+			Message:     "Request is invalid and cannot be executed.",
+			Type:        "Kusto.Data.Exceptions.SemanticException",
+			Description: fmt.Sprintf("Semantic error: 'table' operator: Failed to resolve table or column expression named '%s'", name),
+		})
+		return
+	}
+	result := Table{Name: "PrimaryResult", Columns: table.Columns, Rows: table.Rows}
+
+	for _, operator := range operators[1:] {
+		operator = strings.Join(strings.Fields(operator), " ")
+		switch {
+		case takePattern.MatchString(operator):
+			n, _ := strconv.Atoi(takePattern.FindStringSubmatch(operator)[1])
+			result.Rows = result.Rows[:min(n, len(result.Rows))]
+		case countPattern.MatchString(operator):
+			result = Table{Name: "PrimaryResult", Columns: []Column{{"Count", "long"}}, Rows: [][]any{{len(result.Rows)}}}
+		default:
+			writeError(w, http.StatusBadRequest, syntaxError(fmt.Sprintf("the fake cluster does not support the operator %q", operator)))
+			return
+		}
+	}
+
+	writeV2(w, result, partial)
+}
+
+// unquoteName removes the brackets and quotes of a quoted name such as ['My Table'].
+func unquoteName(name string) string {
+	if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") && len(name) >= 4 {
+		return name[2 : len(name)-2]
+	}
+	return name
+}
+
+func databaseNotFound(name string) OneAPIError {
+	return entityNotFound(name, "Database")
+}
+
+func entityNotFound(name, kind string) OneAPIError {
+	return OneAPIError{
+		Code:        "General_BadRequest",
+		Message:     "Request is invalid and cannot be executed.",
+		Type:        "Kusto.Data.Exceptions.EntityNotFoundException",
+		Description: fmt.Sprintf("Entity ID '%s' of kind '%s' was not found.", name, kind),
+	}
+}
+
+func syntaxError(description string) OneAPIError {
+	return OneAPIError{
+		Code:        "General_BadRequest",
+		Message:     "Request is invalid and cannot be executed.",
+		Type:        "Kusto.Data.Exceptions.SyntaxException",
+		Description: "Syntax error: " + description,
+	}
+}
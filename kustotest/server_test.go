@@ -0,0 +1,214 @@
+package kustotest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	kustoerrors "github.com/Azure/azure-kusto-go/azkustodata/errors"
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+)
+
+func newTestServer(t *testing.T) (*Server, *azkustodata.Client) {
+	server := NewServer()
+	t.Cleanup(server.Close)
+
+	server.AddTable("Samples", Table{
+		Name:    "StormEvents",
+		Columns: []Column{{"State", "string"}, {"Injuries", "long"}, {"StartTime", "datetime"}},
+		Rows: [][]any{
+			{"TEXAS", 1, "2007-01-01T00:00:00Z"},
+			{"KANSAS", 0, "2007-01-02T00:00:00Z"},
+			{"IOWA", 3, "2007-01-03T00:00:00Z"},
+		},
+	})
+	server.AddDatabase("Empty")
+
+	client, err := azkustodata.New(azkustodata.NewConnectionStringBuilder(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return server, client
+}
+
+func TestShowCommands(t *testing.T) {
+	server, client := newTestServer(t)
+	ctx := context.Background()
+
+	dataset, err := client.Mgmt(ctx, "", kql.New(".show databases"))
+	if err != nil {
+		t.Fatalf("Mgmt failed: %v", err)
+	}
+	names := []string{}
+	for _, row := range dataset.Tables()[0].Rows() {
+		name, err := row.StringByName("DatabaseName")
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if strings.Join(names, ",") != "Samples,Empty" {
+		t.Fatalf("Unexpected databases: %v", names)
+	}
+
+	dataset, err = client.Mgmt(ctx, "Samples", kql.New(".show tables"))
+	if err != nil {
+		t.Fatalf("Mgmt failed: %v", err)
+	}
+	if name, _ := dataset.Tables()[0].Rows()[0].StringByName("TableName"); name != "StormEvents" {
+		t.Fatalf("Unexpected table %s", name)
+	}
+
+	dataset, err = client.Mgmt(ctx, "Samples", kql.New(".show table ").AddTable("StormEvents").AddLiteral(" schema as json"))
+	if err != nil {
+		t.Fatalf("Mgmt failed: %v", err)
+	}
+	schema, _ := dataset.Tables()[0].Rows()[0].StringByName("Schema")
+	expected := `{"Name":"StormEvents","OrderedColumns":[{"Name":"State","Type":"System.String","CslType":"string"},{"Name":"Injuries","Type":"System.Int64","CslType":"long"},{"Name":"StartTime","Type":"System.DateTime","CslType":"datetime"}]}`
+	if schema != expected {
+		t.Fatalf("Unexpected schema %s", schema)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 3 || requests[1].Endpoint != MgmtPath || requests[1].Database != "Samples" {
+		t.Fatalf("Unexpected requests: %+v", requests)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	_, client := newTestServer(t)
+	ctx := context.Background()
+
+	dataset, err := client.Query(ctx, "Samples", kql.New("StormEvents | take 2"))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	rows := dataset.Tables()[0].Rows()
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+	if state, _ := rows[1].StringByName("State"); state != "KANSAS" {
+		t.Fatalf("Unexpected row %v", rows[1])
+	}
+
+	dataset, err = client.Query(ctx, "Samples", kql.New("StormEvents | count"))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if count, _ := dataset.Tables()[0].Rows()[0].LongByName("Count"); count == nil || *count != 3 {
+		t.Fatalf("Expected a count of 3, got %v", count)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	_, client := newTestServer(t)
+	ctx := context.Background()
+
+	_, err := client.Query(ctx, "Samples", kql.New("Unknown | take 1"))
+	if err == nil || !strings.Contains(err.Error(), "Failed to resolve table or column expression named 'Unknown'") {
+		t.Fatalf("Expected a semantic error, got %v", err)
+	}
+
+	_, err = client.Query(ctx, "Missing", kql.New("StormEvents"))
+	if err == nil || !strings.Contains(err.Error(), "'Missing' of kind 'Database' was not found") {
+		t.Fatalf("Expected a database not found error, got %v", err)
+	}
+
+	_, err = client.Query(ctx, "Samples", kql.New("StormEvents | summarize count() by State"))
+	if err == nil || !strings.Contains(err.Error(), "Syntax error") {
+		t.Fatalf("Expected a syntax error for an unsupported query, got %v", err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	server, client := newTestServer(t)
+	ctx := context.Background()
+
+	server.InjectFault(Throttled(1, "2"))
+
+	_, err := client.Query(ctx, "Samples", kql.New("StormEvents"))
+	httpError, ok := err.(*kustoerrors.HttpError)
+	if !ok || httpError.StatusCode != 429 {
+		t.Fatalf("Expected a throttling error, got %v", err)
+	}
+	if _, err := client.Query(ctx, "Samples", kql.New("StormEvents")); err != nil {
+		t.Fatalf("Expected the fault to be used up, got %v", err)
+	}
+
+	server.InjectFault(PartialFailure())
+	if _, err := client.Mgmt(ctx, "Samples", kql.New(".show tables")); err != nil {
+		t.Fatalf("Expected partial failures to only apply to queries, got %v", err)
+	}
+	_, err = client.Query(ctx, "Samples", kql.New("StormEvents"))
+	if err == nil || !strings.Contains(err.Error(), "LimitsExceeded") {
+		t.Fatalf("Expected a partial failure, got %v", err)
+	}
+}
+
+func TestSlowQueries(t *testing.T) {
+	server, client := newTestServer(t)
+
+	server.InjectFault(Slow(time.Minute))
+	if _, err := client.Mgmt(context.Background(), "Samples", kql.New(".show tables")); err != nil {
+		t.Fatalf("Expected commands not to be delayed, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.Query(ctx, "Samples", kql.New("StormEvents")); err == nil {
+		t.Fatal("Expected the slow query to time out")
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatal("Expected the slow query to end with its context")
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	server, client := newTestServer(t)
+
+	server.InjectFault(Unauthorized())
+
+	for _, endpoint := range []string{MgmtPath, QueryPath} {
+		var err error
+		if endpoint == MgmtPath {
+			_, err = client.Mgmt(context.Background(), "Samples", kql.New(".show tables"))
+		} else {
+			_, err = client.Query(context.Background(), "Samples", kql.New("StormEvents"))
+		}
+		if httpError, ok := err.(*kustoerrors.HttpError); !ok || httpError.StatusCode != 401 {
+			t.Fatalf("Expected %s to fail with 401, got %v", endpoint, err)
+		}
+	}
+}
+
+func TestShowFunctions(t *testing.T) {
+	server, client := newTestServer(t)
+	server.AddFunction("Samples", Function{Name: "TopStates", Parameters: "(n:long)", Body: "{ StormEvents | take n }", Folder: "Reports"})
+	ctx := context.Background()
+
+	dataset, err := client.Mgmt(ctx, "Samples", kql.New(".show functions"))
+	if err != nil {
+		t.Fatalf("Mgmt failed: %v", err)
+	}
+	if rows := dataset.Tables()[0].Rows(); len(rows) != 1 {
+		t.Fatalf("Expected one function, got %d", len(rows))
+	}
+
+	dataset, err = client.Mgmt(ctx, "Samples", kql.New(".show function ").AddFunction("TopStates"))
+	if err != nil {
+		t.Fatalf("Mgmt failed: %v", err)
+	}
+	if body, _ := dataset.Tables()[0].Rows()[0].StringByName("Body"); body != "{ StormEvents | take n }" {
+		t.Fatalf("Unexpected body %s", body)
+	}
+
+	_, err = client.Mgmt(ctx, "Samples", kql.New(".show function ").AddFunction("Unknown"))
+	if err == nil || !strings.Contains(err.Error(), "'Unknown' of kind 'Function' was not found") {
+		t.Fatalf("Expected a function not found error, got %v", err)
+	}
+}
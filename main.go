@@ -1,28 +1,255 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/abhirockzz/mcp_kusto/common"
 	"github.com/abhirockzz/mcp_kusto/tools"
+	"github.com/abhirockzz/mcp_kusto/transport"
 
 	"github.com/mark3labs/mcp-go/server"
 )
 
 func main() {
 
+	configFile := flag.String("config", os.Getenv("KUSTO_MCP_CONFIG"), "Path to a YAML or JSON configuration file")
+	cluster := flag.String("cluster", "", "Default cluster used when a tool call does not specify one")
+	database := flag.String("database", "", "Default database used when a tool call does not specify one")
+	toolTimeout := flag.Duration("tool-timeout", 0, "Deadline for a tool call, e.g. 2m (defaults to 4m)")
+	maxResultRows := flag.Int("max-result-rows", 0, "Maximum number of rows per table returned by execute_query (defaults to 500)")
+	maxResultBytes := flag.Int("max-result-bytes", 0, "Maximum size of the rows returned by execute_query, in bytes (defaults to 65536)")
+	resultTTL := flag.Duration("result-ttl", 0, "How long truncated results are kept for fetch_results, e.g. 30m (defaults to 15m)")
+	schemaCacheTTL := flag.Duration("schema-cache-ttl", 0, "How long database lists, table lists and table schemas are cached, e.g. 1h (defaults to 5m, a negative value such as -1s disables the cache)")
+	warmSchemaCache := flag.Bool("warm-schema-cache", false, "Fetch the table lists and schemas of the configured databases at startup")
+
+	transportName := flag.String("transport", getenv("KUSTO_MCP_TRANSPORT", "stdio"), "Transport: stdio, sse or http (streamable HTTP)")
+	var httpConfig transport.HTTPConfig
+	flag.StringVar(&httpConfig.Addr, "listen", getenv("KUSTO_MCP_LISTEN", "localhost:8080"), "Listen address of the sse and http transports")
+	flag.StringVar(&httpConfig.CertFile, "tls-cert", os.Getenv("KUSTO_MCP_TLS_CERT"), "TLS certificate file of the sse and http transports")
+	flag.StringVar(&httpConfig.KeyFile, "tls-key", os.Getenv("KUSTO_MCP_TLS_KEY"), "TLS key file of the sse and http transports")
+	flag.DurationVar(&httpConfig.ShutdownTimeout, "shutdown-timeout", 0, "How long running requests may take to complete on shutdown (defaults to 30s)")
+
+	var inbound common.InboundAuthConfig
+	inboundMode := flag.String("inbound-auth", "", "How clients of the sse and http transports authenticate: none, jwt or api-key (API keys are read from the config file or KUSTO_MCP_API_KEYS)")
+	flag.StringVar(&inbound.TenantID, "inbound-tenant-id", "", "Accept Microsoft Entra ID tokens issued by this tenant")
+	flag.StringVar(&inbound.Audience, "audience", "", "Expected audience of client tokens")
+	flag.StringVar(&inbound.Issuer, "issuer", "", "Expected issuer of client tokens (defaults to the Entra ID issuers of --inbound-tenant-id)")
+	flag.StringVar(&inbound.JWKSURL, "jwks-url", "", "URL of the keys client tokens are signed with (defaults to the Entra ID keys of --inbound-tenant-id)")
+	restrictClusters := flag.Bool("restrict-clusters", false, "Only query the configured clusters, the default cluster and cluster aliases (defaults to on for the sse and http transports)")
+	flag.BoolVar(&inbound.OnBehalfOf, "on-behalf-of", false, "Query Kusto on behalf of the client, using its token and the client-secret or client-certificate credential of the server")
+
+	var auth common.AuthConfig
+	authMode := flag.String("auth", "", "Authentication mode: default, client-secret, client-certificate, managed-identity, azcli, workload-identity, device-code, token or none")
+	flag.StringVar(&auth.TenantID, "tenant-id", "", "Microsoft Entra tenant ID")
+	flag.StringVar(&auth.ClientID, "client-id", "", "Client ID of the service principal, workload identity or user-assigned managed identity")
+	flag.StringVar(&auth.CertificatePath, "certificate", "", "Path to the service principal certificate (PEM or PKCS#12)")
+	flag.StringVar(&auth.FederatedTokenFile, "federated-token-file", "", "Path to the federated token file used for workload identity")
+	flag.StringVar(&auth.TokenFile, "token-file", "", "Path to a file containing a pre-acquired bearer token")
+	flag.StringVar(&auth.TokenEnv, "token-env", "", "Environment variable containing a pre-acquired bearer token")
+	flag.Parse()
+
+	// settings from the config file are overridden by environment variables, which are overridden by flags
+	var config common.Config
+	if *configFile != "" {
+		var err error
+		config, err = common.LoadConfig(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := config.ApplyEnv(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "cluster":
+			config.DefaultCluster = *cluster
+		case "database":
+			config.DefaultDatabase = *database
+		case "tool-timeout":
+			config.ToolTimeout = *toolTimeout
+		case "max-result-rows":
+			config.MaxResultRows = *maxResultRows
+		case "max-result-bytes":
+			config.MaxResultBytes = *maxResultBytes
+		case "result-ttl":
+			config.ResultTTL = *resultTTL
+		case "schema-cache-ttl":
+			config.SchemaCacheTTL = *schemaCacheTTL
+		case "warm-schema-cache":
+			config.WarmSchemaCache = *warmSchemaCache
+		case "auth":
+			config.Auth.Mode = common.AuthMode(*authMode)
+		case "tenant-id":
+			config.Auth.TenantID = auth.TenantID
+		case "client-id":
+			config.Auth.ClientID = auth.ClientID
+		case "certificate":
+			config.Auth.CertificatePath = auth.CertificatePath
+		case "federated-token-file":
+			config.Auth.FederatedTokenFile = auth.FederatedTokenFile
+		case "token-file":
+			config.Auth.TokenFile = auth.TokenFile
+		case "token-env":
+			config.Auth.TokenEnv = auth.TokenEnv
+		case "inbound-auth":
+			config.InboundAuth.Mode = common.InboundAuthMode(*inboundMode)
+		case "inbound-tenant-id":
+			config.InboundAuth.TenantID = inbound.TenantID
+		case "audience":
+			config.InboundAuth.Audience = inbound.Audience
+		case "issuer":
+			config.InboundAuth.Issuer = inbound.Issuer
+		case "jwks-url":
+			config.InboundAuth.JWKSURL = inbound.JWKSURL
+		case "on-behalf-of":
+			config.InboundAuth.OnBehalfOf = inbound.OnBehalfOf
+		case "restrict-clusters":
+			config.RestrictClusters = restrictClusters
+		}
+	})
+
+	// remote callers must not be able to point the credential of the server at any host
+	if config.RestrictClusters == nil && *transportName != "stdio" {
+		restrict := true
+		config.RestrictClusters = &restrict
+	}
+
+	if *transportName != "stdio" && *transportName != "sse" && *transportName != "http" {
+		log.Fatalf("Invalid transport %q, expected stdio, sse or http", *transportName)
+	}
+	if err := httpConfig.Validate(); err != nil {
+		log.Fatalf("Invalid transport configuration: %v", err)
+	}
+
+	if err := common.SetConfig(config); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// stdio has a single, local client, which is trusted like the user that started the server
+	if *transportName == "stdio" && config.InboundAuth.Enabled() {
+		log.Fatal("Inbound authentication requires the sse or http transport")
+	}
+	authenticator, err := transport.NewAuthenticator(config.InboundAuth)
+	if err != nil {
+		log.Fatalf("Invalid inbound authentication: %v", err)
+	}
+	httpConfig.Auth = authenticator
+	httpConfig.Subscriber = tools.ResourceSubscriptions()
+	if *transportName != "stdio" && authenticator == nil {
+		fmt.Fprintln(os.Stderr, "Warning: clients are not authenticated. Anyone who can reach the server can query the clusters with its credential.")
+	}
+
+	if err := common.LoadClusterAliasesFromEnv(); err != nil {
+		log.Fatalf("Invalid cluster aliases: %v", err)
+	}
+
+	go checkAuth()
+
+	defer common.CloseClients()
+
 	s := server.NewMCPServer(
 		"Kusto MCP server",
 		"0.0.5",
 		server.WithLogging(),
+		// resources/updated is sent when the schema cache sees a subscribed resource change
+		server.WithResourceCapabilities(true, false),
 	)
 
-	s.AddTool(tools.ListDatabases())
-	s.AddTool(tools.ListTables())
-	s.AddTool(tools.GetTableSchema())
-	s.AddTool(tools.ExecuteQuery())
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.ListDatabases(common.PooledClients)))))
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.ListTables(common.PooledClients)))))
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.ListEntities(common.PooledClients)))))
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.GetTableSchema(common.PooledClients)))))
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.GetDatabaseSchema(common.PooledClients)))))
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.SearchSchema(common.PooledClients)))))
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.SampleTable(common.PooledClients)))))
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.ProfileTable(common.PooledClients)))))
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.ListFunctions(common.PooledClients)))))
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.GetFunction(common.PooledClients)))))
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.ValidateQuery(common.PooledClients)))))
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.ExecuteQuery(common.PooledClients)))))
+	s.AddTool(tools.WithAttemptCount(tools.WithErrorResult(tools.WithTimeout(tools.FetchResults()))))
+
+	s.AddResourceTemplate(tools.DatabaseResource(common.PooledClients))
+	s.AddResourceTemplate(tools.TableSchemaResource(common.PooledClients))
+	s.AddResourceTemplate(tools.FunctionResource(common.PooledClients))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if config.WarmSchemaCache {
+		go warmUpSchemaCache(ctx)
+	}
+
+	switch *transportName {
+	case "sse":
+		fmt.Fprintf(os.Stderr, "Serving MCP over SSE at %s%s\n", baseURL(httpConfig), transport.SSEPath)
+		err = transport.ServeSSE(ctx, s, httpConfig)
+	case "http":
+		fmt.Fprintf(os.Stderr, "Serving MCP over streamable HTTP at %s%s\n", baseURL(httpConfig), transport.StreamablePath)
+		err = transport.ServeStreamableHTTP(ctx, s, httpConfig)
+	default:
+		err = transport.ServeStdio(ctx, s, tools.ResourceSubscriptions())
+	}
+	if err != nil && (ctx.Err() == nil || *transportName != "stdio") {
+		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
+	}
+}
+
+func getenv(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func baseURL(config transport.HTTPConfig) string {
+	if config.TLS() {
+		return "https://" + config.Addr
+	}
+	return "http://" + config.Addr
+}
+
+// checkAuth reports a credential problem at startup instead of on the first tool call. The default cluster and
+// every configured cluster are checked with their own credential settings.
+// Diagnostics go to stderr since stdout carries the MCP protocol.
+func checkAuth() {
+	clusters := common.KnownClusters()
+	if len(clusters) == 0 {
+		// the clusters are only named in tool calls, so only the credential of the server can be checked
+		clusters = []common.Cluster{{Auth: common.DefaultAuth()}}
+	}
+
+	for _, cluster := range clusters {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := common.CheckAuth(ctx, cluster)
+		cancel()
+		if err == nil {
+			continue
+		}
+		if cluster.Name == "" {
+			fmt.Fprintf(os.Stderr, "Warning: could not acquire a token using auth mode %s. Tool calls will fail until this is fixed.\n%v\n", cluster.Auth.Describe(), err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Warning: could not acquire a token for cluster %s (%s) using auth mode %s. Tool calls to the cluster will fail until this is fixed.\n%v\n", cluster.Name, cluster.Endpoint, cluster.Auth.Describe(), err)
+	}
+}
+
+// warmUpSchemaCache fetches the schemas of the configured databases in the background, so that the first
+// tool calls are answered from the schema cache. Problems are reported on stderr and do not stop the server.
+func warmUpSchemaCache(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
 
-	// Start the stdio server
-	if err := server.ServeStdio(s); err != nil {
-		fmt.Printf("Server error: %v\n", err)
+	if err := tools.WarmSchemaCache(ctx, common.PooledClients); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not warm up the schema cache.\n%v\n", err)
 	}
 }
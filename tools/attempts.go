@@ -0,0 +1,27 @@
+package tools
+
+import (
+	"context"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// WithAttemptCount reports the number of requests sent to Kusto for a tool call, including retries,
+// in the attempts field of the metadata of the result. It wraps the tool constructors like WithTimeout.
+func WithAttemptCount(tool mcp.Tool, handler server.ToolHandlerFunc) (mcp.Tool, server.ToolHandlerFunc) {
+
+	return tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, stats := common.WithCallStats(ctx)
+
+		result, err := handler(ctx, request)
+		if result != nil && stats.Attempts() > 0 {
+			if result.Meta == nil {
+				result.Meta = map[string]any{}
+			}
+			result.Meta["attempts"] = stats.Attempts()
+		}
+		return result, err
+	}
+}
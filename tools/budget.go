@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// minRowsBeforeDroppingColumns is the number of rows a table should keep within the byte budget.
+// Wide columns are dropped, widest first, until that many rows fit.
+const minRowsBeforeDroppingColumns = 10
+
+// TableTruncation describes how a result table was cut down to fit the result budget.
+type TableTruncation struct {
+	TotalRows int `json:"totalRows"`
+	// Offset is the index of the first returned row, for the later pages of a result.
+	Offset         int      `json:"offset,omitempty"`
+	ReturnedRows   int      `json:"returnedRows"`
+	DroppedColumns []string `json:"droppedColumns,omitempty"`
+}
+
+// applyBudget truncates the result tables to at most maxRows rows per table and about maxBytes of
+// JSON overall. Truncated tables get a Truncation describing what was left out. It reports whether
+// anything was truncated.
+func applyBudget(tables []ResultTable, maxRows, maxBytes int) bool {
+	truncated := false
+	remaining := maxBytes
+
+	for i := range tables {
+		table := &tables[i]
+		total := len(table.Rows)
+
+		if len(table.Rows) > maxRows {
+			table.Rows = table.Rows[:maxRows]
+		}
+
+		dropped := []string{}
+		fit, size := rowsWithin(table.Rows, remaining)
+		for remaining > 0 && fit < min(len(table.Rows), minRowsBeforeDroppingColumns) && len(table.Columns) > 1 {
+			dropped = append(dropped, dropWidestColumn(table))
+			fit, size = rowsWithin(table.Rows, remaining)
+		}
+		table.Rows = table.Rows[:fit]
+		remaining -= size
+
+		if len(table.Rows) < total || len(dropped) > 0 {
+			table.Truncation = &TableTruncation{TotalRows: total, ReturnedRows: len(table.Rows)}
+			if len(dropped) > 0 {
+				table.Truncation.DroppedColumns = dropped
+			}
+			truncated = true
+		}
+	}
+	return truncated
+}
+
+// rowsWithin returns how many of the rows fit in maxBytes of JSON and their size.
+func rowsWithin(rows [][]any, maxBytes int) (int, int) {
+	size := 0
+	for i, row := range rows {
+		rowSize := 2 // brackets
+		for _, v := range row {
+			rowSize += valueSize(v) + 1
+		}
+		if size+rowSize > maxBytes {
+			return i, size
+		}
+		size += rowSize
+	}
+	return len(rows), size
+}
+
+// dropWidestColumn removes the column with the most data in the first rows of the table and returns its name.
+func dropWidestColumn(table *ResultTable) string {
+	widest, widestSize := 0, -1
+	for column := range table.Columns {
+		size := 0
+		for _, row := range table.Rows[:min(len(table.Rows), minRowsBeforeDroppingColumns)] {
+			size += valueSize(row[column])
+		}
+		if size > widestSize {
+			widest, widestSize = column, size
+		}
+	}
+
+	name := table.Columns[widest].Name
+	table.Columns = append(table.Columns[:widest:widest], table.Columns[widest+1:]...)
+	for i, row := range table.Rows {
+		table.Rows[i] = append(row[:widest:widest], row[widest+1:]...)
+	}
+	return name
+}
+
+func valueSize(v any) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return len(textValue(v))
+	}
+	return len(data)
+}
+
+// suggestReducedQuery suggests a query that returns a result within the budget, by appending
+// a project of the remaining columns and a take of the returned rows to the query.
+// It returns an empty string for queries with several result tables.
+func suggestReducedQuery(query string, tables []ResultTable) string {
+	if len(tables) != 1 || tables[0].Truncation == nil {
+		return ""
+	}
+	table := tables[0]
+
+	tokens, err := tokenizeKQL(query)
+	if err != nil || len(tokens) == 0 {
+		return ""
+	}
+
+	// trailing comments and semicolons would swallow or separate the appended operators
+	for len(tokens) > 0 && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return ""
+	}
+	last := tokens[len(tokens)-1]
+	suggestion := query[:last.offset+len(last.text)]
+
+	if len(table.Truncation.DroppedColumns) > 0 {
+		columns := make([]string, 0, len(table.Columns))
+		for _, column := range table.Columns {
+			columns = append(columns, quoteIdentifier(column.Name))
+		}
+		suggestion += "\n| project " + strings.Join(columns, ", ")
+	}
+	if table.Truncation.ReturnedRows < table.Truncation.TotalRows {
+		suggestion += fmt.Sprintf("\n| take %d", max(table.Truncation.ReturnedRows, 1))
+	}
+	return suggestion
+}
+
+// quoteIdentifier quotes a table or column name. Names are always quoted, as plain identifiers can still be
+// KQL keywords (e.g. where, project or by), which are not valid as bare names.
+func quoteIdentifier(name string) string {
+	return "[" + quoteString(name) + "]"
+}
+
+// quoteString returns a KQL string literal.
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, "\\", "\\\\"), "'", "\\'") + "'"
+}
+
+// truncationNote summarizes the truncation for the csv and markdown formats.
+func truncationNote(response QueryResponse) string {
+	notes := []string{}
+	for _, table := range response.Tables {
+		if table.Truncation == nil {
+			continue
+		}
+		note := fmt.Sprintf("Result truncated: table %s has %d rows, %d returned", table.Name, table.Truncation.TotalRows, table.Truncation.ReturnedRows)
+		if table.Truncation.Offset > 0 {
+			note += fmt.Sprintf(" starting at row %d", table.Truncation.Offset)
+		}
+		note += "."
+		if len(table.Truncation.DroppedColumns) > 0 {
+			note += " Dropped columns: " + strings.Join(table.Truncation.DroppedColumns, ", ") + "."
+		}
+		notes = append(notes, note)
+	}
+	if response.Cursor != "" {
+		notes = append(notes, "More rows are available, call fetch_results with cursor: "+response.Cursor)
+	}
+	if response.SuggestedQuery != "" {
+		notes = append(notes, "Suggested query:\n"+response.SuggestedQuery)
+	}
+	return strings.Join(notes, "\n")
+}
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func testBudgetTable(rows int) ResultTable {
+	table := ResultTable{
+		Name:    "PrimaryResult",
+		Columns: []ResultColumn{{Name: "Id", Type: "long"}, {Name: "Body", Type: "string"}, {Name: "Event Type", Type: "string"}},
+		Rows:    [][]any{},
+	}
+	for i := 0; i < rows; i++ {
+		table.Rows = append(table.Rows, []any{int64(i), strings.Repeat("x", 1000), "Hail"})
+	}
+	return table
+}
+
+func TestApplyBudgetWithinBudget(t *testing.T) {
+	tables := []ResultTable{testBudgetTable(5)}
+
+	if applyBudget(tables, 10, 100000) {
+		t.Fatal("Expected result within budget not to be truncated")
+	}
+	if tables[0].Truncation != nil || len(tables[0].Rows) != 5 {
+		t.Fatalf("Unexpected table: %+v", tables[0].Truncation)
+	}
+}
+
+func TestApplyBudgetRows(t *testing.T) {
+	tables := []ResultTable{testBudgetTable(100)}
+
+	if !applyBudget(tables, 20, 1000000) {
+		t.Fatal("Expected result to be truncated")
+	}
+
+	truncation := tables[0].Truncation
+	if truncation == nil || truncation.TotalRows != 100 || truncation.ReturnedRows != 20 || len(truncation.DroppedColumns) != 0 {
+		t.Fatalf("Unexpected truncation: %+v", truncation)
+	}
+
+	expected := "T | where x > 1\n| take 20"
+	if suggestion := suggestReducedQuery("T | where x > 1; // all rows", tables); suggestion != expected {
+		t.Fatalf("Expected suggested query %q, got %q", expected, suggestion)
+	}
+}
+
+func TestApplyBudgetDropsWideColumns(t *testing.T) {
+	tables := []ResultTable{testBudgetTable(500)}
+
+	if !applyBudget(tables, 1000, 2000) {
+		t.Fatal("Expected result to be truncated")
+	}
+
+	truncation := tables[0].Truncation
+	if truncation == nil || fmt.Sprint(truncation.DroppedColumns) != "[Body]" || truncation.ReturnedRows < minRowsBeforeDroppingColumns || truncation.ReturnedRows == 500 {
+		t.Fatalf("Unexpected truncation: %+v", truncation)
+	}
+	for _, row := range tables[0].Rows {
+		if len(row) != 2 {
+			t.Fatalf("Expected dropped column to be removed from rows, got %v", row)
+		}
+	}
+
+	suggestion := suggestReducedQuery("T", tables)
+	expected := fmt.Sprintf("T\n| project ['Id'], ['Event Type']\n| take %d", truncation.ReturnedRows)
+	if suggestion != expected {
+		t.Fatalf("Expected suggested query %q, got %q", expected, suggestion)
+	}
+}
+
+func TestApplyBudgetSharedAcrossTables(t *testing.T) {
+	tables := []ResultTable{testBudgetTable(3), testBudgetTable(3)}
+
+	if !applyBudget(tables, 1000, 4000) {
+		t.Fatal("Expected result to be truncated")
+	}
+	if tables[0].Truncation != nil {
+		t.Fatalf("Expected first table to fit, got %+v", tables[0].Truncation)
+	}
+	if tables[1].Truncation == nil {
+		t.Fatal("Expected second table to be truncated")
+	}
+	if suggestReducedQuery("T; T", tables) != "" {
+		t.Fatal("Expected no suggested query for several tables")
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	// keywords are valid column names, but not as bare names
+	for name, expected := range map[string]string{
+		"where":      "['where']",
+		"project":    "['project']",
+		"by":         "['by']",
+		"on":         "['on']",
+		"State":      "['State']",
+		"Event Type": "['Event Type']",
+		`it's\`:      `['it\'s\\']`,
+	} {
+		if quoted := quoteIdentifier(name); quoted != expected {
+			t.Fatalf("Expected %s to be quoted as %s, got %s", name, expected, quoted)
+		}
+	}
+}
+
+func TestFormatResultsTruncationNote(t *testing.T) {
+	tables := []ResultTable{testBudgetTable(100)}
+	applyBudget(tables, 5, 1000000)
+	response := QueryResponse{Tables: tables, Truncated: true, SuggestedQuery: suggestReducedQuery("T", tables)}
+
+	result, err := formatResults(response, formatMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result, "Result truncated: table PrimaryResult has 100 rows, 5 returned.") || !strings.HasSuffix(result, "Suggested query:\nT\n| take 5\n") {
+		t.Fatalf("Expected truncation note, got %q", result)
+	}
+
+	result, err = formatResults(response, formatColumnsRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result, `"truncation":{"totalRows":100,"returnedRows":5}`) || !strings.Contains(result, `"truncated":true`) {
+		t.Fatalf("Expected truncation metadata, got %s", result)
+	}
+}
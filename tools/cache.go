@@ -0,0 +1,236 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxWarmTables limits the schemas fetched per database when the cache is warmed up, as every schema is a command.
+const maxWarmTables = 100
+
+// refreshParameterDescription describes the refresh argument of the tools that use the schema cache.
+const refreshParameterDescription = "Fetch the result from the cluster instead of the schema cache, e.g. after a table was created or changed. Results from the cache say how old they are."
+
+// schemaCache keeps database lists, table lists and table schemas, which rarely change within a session.
+// Entries expire after the schema cache TTL of their cluster.
+type schemaCache struct {
+	mu      sync.Mutex
+	entries map[string]schemaEntry
+	now     func() time.Time
+}
+
+type schemaEntry struct {
+	value   any
+	fetched time.Time
+	expires time.Time
+	// resource is the resource the entry holds, if any. Expired entries of subscribed resources are kept,
+	// so that a change can still be detected when they are fetched again.
+	resource resourceRef
+}
+
+// schemas is the cache shared by list_databases, list_tables and get_table_schema.
+var schemas = &schemaCache{entries: map[string]schemaEntry{}, now: time.Now}
+
+func (c *schemaCache) get(key string) (schemaEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !c.now().Before(entry.expires) {
+		return schemaEntry{}, false
+	}
+	return entry, true
+}
+
+// put caches the value and drops the entries that expired. It returns the value previously cached under the key,
+// even if it expired.
+func (c *schemaCache) put(key string, value any, ttl time.Duration, resource resourceRef) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, ok := c.entries[key]
+
+	now := c.now()
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) && (entry.resource.path == "" || !subscriptions.watched(entry.resource)) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = schemaEntry{value: value, fetched: now, expires: now.Add(ttl), resource: resource}
+	return previous.value, ok
+}
+
+func (c *schemaCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]schemaEntry{}
+}
+
+// cached returns the value cached under the key for the cluster, or fetches and caches it if it is not cached,
+// has expired or refresh is set. The age of a cached value is returned, e.g. 4m30s, or "" if it was just fetched.
+// Errors are not cached. When a fetched table list, table schema or function differs from the value cached
+// before, the sessions subscribed to its resource are notified.
+func cached[T any](ctx context.Context, cluster common.Cluster, key string, refresh bool, fetch func() (T, error)) (T, string, error) {
+	ttl := common.GetConfig().SchemaCacheTTLFor(cluster)
+	if ttl == 0 {
+		value, err := fetch()
+		return value, "", err
+	}
+
+	resource := resourceRef{endpoint: cluster.Endpoint, path: resourcePath(key)}
+	key = cluster.Endpoint + "\n" + key
+	// with on-behalf-of, callers may see different databases and tables, so each caller has their own entries
+	if common.GetConfig().InboundAuth.OnBehalfOf {
+		caller, _ := common.CallerFromContext(ctx)
+		key = caller.ID + "\n" + key
+	}
+
+	if !refresh {
+		if entry, ok := schemas.get(key); ok {
+			if value, ok := entry.value.(T); ok {
+				return value, schemas.now().Sub(entry.fetched).Round(time.Second).String(), nil
+			}
+		}
+	}
+
+	value, err := fetch()
+	if err != nil {
+		return value, "", err
+	}
+	if previous, ok := schemas.put(key, value, ttl, resource); ok && resource.path != "" && !reflect.DeepEqual(previous, value) {
+		notifyResourceUpdated(ctx, resource)
+	}
+	return value, "", nil
+}
+
+// resourcePath returns the path of the resource that holds the value of a cache key, e.g.
+// /Samples/tables/StormEvents/schema, or "" if no resource does.
+func resourcePath(key string) string {
+	parts := strings.Split(key, "\n")
+	switch {
+	case parts[0] == "tables" && len(parts) == 2:
+		return "/" + parts[1]
+	case parts[0] == "schema" && len(parts) == 4 && parts[2] == kindTable:
+		return "/" + parts[1] + "/tables/" + parts[3] + "/schema"
+	case parts[0] == "function" && len(parts) == 3:
+		return "/" + parts[1] + "/functions/" + parts[2]
+	}
+	return ""
+}
+
+// refreshArgument reports whether a tool call asks to bypass the schema cache.
+func refreshArgument(request mcp.CallToolRequest) bool {
+	refresh, _ := request.GetArguments()["refresh"].(bool)
+	return refresh
+}
+
+// cachedDatabases returns the databases of the cluster that the configuration allows.
+func cachedDatabases(ctx context.Context, client common.KustoClient, cluster common.Cluster, refresh bool) ([]string, string, error) {
+	return cached(ctx, cluster, "databases", refresh, func() ([]string, error) {
+		return showDatabases(ctx, client, cluster)
+	})
+}
+
+// cachedTables returns the tables of the database.
+func cachedTables(ctx context.Context, client common.KustoClient, cluster common.Cluster, dbName string, refresh bool) ([]string, string, error) {
+	return cached(ctx, cluster, "tables\n"+dbName, refresh, func() ([]string, error) {
+		return showTables(ctx, client, dbName)
+	})
+}
+
+// cachedSchema returns the schema of a table, materialized view or external table as JSON.
+func cachedSchema(ctx context.Context, client common.KustoClient, cluster common.Cluster, dbName, table, kind string, refresh bool) (string, string, error) {
+	return cached(ctx, cluster, strings.Join([]string{"schema", dbName, kind, table}, "\n"), refresh, func() (string, error) {
+		return showSchema(ctx, client, dbName, table, kind)
+	})
+}
+
+// cachedFunction returns the definition of a stored function. It is always fetched, as get_function returns the
+// current definition, and only cached to tell whether it changed since the last fetch.
+func cachedFunction(ctx context.Context, client common.KustoClient, cluster common.Cluster, dbName, name string) (FunctionResponse, error) {
+	function, _, err := cached(ctx, cluster, strings.Join([]string{"function", dbName, name}, "\n"), true, func() (FunctionResponse, error) {
+		return showFunction(ctx, client, dbName, name)
+	})
+	return function, err
+}
+
+// WarmSchemaCache fetches the databases of the configured clusters, and the tables and table schemas of their
+// default and allowed databases, so that the first tool calls are answered from the cache. It returns the
+// errors of all clusters and databases that could not be fetched.
+func WarmSchemaCache(ctx context.Context, clients common.ClientFactory) error {
+	config := common.GetConfig()
+	if config.InboundAuth.OnBehalfOf {
+		return errors.New("the schema cache is not warmed up with on-behalf-of, as every caller has their own entries")
+	}
+
+	names := []string{}
+	for _, cluster := range config.Clusters {
+		names = append(names, cluster.Name)
+	}
+	if config.DefaultCluster != "" {
+		if cluster, err := common.ResolveCluster(config.DefaultCluster); err == nil && cluster.Config == nil {
+			names = append(names, config.DefaultCluster)
+		}
+	}
+
+	errs := []error{}
+	for _, name := range names {
+		if err := warmCluster(ctx, clients, name); err != nil {
+			errs = append(errs, fmt.Errorf("cluster %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func warmCluster(ctx context.Context, clients common.ClientFactory, name string) error {
+	cluster, err := common.ResolveCluster(name)
+	if err != nil {
+		return err
+	}
+	if common.GetConfig().SchemaCacheTTLFor(cluster) == 0 {
+		return nil
+	}
+
+	client, err := clients(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if _, _, err := cachedDatabases(ctx, client, cluster, false); err != nil {
+		return err
+	}
+
+	databases := []string{}
+	if cluster.Config != nil {
+		databases = append(databases, cluster.Config.AllowedDatabases...)
+	}
+	if dbName, err := cluster.ResolveDatabase(""); err == nil && !slices.ContainsFunc(databases, func(db string) bool { return strings.EqualFold(db, dbName) }) {
+		databases = append(databases, dbName)
+	}
+
+	errs := []error{}
+	for _, dbName := range databases {
+		tables, _, err := cachedTables(ctx, client, cluster, dbName, false)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("database %s: %w", dbName, err))
+			continue
+		}
+		for _, table := range tables[:min(len(tables), maxWarmTables)] {
+			if _, _, err := cachedSchema(ctx, client, cluster, dbName, table, kindTable, false); err != nil {
+				errs = append(errs, fmt.Errorf("table %s.%s: %w", dbName, table, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,155 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const cachedSchemaJSON = `{"Name":"StormEvents","OrderedColumns":[{"Name":"State","Type":"System.String","CslType":"string"}]}`
+
+func schemaClient() *fakeClient {
+	return &fakeClient{mgmt: map[string]fakeTable{
+		".show databases":                        {columns: []string{"DatabaseName"}, rows: [][]any{{"Samples"}, {"Logs"}}},
+		".show tables":                           {columns: []string{"TableName", "DatabaseName"}, rows: [][]any{{"StormEvents", "Samples"}}},
+		".show table StormEvents schema as json": {columns: []string{"TableName", "Schema"}, rows: [][]any{{"StormEvents", cachedSchemaJSON}}},
+	}}
+}
+
+// fakeClock makes the schema cache use a clock that the test advances.
+func fakeClock(t *testing.T) *time.Time {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	schemas.now = func() time.Time { return now }
+	t.Cleanup(func() { schemas.now = time.Now })
+	return &now
+}
+
+func TestSchemaCache(t *testing.T) {
+	resetSchemaCache(t)
+	now := fakeClock(t)
+	client := schemaClient()
+
+	listTables := func(arguments map[string]any) ListTablesResponse {
+		t.Helper()
+		result, err := listTablesHandler(client.factory)(context.Background(), fakeRequest("list_tables", arguments))
+		var response ListTablesResponse
+		if err := json.Unmarshal([]byte(resultText(t, result, err)), &response); err != nil {
+			t.Fatalf("Failed to unmarshal content: %v", err)
+		}
+		return response
+	}
+	arguments := map[string]any{"cluster": "fake", "database": "Samples"}
+
+	if response := listTables(arguments); response.CacheAge != "" || len(client.commands) != 1 {
+		t.Fatalf("Expected the tables to be fetched, got %+v after %v", response, client.commands)
+	}
+
+	*now = now.Add(90 * time.Second)
+	if response := listTables(arguments); response.CacheAge != "1m30s" || len(client.commands) != 1 || response.Tables[0] != "StormEvents" {
+		t.Fatalf("Expected the tables from the cache, got %+v after %v", response, client.commands)
+	}
+
+	// refresh bypasses the cache and replaces the entry
+	if response := listTables(map[string]any{"cluster": "fake", "database": "Samples", "refresh": true}); response.CacheAge != "" || len(client.commands) != 2 {
+		t.Fatalf("Expected refresh to fetch the tables, got %+v after %v", response, client.commands)
+	}
+	if response := listTables(arguments); response.CacheAge != "0s" || len(client.commands) != 2 {
+		t.Fatalf("Expected the refreshed tables from the cache, got %+v after %v", response, client.commands)
+	}
+
+	// entries expire after the TTL, and databases have their own entries
+	*now = now.Add(5 * time.Minute)
+	if response := listTables(arguments); response.CacheAge != "" || len(client.commands) != 3 {
+		t.Fatalf("Expected the expired tables to be fetched, got %+v after %v", response, client.commands)
+	}
+	listTables(map[string]any{"cluster": "fake", "database": "Logs"})
+	if len(client.commands) != 4 {
+		t.Fatalf("Expected the tables of another database to be fetched, got %v", client.commands)
+	}
+}
+
+func TestGetSchemaFromCache(t *testing.T) {
+	resetSchemaCache(t)
+	fakeClock(t)
+	client := schemaClient()
+
+	request := fakeRequest("get_table_schema", map[string]any{"cluster": "fake", "database": "Samples", "table": "StormEvents"})
+	for i := 0; i < 2; i++ {
+		result, err := getSchemaHandler(client.factory)(context.Background(), request)
+		if text := resultText(t, result, err); text != cachedSchemaJSON {
+			t.Fatalf("Expected the schema, got %s", text)
+		}
+		if i == 1 && (len(result.Content) != 2 || !strings.Contains(result.Content[1].(mcp.TextContent).Text, "0s old")) {
+			t.Fatalf("Expected a note about the age of the cached schema, got %+v", result.Content)
+		}
+	}
+	if len(client.commands) != 1 {
+		t.Fatalf("Expected the schema to be fetched once, got %v", client.commands)
+	}
+}
+
+func TestSchemaCacheDisabled(t *testing.T) {
+	resetSchemaCache(t)
+	err := common.SetConfig(common.Config{Clusters: []common.ClusterConfig{
+		{Name: "fake", Endpoint: "https://fake.kusto.windows.net", SchemaCacheTTL: -1},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer common.SetConfig(common.Config{})
+
+	client := schemaClient()
+	for i := 0; i < 2; i++ {
+		result, err := listDatabasesHandler(client.factory)(context.Background(), fakeRequest("list_databases", map[string]any{"cluster": "fake"}))
+		if text := resultText(t, result, err); strings.Contains(text, "cacheAge") {
+			t.Fatalf("Expected no cache age, got %s", text)
+		}
+	}
+	if len(client.commands) != 2 {
+		t.Fatalf("Expected every call to fetch the databases, got %v", client.commands)
+	}
+}
+
+func TestWarmSchemaCache(t *testing.T) {
+	resetSchemaCache(t)
+	err := common.SetConfig(common.Config{Clusters: []common.ClusterConfig{
+		{Name: "fake", Endpoint: "https://fake.kusto.windows.net", DefaultDatabase: "Samples", AllowedDatabases: []string{"Samples"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer common.SetConfig(common.Config{})
+
+	if err := WarmSchemaCache(context.Background(), schemaClient().factory); err != nil {
+		t.Fatalf("WarmSchemaCache failed: %v", err)
+	}
+
+	// the tools answer from the cache without sending any command
+	client := &fakeClient{}
+	for _, call := range []struct {
+		handler   server.ToolHandlerFunc
+		arguments map[string]any
+	}{
+		{listDatabasesHandler(client.factory), map[string]any{"cluster": "fake"}},
+		{listTablesHandler(client.factory), map[string]any{"cluster": "fake"}},
+		{getSchemaHandler(client.factory), map[string]any{"cluster": "fake", "table": "StormEvents"}},
+	} {
+		result, err := call.handler(context.Background(), fakeRequest("", call.arguments))
+		resultText(t, result, err)
+	}
+	if len(client.commands) != 0 {
+		t.Fatalf("Expected the warmed up cache to answer, got commands %v", client.commands)
+	}
+
+	// errors are reported per cluster
+	resetSchemaCache(t)
+	if err := WarmSchemaCache(context.Background(), (&fakeClient{}).factory); err == nil || !strings.Contains(err.Error(), "cluster fake") {
+		t.Fatalf("Expected the error of the cluster, got %v", err)
+	}
+}
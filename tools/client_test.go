@@ -0,0 +1,281 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	kustoerrors "github.com/Azure/azure-kusto-go/azkustodata/errors"
+	"github.com/Azure/azure-kusto-go/azkustodata/query"
+	v1 "github.com/Azure/azure-kusto-go/azkustodata/query/v1"
+	"github.com/Azure/azure-kusto-go/azkustodata/types"
+	"github.com/Azure/azure-kusto-go/azkustodata/value"
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// fakeClient is a KustoClient that answers from canned results, for testing the tools without a cluster.
+type fakeClient struct {
+	// mgmt maps control commands to the columns and rows they return, with string columns unless types are given
+	mgmt map[string]fakeTable
+	// mgmtErrs maps control commands to the errors they fail with
+	mgmtErrs map[string]error
+	// query is the result of every query, unless results holds several result tables
+	query   fakeTable
+	results []fakeTable
+	// queryErr fails every query, if set
+	queryErr error
+
+	commands []string
+	queries  []string
+	closed   int
+}
+
+type fakeTable struct {
+	columns []string
+	types   []types.Column
+	rows    [][]any
+}
+
+func (c *fakeClient) factory(ctx context.Context, cluster common.Cluster) (common.KustoClient, error) {
+	return c, nil
+}
+
+func (c *fakeClient) Mgmt(ctx context.Context, db string, command azkustodata.Statement, options ...azkustodata.QueryOption) (v1.Dataset, error) {
+	c.commands = append(c.commands, command.String())
+
+	if err, ok := c.mgmtErrs[command.String()]; ok {
+		return nil, err
+	}
+	table, ok := c.mgmt[command.String()]
+	if !ok {
+		return nil, kustoerrors.ES(kustoerrors.OpMgmt, kustoerrors.KOther, "unexpected command %s", command.String())
+	}
+
+	rawColumns := []v1.RawColumn{}
+	for i, name := range table.columns {
+		columnType := types.String
+		if i < len(table.types) {
+			columnType = table.types[i]
+		}
+		rawColumns = append(rawColumns, v1.RawColumn{ColumnName: name, ColumnType: string(columnType)})
+	}
+	data, err := json.Marshal(map[string]any{
+		"Tables": []any{map[string]any{"TableName": "Table_0", "Columns": rawColumns, "Rows": table.rows}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v1.NewDatasetFromReader(ctx, kustoerrors.OpMgmt, io.NopCloser(strings.NewReader(string(data))))
+}
+
+func (c *fakeClient) Query(ctx context.Context, db string, stmt azkustodata.Statement, options ...azkustodata.QueryOption) (query.Dataset, error) {
+	c.queries = append(c.queries, stmt.String())
+	if c.queryErr != nil {
+		return nil, c.queryErr
+	}
+
+	base := query.NewBaseDataset(ctx, kustoerrors.OpQuery, "PrimaryResult")
+
+	results := c.results
+	if results == nil {
+		results = []fakeTable{c.query}
+	}
+
+	tables := []query.Table{}
+	for ordinal, result := range results {
+		columns := []query.Column{}
+		for i, name := range result.columns {
+			columns = append(columns, query.NewColumn(i, name, result.types[i]))
+		}
+		table := query.NewBaseTable(base, int64(ordinal), fmt.Sprint(ordinal), "PrimaryResult", "PrimaryResult", columns)
+
+		rows := []query.Row{}
+		for i, row := range result.rows {
+			values := value.Values{}
+			for j, v := range row {
+				values = append(values, fakeValue(result.types[j], v))
+			}
+			rows = append(rows, query.NewRow(table, i, values))
+		}
+		tables = append(tables, query.NewTable(table, rows))
+	}
+
+	return query.NewDataset(base, tables), nil
+}
+
+// fakeValue converts a value of a fake table to a Kusto value. nil becomes null.
+func fakeValue(column types.Column, v any) value.Kusto {
+	if v == nil {
+		return value.Default(column)
+	}
+	switch column {
+	case types.Long:
+		return value.NewLong(int64(v.(int)))
+	case types.Real:
+		return value.NewReal(v.(float64))
+	case types.DateTime:
+		t, _ := time.Parse(time.RFC3339, v.(string))
+		return value.NewDateTime(t)
+	default:
+		return value.NewString(v.(string))
+	}
+}
+
+func (c *fakeClient) QueryToJson(ctx context.Context, db string, stmt azkustodata.Statement, options ...azkustodata.QueryOption) (string, error) {
+	c.queries = append(c.queries, stmt.String())
+	return "[]", nil
+}
+
+func (c *fakeClient) Close() error {
+	c.closed++
+	return nil
+}
+
+func fakeRequest(name string, arguments map[string]any) mcp.CallToolRequest {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = name
+	request.Params.Arguments = arguments
+	return request
+}
+
+func resultText(t *testing.T, result *mcp.CallToolResult, err error) string {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Handler failed: %v", err)
+	}
+	return result.Content[0].(mcp.TextContent).Text
+}
+
+// resetSchemaCache empties the schema cache before and after the test, as the fake clients of the tests
+// answer differently for the same cluster.
+func resetSchemaCache(t *testing.T) {
+	schemas.clear()
+	t.Cleanup(schemas.clear)
+}
+
+func TestListDatabasesHandlerWithFakeClient(t *testing.T) {
+	resetSchemaCache(t)
+
+	err := common.SetConfig(common.Config{Clusters: []common.ClusterConfig{
+		{Name: "fake", Endpoint: "https://fake.kusto.windows.net", AllowedDatabases: []string{"Samples", "Logs"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer common.SetConfig(common.Config{})
+
+	client := &fakeClient{mgmt: map[string]fakeTable{
+		".show databases": {columns: []string{"DatabaseName"}, rows: [][]any{{"Samples"}, {"Secret"}, {"Logs"}}},
+	}}
+
+	result, err := listDatabasesHandler(client.factory)(context.Background(), fakeRequest("list_databases", map[string]any{"cluster": "fake"}))
+	text := resultText(t, result, err)
+
+	var response ListDatabasesResponse
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+	if strings.Join(response.Databases, ",") != "Samples,Logs" {
+		t.Fatalf("Expected the allowed databases, got %v", response.Databases)
+	}
+	if client.closed != 1 {
+		t.Fatalf("Expected the client to be closed once, got %d", client.closed)
+	}
+}
+
+func TestListTablesHandlerWithFakeClient(t *testing.T) {
+	resetSchemaCache(t)
+	client := &fakeClient{mgmt: map[string]fakeTable{
+		".show tables": {columns: []string{"TableName", "DatabaseName"}, rows: [][]any{{"StormEvents", "Samples"}, {"Covid19", "Samples"}}},
+	}}
+
+	result, err := listTablesHandler(client.factory)(context.Background(), fakeRequest("list_tables", map[string]any{"cluster": "fake", "database": "Samples"}))
+	text := resultText(t, result, err)
+
+	var response ListTablesResponse
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+	if response.Database != "Samples" || strings.Join(response.Tables, ",") != "StormEvents,Covid19" {
+		t.Fatalf("Unexpected response: %+v", response)
+	}
+}
+
+func TestGetSchemaHandlerWithFakeClient(t *testing.T) {
+	resetSchemaCache(t)
+	schema := `{"Name":"StormEvents","OrderedColumns":[{"Name":"State","Type":"System.String","CslType":"string"}]}`
+	client := &fakeClient{mgmt: map[string]fakeTable{
+		".show table StormEvents schema as json": {columns: []string{"TableName", "Schema"}, rows: [][]any{{"StormEvents", schema}}},
+	}}
+
+	result, err := getSchemaHandler(client.factory)(context.Background(), fakeRequest("get_table_schema", map[string]any{"cluster": "fake", "database": "Samples", "table": "StormEvents"}))
+	text := resultText(t, result, err)
+	if text != schema {
+		t.Fatalf("Expected the schema, got %s (commands %v)", text, client.commands)
+	}
+}
+
+func TestExecuteQueryHandlerWithFakeClient(t *testing.T) {
+	client := &fakeClient{query: fakeTable{
+		columns: []string{"State", "Count"},
+		types:   []types.Column{types.String, types.Long},
+		rows:    [][]any{{"TEXAS", 4701}, {"KANSAS", 3166}},
+	}}
+
+	request := fakeRequest("execute_query", map[string]any{"cluster": "fake", "database": "Samples", "query": "StormEvents | summarize Count = count() by State | top 2 by Count", "format": formatRows})
+	result, err := executeQueryHandler(client.factory)(context.Background(), request)
+	text := resultText(t, result, err)
+
+	if text != `{"tables":[{"name":"PrimaryResult","columns":[{"name":"State","type":"string"},{"name":"Count","type":"long"}],"rows":[{"Count":4701,"State":"TEXAS"},{"Count":3166,"State":"KANSAS"}]}]}` {
+		t.Fatalf("Unexpected result: %s", text)
+	}
+	if len(client.queries) != 1 || client.queries[0] != "StormEvents | summarize Count = count() by State | top 2 by Count" {
+		t.Fatalf("Unexpected queries: %v", client.queries)
+	}
+
+	// results are markdown tables by default
+	delete(request.GetArguments(), "format")
+	result, err = executeQueryHandler(client.factory)(context.Background(), request)
+	if text := resultText(t, result, err); text != "| State (string) | Count (long) |\n| --- | --- |\n| TEXAS | 4701 |\n| KANSAS | 3166 |\n" {
+		t.Fatalf("Unexpected markdown result: %q", text)
+	}
+
+	request.GetArguments()["query"] = ".drop table StormEvents"
+	if _, err := executeQueryHandler(client.factory)(context.Background(), request); err == nil || len(client.queries) != 2 {
+		t.Fatal("Expected control commands to be rejected before reaching the client")
+	}
+}
+
+func TestExecuteQueryErrorPosition(t *testing.T) {
+	syntaxError := func(line, column int) error {
+		return httpError(http.StatusBadRequest, fmt.Sprintf(`{"error": {"code": "General_BadRequest", "message": "Request is invalid and cannot be executed.", "@type": "Kusto.Data.Exceptions.SyntaxException", "@message": "Syntax error: Query could not be parsed at 'wher' on line [%d,%d]", "@permanent": true}}`, line, column))
+	}
+	tests := []struct {
+		query                     string
+		reportedLine              int
+		expectedLine, expectedCol int
+	}{
+		// the declaration of the parameters is sent on the first line
+		{"StormEvents | wher State == state", 2, 1, 15},
+		// the default value of since is sent before the query as well
+		{"declare query_parameters(state:string, since:datetime = datetime(2007-01-01));\nStormEvents | wher State == state and StartTime > since", 4, 2, 15},
+	}
+
+	for _, test := range tests {
+		client := &fakeClient{queryErr: syntaxError(test.reportedLine, 15)}
+		_, err := executeQueryHandler(client.factory)(context.Background(), fakeRequest("execute_query", map[string]any{"cluster": "fake", "database": "Samples", "query": test.query, "parameters": map[string]any{"state": "TEXAS"}}))
+		if err == nil {
+			t.Fatal("Expected the query to fail")
+		}
+		if toolError := classifyError(err); toolError.Category != categorySyntax || toolError.Line != test.expectedLine || toolError.Column != test.expectedCol {
+			t.Fatalf("Expected a syntax error at %d,%d for %q, got %+v", test.expectedLine, test.expectedCol, test.query, toolError)
+		}
+	}
+}
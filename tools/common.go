@@ -1,5 +1,52 @@
 package tools
 
-const CLUSTER_PARAMETER_DESCRIPTION = "Name of the cluster. If not available, ask the user to provide the cluster name. Do not use a random cluster name of your choice."
+import (
+	"strings"
 
-const clusterNameFormat = "https://%s.kusto.windows.net/"
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// clusterParameterDescription describes the cluster argument, listing the configured clusters
+// so that the model does not have to guess cluster names.
+func clusterParameterDescription() string {
+	config := common.GetConfig()
+
+	description := "Name of the cluster. It can be a short cluster name (e.g. mycluster or mycluster.westeurope), a full cluster URI or a configured alias."
+
+	if clusters := common.ConfiguredClusters(); len(clusters) > 0 {
+		description += " Configured clusters: " + strings.Join(clusters, ", ") + "."
+	}
+	if config.ClustersRestricted() {
+		description += " Only the configured clusters, the default cluster and cluster aliases can be used."
+	}
+
+	if config.DefaultCluster != "" {
+		description += " If not provided, the default cluster " + config.DefaultCluster + " is used."
+	} else {
+		description += " If not available, ask the user to provide the cluster name. Do not use a random cluster name of your choice."
+	}
+	return description
+}
+
+// databaseParameterDescription adds a note about the configured default database to the description.
+func databaseParameterDescription(description string) string {
+	if common.GetConfig().HasDefaultDatabase() {
+		description += " If not provided, the default database configured for the cluster is used."
+	}
+	return description
+}
+
+// resolveCluster returns the cluster a tool call operates on, falling back to the configured default cluster.
+func resolveCluster(request mcp.CallToolRequest) (common.Cluster, error) {
+	clusterName, _ := request.GetArguments()["cluster"].(string)
+
+	return common.ResolveCluster(clusterName)
+}
+
+// resolveDatabase returns the database a tool call operates on, falling back to the configured default database.
+func resolveDatabase(request mcp.CallToolRequest, cluster common.Cluster) (string, error) {
+	dbName, _ := request.GetArguments()["database"].(string)
+
+	return cluster.ResolveDatabase(dbName)
+}
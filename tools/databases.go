@@ -3,8 +3,6 @@ package tools
 import (
 	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
 
 	"github.com/Azure/azure-kusto-go/azkustodata/kql"
 	"github.com/abhirockzz/mcp_kusto/common"
@@ -12,9 +10,9 @@ import (
 	"github.com/mark3labs/mcp-go/server"
 )
 
-func ListDatabases() (mcp.Tool, server.ToolHandlerFunc) {
+func ListDatabases(clients common.ClientFactory) (mcp.Tool, server.ToolHandlerFunc) {
 
-	return listDatabases(), listDatabasesHandler
+	return listDatabases(), listDatabasesHandler(clients)
 }
 
 func listDatabases() mcp.Tool {
@@ -22,28 +20,58 @@ func listDatabases() mcp.Tool {
 	return mcp.NewTool("list_databases",
 
 		mcp.WithString("cluster",
-			mcp.Required(),
-			mcp.Description(CLUSTER_PARAMETER_DESCRIPTION),
+			mcp.Description(clusterParameterDescription()),
+		),
+		mcp.WithBoolean("refresh",
+			mcp.Description(refreshParameterDescription),
 		),
 		mcp.WithDescription("List all databases in a specific Azure Data Explorer cluster"),
 	)
 }
 
-func listDatabasesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func listDatabasesHandler(clients common.ClientFactory) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 
-	clusterName, ok := request.Params.Arguments["cluster"].(string)
-	if !ok {
-		return nil, errors.New("cluster name missing")
-	}
+		cluster, err := resolveCluster(request)
+		if err != nil {
+			return nil, err
+		}
 
-	client, err := common.GetClient(fmt.Sprintf(clusterNameFormat, clusterName))
-	if err != nil {
-		return nil, err
+		client, err := clients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		databaseNames, cacheAge, err := cachedDatabases(ctx, client, cluster, refreshArgument(request))
+		if err != nil {
+			return nil, err
+		}
+
+		var result ListDatabasesResponse
+
+		result.Databases = databaseNames
+		result.CacheAge = cacheAge
+
+		jsonResult, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(string(jsonResult)), nil
 	}
-	defer client.Close()
+}
+
+type ListDatabasesResponse struct {
+	Databases []string `json:"databases"`
+	// CacheAge is how old the list is when it comes from the schema cache, e.g. 4m30s.
+	CacheAge string `json:"cacheAge,omitempty"`
+}
 
+// showDatabases lists the databases of the cluster that the configuration allows.
+func showDatabases(ctx context.Context, client common.KustoClient, cluster common.Cluster) ([]string, error) {
 	// Use .show databases command
-	dataset, err := client.Mgmt(ctx, "", kql.New(".show databases"))
+	dataset, err := client.Mgmt(ctx, "", kql.New(".show databases"), serverTimeout(ctx)...)
 	if err != nil {
 		return nil, err
 	}
@@ -57,22 +85,10 @@ func listDatabasesHandler(ctx context.Context, request mcp.CallToolRequest) (*mc
 		if err != nil {
 			return nil, err
 		}
-		//fmt.Println("Database:", databaseName)
+		if !cluster.DatabaseAllowed(databaseName) {
+			continue
+		}
 		databaseNames = append(databaseNames, databaseName)
 	}
-
-	var result ListDatabasesResponse
-
-	result.Databases = databaseNames
-
-	jsonResult, err := json.Marshal(result)
-	if err != nil {
-		return nil, err
-	}
-
-	return mcp.NewToolResultText(string(jsonResult)), nil
-}
-
-type ListDatabasesResponse struct {
-	Databases []string `json:"databases"`
+	return databaseNames, nil
 }
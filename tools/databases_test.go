@@ -23,13 +23,7 @@ func TestListDatabasesHandler(t *testing.T) {
 	}
 
 	request := mcp.CallToolRequest{
-		Params: struct {
-			Name      string         `json:"name"`
-			Arguments map[string]any `json:"arguments,omitempty"`
-			Meta      *struct {
-				ProgressToken mcp.ProgressToken `json:"progressToken,omitempty"`
-			} `json:"_meta,omitempty"`
-		}{
+		Params: mcp.CallToolParams{
 			Name: "list_databases",
 			Arguments: map[string]any{
 				"cluster": clusterName,
@@ -37,7 +31,7 @@ func TestListDatabasesHandler(t *testing.T) {
 		},
 	}
 
-	result, err := listDatabasesHandler(ctx, request)
+	result, err := listDatabasesHandler(testClients)(ctx, request)
 	if err != nil {
 		t.Fatalf("listDatabasesHandler failed: %v", err)
 	}
@@ -0,0 +1,213 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+	"github.com/Azure/azure-kusto-go/azkustodata/query"
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// The kinds of entities that can be queried like tables.
+const (
+	kindTable            = "table"
+	kindMaterializedView = "materialized-view"
+	kindExternalTable    = "external-table"
+)
+
+var entityKinds = []string{kindTable, kindMaterializedView, kindExternalTable}
+
+// ListEntities returns a tool that lists the tables, materialized views, external tables and entity groups of a database.
+func ListEntities(clients common.ClientFactory) (mcp.Tool, server.ToolHandlerFunc) {
+
+	return listEntities(), listEntitiesHandler(clients)
+}
+
+func listEntities() mcp.Tool {
+
+	return mcp.NewTool("list_entities",
+
+		mcp.WithString("cluster",
+			mcp.Description(clusterParameterDescription()),
+		),
+		mcp.WithString("database",
+			mcp.Description(databaseParameterDescription("Name of the database to list entities from.")),
+		),
+		mcp.WithDescription("List everything that can be queried in an Azure Data Explorer database: tables, materialized views and external tables (e.g. on ADLS, SQL or OneLake shortcuts), with their kind, folder and docstring, and the entity groups of the database. Materialized views come with their source table, lag and health. Use get_table_schema with the kind of an entity to get its columns."),
+	)
+}
+
+// ListEntitiesResponse is the response of list_entities.
+type ListEntitiesResponse struct {
+	Cluster      string        `json:"cluster"`
+	Database     string        `json:"database"`
+	Entities     []Entity      `json:"entities"`
+	EntityGroups []EntityGroup `json:"entityGroups,omitempty"`
+}
+
+// Entity is a table, materialized view or external table.
+type Entity struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Folder    string `json:"folder,omitempty"`
+	DocString string `json:"docString,omitempty"`
+	// SourceTable, Lag, Healthy and Enabled describe materialized views. Lag is the time since the
+	// view was last materialized, e.g. 4m30s.
+	SourceTable string `json:"sourceTable,omitempty"`
+	Lag         string `json:"lag,omitempty"`
+	Healthy     *bool  `json:"healthy,omitempty"`
+	Enabled     *bool  `json:"enabled,omitempty"`
+	// ExternalType is the type of an external table, e.g. Blob, Sql or Delta.
+	ExternalType string `json:"externalType,omitempty"`
+}
+
+// EntityGroup is a named list of entities, which queries can refer to with macro-expand.
+type EntityGroup struct {
+	Name     string `json:"name"`
+	Entities string `json:"entities"`
+}
+
+func listEntitiesHandler(clients common.ClientFactory) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+
+		cluster, err := resolveCluster(request)
+		if err != nil {
+			return nil, err
+		}
+
+		dbName, err := resolveDatabase(request, cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := clients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		response := ListEntitiesResponse{Cluster: cluster.Name, Database: dbName, Entities: []Entity{}}
+		for _, list := range []struct {
+			command string
+			entity  func(row query.Row) (Entity, error)
+		}{
+			{".show tables", tableEntity},
+			{".show materialized-views", materializedViewEntity},
+			{".show external tables", externalTableEntity},
+		} {
+			dataset, err := client.Mgmt(ctx, dbName, kql.New("").AddUnsafe(list.command), serverTimeout(ctx)...)
+			if err != nil {
+				return nil, err
+			}
+
+			entities := []Entity{}
+			for _, row := range dataset.Tables()[0].Rows() {
+				entity, err := list.entity(row)
+				if err != nil {
+					return nil, err
+				}
+				entities = append(entities, entity)
+			}
+			sort.Slice(entities, func(i, j int) bool { return entities[i].Name < entities[j].Name })
+			response.Entities = append(response.Entities, entities...)
+		}
+
+		// clusters without entity groups do not know the command, which leaves the groups out
+		dataset, err := client.Mgmt(ctx, dbName, kql.New(".show entity_groups"), serverTimeout(ctx)...)
+		if err != nil && !unknownCommand(err) {
+			return nil, err
+		}
+		if err == nil {
+			for _, row := range dataset.Tables()[0].Rows() {
+				group, err := entityGroupFromRow(row)
+				if err != nil {
+					return nil, err
+				}
+				response.EntityGroups = append(response.EntityGroups, group)
+			}
+		}
+
+		jsonResult, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+}
+
+// unknownCommand reports whether a command failed because the cluster does not support it, which Kusto
+// reports as a syntax error.
+func unknownCommand(err error) bool {
+	return classifyError(err).Category == categorySyntax
+}
+
+// tableEntity reads a row of .show tables.
+func tableEntity(row query.Row) (Entity, error) {
+	entity := Entity{Kind: kindTable}
+	return entity, readStrings(row, map[string]*string{"TableName": &entity.Name, "Folder": &entity.Folder, "DocString": &entity.DocString})
+}
+
+// materializedViewEntity reads a row of .show materialized-views.
+func materializedViewEntity(row query.Row) (Entity, error) {
+	entity := Entity{Kind: kindMaterializedView}
+	err := readStrings(row, map[string]*string{"Name": &entity.Name, "SourceTable": &entity.SourceTable, "Folder": &entity.Folder, "DocString": &entity.DocString})
+	if err != nil {
+		return Entity{}, err
+	}
+
+	materializedTo, err := row.DateTimeByName("MaterializedTo")
+	if err != nil {
+		return Entity{}, err
+	}
+	// a view that was never materialized has no lag
+	if materializedTo != nil && !materializedTo.IsZero() {
+		entity.Lag = time.Since(*materializedTo).Round(time.Second).String()
+	}
+
+	if entity.Healthy, err = row.BoolByName("IsHealthy"); err != nil {
+		return Entity{}, err
+	}
+	if entity.Enabled, err = row.BoolByName("IsEnabled"); err != nil {
+		return Entity{}, err
+	}
+	return entity, nil
+}
+
+// externalTableEntity reads a row of .show external tables.
+func externalTableEntity(row query.Row) (Entity, error) {
+	entity := Entity{Kind: kindExternalTable}
+	return entity, readStrings(row, map[string]*string{"TableName": &entity.Name, "TableType": &entity.ExternalType, "Folder": &entity.Folder, "DocString": &entity.DocString})
+}
+
+// entityGroupFromRow reads a row of .show entity_groups. The entities are returned as text, whether the
+// column is a string or dynamic.
+func entityGroupFromRow(row query.Row) (EntityGroup, error) {
+	group := EntityGroup{}
+	var err error
+	if group.Name, err = row.StringByName("Name"); err != nil {
+		return EntityGroup{}, err
+	}
+	entities, err := row.ValueByName("Entities")
+	if err != nil {
+		return EntityGroup{}, err
+	}
+	group.Entities = entities.String()
+	return group, nil
+}
+
+// readStrings reads string columns of a row into the fields they map to.
+func readStrings(row query.Row, fields map[string]*string) error {
+	for column, field := range fields {
+		var err error
+		if *field, err = row.StringByName(column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
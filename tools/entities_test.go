@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/types"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func entitiesClient(materializedTo any) *fakeClient {
+	return &fakeClient{mgmt: map[string]fakeTable{
+		".show tables": {columns: []string{"TableName", "DatabaseName", "Folder", "DocString"}, rows: [][]any{
+			{"StormEvents", "Samples", "Weather", "US storms"},
+			{"PopulationData", "Samples", "", ""},
+		}},
+		".show materialized-views": {
+			columns: []string{"Name", "SourceTable", "Query", "MaterializedTo", "IsHealthy", "IsEnabled", "Folder", "DocString"},
+			types:   []types.Column{types.String, types.String, types.String, types.DateTime, types.Bool, types.Bool, types.String, types.String},
+			rows:    [][]any{{"DailyStorms", "StormEvents", "StormEvents | summarize count() by bin(StartTime, 1d)", materializedTo, false, true, "", ""}},
+		},
+		".show external tables": {columns: []string{"TableName", "TableType", "Folder", "DocString"}, rows: [][]any{{"ArchivedStorms", "Blob", "Archive", ""}}},
+		".show entity_groups": {
+			columns: []string{"Name", "Entities"},
+			types:   []types.Column{types.String, types.Dynamic},
+			rows:    [][]any{{"AllStorms", []any{"database('Samples').StormEvents", "database('Archive').StormEvents"}}},
+		},
+		".show external table ArchivedStorms schema as json": {
+			columns: []string{"TableName", "Schema"},
+			rows:    [][]any{{"ArchivedStorms", `{"Name":"ArchivedStorms","OrderedColumns":[{"Name":"State","Type":"System.String","CslType":"string"}]}`}},
+		},
+	}}
+}
+
+func TestListEntitiesHandlerWithFakeClient(t *testing.T) {
+	materializedTo := time.Now().Add(-5 * time.Minute).UTC().Format(time.RFC3339Nano)
+	result, err := listEntitiesHandler(entitiesClient(materializedTo).factory)(context.Background(), fakeRequest("list_entities", map[string]any{"cluster": "fake", "database": "Samples"}))
+	text := resultText(t, result, err)
+
+	var response ListEntitiesResponse
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+
+	names := []string{}
+	for _, entity := range response.Entities {
+		names = append(names, entity.Kind+":"+entity.Name)
+	}
+	if strings.Join(names, ",") != "table:PopulationData,table:StormEvents,materialized-view:DailyStorms,external-table:ArchivedStorms" {
+		t.Fatalf("Unexpected entities %v", names)
+	}
+	if storms := response.Entities[1]; storms.Folder != "Weather" || storms.DocString != "US storms" || storms.Healthy != nil {
+		t.Fatalf("Unexpected table %+v", storms)
+	}
+
+	view := response.Entities[2]
+	lag, err := time.ParseDuration(view.Lag)
+	if err != nil || lag < 5*time.Minute || lag > 6*time.Minute {
+		t.Fatalf("Expected a lag of about 5 minutes, got %q", view.Lag)
+	}
+	if view.SourceTable != "StormEvents" || view.Healthy == nil || *view.Healthy || view.Enabled == nil || !*view.Enabled {
+		t.Fatalf("Unexpected materialized view %+v", view)
+	}
+	if external := response.Entities[3]; external.ExternalType != "Blob" || external.Folder != "Archive" {
+		t.Fatalf("Unexpected external table %+v", external)
+	}
+
+	if len(response.EntityGroups) != 1 || response.EntityGroups[0].Name != "AllStorms" || !strings.Contains(response.EntityGroups[0].Entities, "database('Archive').StormEvents") {
+		t.Fatalf("Unexpected entity groups %+v", response.EntityGroups)
+	}
+
+	// a view that was never materialized has no lag, and clusters without entity groups still list their entities
+	client := entitiesClient(nil)
+	client.mgmtErrs = map[string]error{".show entity_groups": httpError(http.StatusBadRequest, `{"error": {"code": "General_BadRequest", "message": "Request is invalid and cannot be executed.", "@type": "Kusto.Data.Exceptions.SyntaxException", "@message": "Syntax error: SYN0002: A recognition error occurred. [line:position=1:6]", "@permanent": true}}`)}
+	result, err = listEntitiesHandler(client.factory)(context.Background(), fakeRequest("list_entities", map[string]any{"cluster": "fake", "database": "Samples"}))
+	text = resultText(t, result, err)
+	if strings.Contains(text, `"lag"`) || strings.Contains(text, "entityGroups") {
+		t.Fatalf("Unexpected lag or entity groups: %s", text)
+	}
+
+	// other errors of the command fail the tool call
+	client.mgmtErrs[".show entity_groups"] = httpError(http.StatusTooManyRequests, `{"error": {"code": "TooManyRequests"}}`)
+	if _, err := listEntitiesHandler(client.factory)(context.Background(), fakeRequest("list_entities", map[string]any{"cluster": "fake", "database": "Samples"})); err == nil {
+		t.Fatal("Expected throttling of .show entity_groups to fail the tool call")
+	}
+}
+
+func TestGetSchemaOfExternalTable(t *testing.T) {
+	resetSchemaCache(t)
+	client := entitiesClient(nil)
+
+	request := fakeRequest("get_table_schema", map[string]any{"cluster": "fake", "database": "Samples", "table": "ArchivedStorms", "kind": kindExternalTable})
+	result, err := getSchemaHandler(client.factory)(context.Background(), request)
+	text := resultText(t, result, err)
+
+	var schema TableSchemaResponse
+	if err := json.Unmarshal([]byte(text), &schema); err != nil || schema.Name != "ArchivedStorms" || len(schema.OrderedColumns) != 1 {
+		t.Fatalf("Unexpected schema %s", text)
+	}
+
+	request.GetArguments()["kind"] = "function"
+	if _, err := getSchemaHandler(client.factory)(context.Background(), request); err == nil || len(client.commands) != 1 {
+		t.Fatal("Expected an unsupported kind to be rejected before reaching the client")
+	}
+}
+
+func TestListEntitiesHandler(t *testing.T) {
+	request := mcp.CallToolRequest{
+		Params: mcp.CallToolParams{
+			Name: "list_entities",
+			Arguments: map[string]any{
+				"cluster":  os.Getenv("CLUSTER_NAME"),
+				"database": os.Getenv("DB_NAME"),
+			},
+		},
+	}
+
+	result, err := listEntitiesHandler(testClients)(context.Background(), request)
+	if err != nil {
+		t.Fatalf("listEntitiesHandler failed: %v", err)
+	}
+
+	var response ListEntitiesResponse
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+
+	if !slices.ContainsFunc(response.Entities, func(entity Entity) bool {
+		return entity.Kind == kindTable && entity.Name == os.Getenv("TABLE_NAME")
+	}) {
+		t.Fatalf("Expected table %s in %+v", os.Getenv("TABLE_NAME"), response.Entities)
+	}
+}
@@ -0,0 +1,289 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	kustoerrors "github.com/Azure/azure-kusto-go/azkustodata/errors"
+	v2 "github.com/Azure/azure-kusto-go/azkustodata/query/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Categories of tool errors, so that the model can tell what went wrong and whether to retry.
+const (
+	categoryAuth           = "auth"
+	categoryPermission     = "permission"
+	categorySyntax         = "syntax"
+	categorySemantic       = "semantic"
+	categoryThrottled      = "throttled"
+	categoryTimeout        = "timeout"
+	categoryLimitExceeded  = "limit_exceeded"
+	categoryNotFound       = "not_found"
+	categoryCancelled      = "cancelled"
+	categoryInvalidRequest = "invalid_request"
+	categoryUnavailable    = "unavailable"
+)
+
+var remediationHints = map[string]string{
+	categoryAuth:           "The server could not authenticate to the cluster. Ask the user to check the authentication mode and credentials of the MCP server.",
+	categoryPermission:     "The identity of the server lacks permissions on the cluster or database. Ask the user for access, or use a database that is accessible.",
+	categorySyntax:         "Fix the KQL syntax error at the reported line and column and run the query again.",
+	categorySemantic:       "Check the names of tables, columns and functions with list_tables and get_table_schema, and the types used in the query.",
+	categoryThrottled:      "The cluster is throttling requests. Wait a moment before retrying, and prefer cheaper queries.",
+	categoryTimeout:        "Make the query cheaper, e.g. filter on a narrower time range early in the query, or summarize instead of returning raw rows.",
+	categoryLimitExceeded:  "Reduce the data the query processes or returns, e.g. with where, summarize, project or take.",
+	categoryNotFound:       "Check the cluster and database names, e.g. with list_databases.",
+	categoryCancelled:      "The tool call was cancelled. Only retry if the user asks for it.",
+	categoryInvalidRequest: "Check the arguments of the tool call.",
+	categoryUnavailable:    "The cluster could not be reached. Check the cluster name, or retry later.",
+}
+
+// ToolError is the payload of a failed tool call.
+type ToolError struct {
+	Category string `json:"category"`
+	// Code is the Kusto error code, e.g. SEM0100 or General_BadRequest.
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	// Line and Column locate syntax errors in the query.
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// WithErrorResult returns tool failures as error results, which the model gets to see and can act upon,
+// instead of JSON-RPC errors. It takes and returns a tool and its handler so that it can wrap the tool
+// constructors, e.g. s.AddTool(tools.WithErrorResult(tools.WithTimeout(tools.ExecuteQuery()))).
+func WithErrorResult(tool mcp.Tool, handler server.ToolHandlerFunc) (mcp.Tool, server.ToolHandlerFunc) {
+
+	return tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := handler(ctx, request)
+		if err == nil {
+			return result, nil
+		}
+		return errorResult(classifyError(err)), nil
+	}
+}
+
+func errorResult(toolError ToolError) *mcp.CallToolResult {
+	payload, err := json.Marshal(map[string]ToolError{"error": toolError})
+	if err != nil {
+		payload = []byte(toolError.Message)
+	}
+
+	result := mcp.NewToolResultText(string(payload))
+	result.IsError = true
+	return result
+}
+
+// oneAPIError is the error of a failed Kusto request in the OneAPI format.
+type oneAPIError struct {
+	Code        string `json:"code"`
+	Message     string `json:"message"`
+	Type        string `json:"@type"`
+	Description string `json:"@message"`
+}
+
+// classifyError converts an error of a tool handler into a ToolError, unwrapping the Kusto errors.
+func classifyError(err error) ToolError {
+	toolError := ToolError{Category: categoryInvalidRequest, Message: err.Error()}
+
+	chain := errorChain(err)
+
+	var apiError *oneAPIError
+	statusCode := 0
+	for _, e := range chain {
+		switch e := e.(type) {
+		case *v2.OneApiError:
+			if apiError == nil {
+				apiError = &oneAPIError{Code: e.ErrorMessage.Code, Message: e.ErrorMessage.Message, Type: e.ErrorMessage.Type, Description: e.ErrorMessage.Description}
+			}
+		case *kustoerrors.HttpError:
+			statusCode = e.StatusCode
+			if apiError == nil {
+				apiError = restError(&e.KustoError)
+			}
+		}
+	}
+
+	if apiError != nil {
+		toolError.Code = apiError.Code
+		toolError.Message = apiError.Description
+		if toolError.Message == "" {
+			toolError.Message = apiError.Message
+		}
+		toolError.Line, toolError.Column = errorPosition(toolError.Message)
+		for _, e := range chain {
+			if e, ok := e.(*positionError); ok && toolError.Line > 0 {
+				toolError.Line, toolError.Column = originalPosition(e.query, nil, e.prefixLines, toolError.Line, toolError.Column)
+				break
+			}
+		}
+	}
+
+	toolError.Category = errorCategory(chain, statusCode, apiError)
+	toolError.Hint = remediationHints[toolError.Category]
+	return toolError
+}
+
+// errorChain flattens the errors wrapped by err. Combined Kusto errors return themselves from Unwrap,
+// so errors.Is and errors.As cannot be used on them.
+func errorChain(err error) []error {
+	chain := []error{}
+
+	var walk func(err error, depth int)
+	walk = func(err error, depth int) {
+		if err == nil || depth > 32 {
+			return
+		}
+		chain = append(chain, err)
+
+		switch e := err.(type) {
+		case *kustoerrors.CombinedError:
+			for _, inner := range e.Errors {
+				walk(inner, depth+1)
+			}
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				walk(inner, depth+1)
+			}
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap(), depth+1)
+		}
+	}
+	walk(err, 0)
+
+	return chain
+}
+
+// restError decodes the OneAPI error in the body of a failed HTTP request.
+func restError(e *kustoerrors.Error) *oneAPIError {
+	body := e.UnmarshalREST()
+	if body == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(body["error"])
+	if err != nil {
+		return nil
+	}
+
+	var apiError oneAPIError
+	if json.Unmarshal(data, &apiError) != nil || (apiError.Code == "" && apiError.Message == "") {
+		return nil
+	}
+	return &apiError
+}
+
+func errorCategory(chain []error, statusCode int, apiError *oneAPIError) string {
+	for _, e := range chain {
+		switch e.(type) {
+		case *azidentity.AuthenticationFailedError:
+			return categoryAuth
+		}
+		switch e {
+		case context.Canceled:
+			return categoryCancelled
+		case context.DeadlineExceeded:
+			return categoryTimeout
+		}
+	}
+
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return categoryAuth
+	case http.StatusForbidden:
+		return categoryPermission
+	case http.StatusTooManyRequests:
+		return categoryThrottled
+	case http.StatusNotFound:
+		return categoryNotFound
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return categoryTimeout
+	}
+
+	if apiError != nil {
+		if category := apiErrorCategory(apiError); category != "" {
+			return category
+		}
+	}
+
+	for _, e := range chain {
+		var kustoError *kustoerrors.Error
+		switch e := e.(type) {
+		case *kustoerrors.Error:
+			kustoError = e
+		case *kustoerrors.HttpError:
+			kustoError = &e.KustoError
+		default:
+			continue
+		}
+
+		switch kustoError.Kind {
+		case kustoerrors.KTimeout:
+			return categoryTimeout
+		case kustoerrors.KLimitsExceeded:
+			return categoryLimitExceeded
+		case kustoerrors.KDBNotExist:
+			return categoryNotFound
+		case kustoerrors.KClientArgs:
+			return categoryInvalidRequest
+		case kustoerrors.KIO, kustoerrors.KHTTPError:
+			return categoryUnavailable
+		case kustoerrors.KInternal:
+			// the SDK reports token errors as internal errors, without wrapping the error of the credential
+			if strings.Contains(kustoError.Error(), "getting token") {
+				return categoryAuth
+			}
+			return categoryUnavailable
+		}
+	}
+
+	return categoryInvalidRequest
+}
+
+// apiErrorCategory classifies a Kusto error by its code, exception type and message.
+func apiErrorCategory(apiError *oneAPIError) string {
+	text := strings.ToLower(apiError.Code + " " + apiError.Type + " " + apiError.Message + " " + apiError.Description)
+
+	switch {
+	case strings.Contains(text, "syntaxexception") || strings.Contains(text, "syntax error"):
+		return categorySyntax
+	case strings.Contains(text, "semanticexception") || strings.Contains(text, "semantic error"):
+		return categorySemantic
+	case strings.Contains(text, "unauthorized") || strings.Contains(text, "authentication"):
+		return categoryAuth
+	case strings.Contains(text, "forbidden") || strings.Contains(text, "not authorized") || strings.Contains(text, "accessdenied"):
+		return categoryPermission
+	case strings.Contains(text, "throttl") || strings.Contains(text, "toomanyrequests"):
+		return categoryThrottled
+	case strings.Contains(text, "timeout") || strings.Contains(text, "timed out"):
+		return categoryTimeout
+	case strings.Contains(text, "limitsexceeded") || strings.Contains(text, "too_large") || strings.Contains(text, "runaway") || strings.Contains(text, "low_memory") || strings.Contains(text, "exceeded the allowed limits"):
+		return categoryLimitExceeded
+	case strings.Contains(text, "entitynotfound") || strings.Contains(text, "not found") || strings.Contains(text, "does not exist"):
+		return categoryNotFound
+	}
+	return ""
+}
+
+// Kusto reports the position of syntax errors as "on line [2,7]", or "[line:position=2:7]".
+var errorPositionPattern = regexp.MustCompile(`line \[(\d+),(\d+)\]|line:position=(\d+):(\d+)`)
+
+func errorPosition(message string) (int, int) {
+	match := errorPositionPattern.FindStringSubmatch(message)
+	if match == nil {
+		return 0, 0
+	}
+	if match[1] == "" {
+		match = match[2:]
+	}
+	line, _ := strconv.Atoi(match[1])
+	column, _ := strconv.Atoi(match[2])
+	return line, column
+}
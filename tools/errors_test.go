@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	kustoerrors "github.com/Azure/azure-kusto-go/azkustodata/errors"
+	v2 "github.com/Azure/azure-kusto-go/azkustodata/query/v2"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func httpError(statusCode int, body string) error {
+	return kustoerrors.HTTP(kustoerrors.OpQuery, http.StatusText(statusCode), statusCode, io.NopCloser(strings.NewReader(body)), "error from Kusto endpoint")
+}
+
+func TestClassifyErrorSyntax(t *testing.T) {
+	err := httpError(http.StatusBadRequest, `{"error": {"code": "General_BadRequest", "message": "Request is invalid and cannot be executed.", "@type": "Kusto.Data.Exceptions.SyntaxException", "@message": "Syntax error: Query could not be parsed at 'wher' on line [2,3]", "@permanent": true}}`)
+
+	toolError := classifyError(fmt.Errorf("query failed: %w", err))
+	if toolError.Category != categorySyntax || toolError.Code != "General_BadRequest" || toolError.Line != 2 || toolError.Column != 3 {
+		t.Fatalf("Unexpected error: %+v", toolError)
+	}
+	if !strings.HasPrefix(toolError.Message, "Syntax error:") || toolError.Hint == "" {
+		t.Fatalf("Expected OneAPI message and hint, got %+v", toolError)
+	}
+}
+
+func TestClassifyErrorOneAPI(t *testing.T) {
+	semantic := &v2.OneApiError{ErrorMessage: v2.ErrorMessage{
+		Code:        "SEM0100",
+		Message:     "Request is invalid and cannot be executed.",
+		Type:        "Kusto.Data.Exceptions.SemanticException",
+		Description: "Semantic error: 'where' operator: Failed to resolve column or scalar expression named 'Stat'",
+	}}
+	limits := &v2.OneApiError{ErrorMessage: v2.ErrorMessage{
+		Code:        "LimitsExceeded",
+		Description: "Query execution has exceeded the allowed limits (80DA0003): the results of this query exceed the set limit of 500000 records",
+	}}
+
+	toolError := classifyError(kustoerrors.CombineErrors(semantic, limits))
+	if toolError.Category != categorySemantic || toolError.Code != "SEM0100" || !strings.Contains(toolError.Message, "Stat") {
+		t.Fatalf("Unexpected error: %+v", toolError)
+	}
+
+	if toolError := classifyError(limits); toolError.Category != categoryLimitExceeded {
+		t.Fatalf("Expected limit exceeded, got %+v", toolError)
+	}
+}
+
+func TestClassifyErrorCategories(t *testing.T) {
+	tests := map[string]error{
+		categoryPermission:     httpError(http.StatusForbidden, `{"error": {"code": "Forbidden", "message": "Principal 'x' is not authorized to read database 'Samples'."}}`),
+		categoryAuth:           httpError(http.StatusUnauthorized, "Unauthorized"),
+		categoryThrottled:      httpError(http.StatusTooManyRequests, `{"error": {"code": "TooManyRequests"}}`),
+		categoryNotFound:       httpError(http.StatusBadRequest, `{"error": {"code": "BadRequest_EntityNotFound", "message": "Entity ID 'x' of kind 'Database' was not found."}}`),
+		categoryTimeout:        fmt.Errorf("query did not complete: %w", context.DeadlineExceeded),
+		categoryCancelled:      kustoerrors.E(kustoerrors.OpQuery, kustoerrors.KHTTPError, fmt.Errorf("Post: %w", context.Canceled)),
+		categoryUnavailable:    kustoerrors.E(kustoerrors.OpQuery, kustoerrors.KHTTPError, errors.New("dial tcp: no such host")),
+		categoryInvalidRequest: errors.New("cluster name missing and no default cluster is configured"),
+	}
+	tests[categoryAuth+" token"] = kustoerrors.ES(kustoerrors.OpQuery, kustoerrors.KInternal, "Error while getting token : %s", "azure cli authentication failed")
+
+	for expected, err := range tests {
+		category := strings.TrimSuffix(expected, " token")
+		if toolError := classifyError(err); toolError.Category != category {
+			t.Fatalf("Expected %s for %v, got %+v", category, err, toolError)
+		}
+	}
+}
+
+func TestWithErrorResult(t *testing.T) {
+	tool := mcp.NewTool("failing")
+	_, handler := WithErrorResult(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return nil, errors.New("database name missing")
+	})
+
+	result, err := handler(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatalf("Expected error result instead of error, got %v", err)
+	}
+	if !result.IsError {
+		t.Fatal("Expected IsError to be set")
+	}
+
+	var payload struct {
+		Error ToolError `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Error.Category != categoryInvalidRequest || payload.Error.Message != "database name missing" {
+		t.Fatalf("Unexpected payload: %+v", payload.Error)
+	}
+}
@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// pageFormats are the result formats of fetch_results. Raw results are not paginated.
+var pageFormats = []string{formatMarkdown, formatColumnsRows, formatRows, formatCSV}
+
+func FetchResults() (mcp.Tool, server.ToolHandlerFunc) {
+
+	return fetchResults(), fetchResultsHandler
+}
+
+func fetchResults() mcp.Tool {
+
+	return mcp.NewTool("fetch_results",
+
+		mcp.WithString("cursor",
+			mcp.Required(),
+			mcp.Description("The cursor returned by execute_query or a previous fetch_results call."),
+		),
+		mcp.WithString("format",
+			mcp.Enum(pageFormats...),
+			mcp.Description("Format of the result, see execute_query. Defaults to markdown."),
+		),
+		mcp.WithDescription("Fetch the next page of a large query result, without running the query again. When execute_query or fetch_results truncate a result, they return a cursor for the next page. Cursors expire after a while, after which the query has to be executed again."),
+	)
+}
+
+func fetchResultsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+
+	cursorArg, ok := request.GetArguments()["cursor"].(string)
+	if !ok || cursorArg == "" {
+		return nil, errors.New("cursor missing")
+	}
+
+	format, _ := request.GetArguments()["format"].(string)
+	if format == "" {
+		format = defaultResultFormat
+	}
+	if !slices.Contains(pageFormats, format) {
+		return nil, fmt.Errorf("unsupported format %s, expected one of: %s", format, strings.Join(pageFormats, ", "))
+	}
+
+	start, err := decodeCursor(cursorArg)
+	if err != nil {
+		return nil, err
+	}
+
+	// cursors are only valid for the caller that ran the query
+	caller, _ := common.CallerFromContext(ctx)
+	tables, err := results.get(caller.ID, start.ResultID)
+	if err != nil {
+		return nil, err
+	}
+
+	response, next, err := resultPage(tables, start)
+	if err != nil {
+		return nil, err
+	}
+	if next != nil {
+		next.ResultID = start.ResultID
+		response.Cursor = next.encode()
+	}
+
+	result, err := formatResults(response, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return mcp.NewToolResultText(result), nil
+}
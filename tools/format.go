@@ -0,0 +1,280 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/query"
+	"github.com/Azure/azure-kusto-go/azkustodata/value"
+)
+
+// Result formats supported by execute_query.
+const (
+	formatRows        = "rows"
+	formatColumnsRows = "columns+rows"
+	formatCSV         = "csv"
+	formatMarkdown    = "markdown"
+	formatRaw         = "raw"
+)
+
+var resultFormats = []string{formatMarkdown, formatColumnsRows, formatRows, formatCSV, formatRaw}
+
+// markdown is compact and can be shown to the user as is
+const defaultResultFormat = formatMarkdown
+
+// ResultColumn describes a column of a query result.
+type ResultColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ResultTable is a primary result table of a query. Rows hold the values in column order.
+type ResultTable struct {
+	Name    string         `json:"name"`
+	Columns []ResultColumn `json:"columns"`
+	Rows    [][]any        `json:"rows"`
+	// Truncation is set when rows or columns were left out to fit the result budget.
+	Truncation *TableTruncation `json:"truncation,omitempty"`
+}
+
+// QueryResponse is the response of execute_query for the columns+rows format.
+type QueryResponse struct {
+	Tables    []ResultTable `json:"tables"`
+	Truncated bool          `json:"truncated,omitempty"`
+	// Cursor fetches the next page of a truncated result with fetch_results.
+	Cursor string `json:"cursor,omitempty"`
+	// SuggestedQuery returns a result within the budget when the result was truncated.
+	SuggestedQuery string `json:"suggestedQuery,omitempty"`
+}
+
+// RowsTable is a result table with each row as an object keyed by column name.
+type RowsTable struct {
+	Name    string           `json:"name"`
+	Columns []ResultColumn   `json:"columns"`
+	Rows    []map[string]any `json:"rows"`
+
+	Truncation *TableTruncation `json:"truncation,omitempty"`
+}
+
+// RowsQueryResponse is the response of execute_query for the rows format.
+type RowsQueryResponse struct {
+	Tables         []RowsTable `json:"tables"`
+	Truncated      bool        `json:"truncated,omitempty"`
+	Cursor         string      `json:"cursor,omitempty"`
+	SuggestedQuery string      `json:"suggestedQuery,omitempty"`
+}
+
+// primaryResults converts the primary result tables of a dataset, leaving out
+// secondary tables such as QueryProperties and QueryCompletionInformation.
+func primaryResults(dataset query.Dataset) []ResultTable {
+	tables := []ResultTable{}
+
+	for _, table := range dataset.Tables() {
+		if !table.IsPrimaryResult() {
+			continue
+		}
+
+		result := ResultTable{Name: table.Name(), Columns: []ResultColumn{}, Rows: [][]any{}}
+		for _, column := range table.Columns() {
+			result.Columns = append(result.Columns, ResultColumn{Name: column.Name(), Type: string(column.Type())})
+		}
+
+		for _, row := range table.Rows() {
+			values := make([]any, 0, len(result.Columns))
+			for _, v := range row.Values() {
+				values = append(values, jsonValue(v))
+			}
+			result.Rows = append(result.Rows, values)
+		}
+
+		tables = append(tables, result)
+	}
+	return tables
+}
+
+// jsonValue converts a Kusto value to a value that can be marshaled to JSON. Nulls become nil.
+func jsonValue(v value.Kusto) any {
+	switch v := v.(type) {
+	case *value.String:
+		return v.Value
+	case *value.Dynamic:
+		if v.Value == nil {
+			return nil
+		}
+		if json.Valid(v.Value) {
+			return json.RawMessage(v.Value)
+		}
+		return string(v.Value)
+	case *value.DateTime:
+		if v.String() == "" {
+			return nil
+		}
+		return v.Marshal()
+	case *value.Timespan:
+		if v.Ptr() == nil {
+			return nil
+		}
+		return v.Marshal()
+	case *value.Real:
+		if v.Ptr() == nil {
+			return nil
+		}
+		// NaN and infinity cannot be represented in JSON
+		if f := *v.Ptr(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return v.String()
+		}
+		return *v.Ptr()
+	case *value.Decimal, *value.GUID:
+		if v.String() == "" {
+			return nil
+		}
+		return v.String()
+	}
+
+	// bool, int and long hold a pointer to the value
+	ptr := reflect.ValueOf(v.GetValue())
+	if ptr.Kind() == reflect.Pointer {
+		if ptr.IsNil() {
+			return nil
+		}
+		return ptr.Elem().Interface()
+	}
+	return v.GetValue()
+}
+
+// textValue converts a JSON value of a result table to text for the csv and markdown formats.
+func textValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.RawMessage:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// formatResults renders the result tables in one of the tabular formats.
+// The csv and markdown formats end with a note when the result was truncated.
+func formatResults(response QueryResponse, format string) (string, error) {
+	switch format {
+	case formatColumnsRows:
+		return marshal(response)
+	case formatRows:
+		return marshal(toRowsResponse(response))
+	case formatCSV:
+		return withTruncationNote(joinTables(response.Tables, formatTableCSV), response), nil
+	case formatMarkdown:
+		return withTruncationNote(joinTables(response.Tables, formatTableMarkdown), response), nil
+	}
+	return "", fmt.Errorf("unsupported format %s, expected one of: %s", format, strings.Join(resultFormats, ", "))
+}
+
+func marshal(v any) (string, error) {
+	jsonResult, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonResult), nil
+}
+
+func toRowsResponse(queryResponse QueryResponse) RowsQueryResponse {
+	response := RowsQueryResponse{
+		Tables:         []RowsTable{},
+		Truncated:      queryResponse.Truncated,
+		Cursor:         queryResponse.Cursor,
+		SuggestedQuery: queryResponse.SuggestedQuery,
+	}
+
+	for _, table := range queryResponse.Tables {
+		rowsTable := RowsTable{Name: table.Name, Columns: table.Columns, Rows: []map[string]any{}, Truncation: table.Truncation}
+		for _, row := range table.Rows {
+			object := make(map[string]any, len(row))
+			for i, v := range row {
+				object[table.Columns[i].Name] = v
+			}
+			rowsTable.Rows = append(rowsTable.Rows, object)
+		}
+		response.Tables = append(response.Tables, rowsTable)
+	}
+	return response
+}
+
+func withTruncationNote(result string, response QueryResponse) string {
+	if !response.Truncated {
+		return result
+	}
+	return result + "\n" + truncationNote(response) + "\n"
+}
+
+// joinTables renders each table, adding the table name when there is more than one.
+func joinTables(tables []ResultTable, render func(ResultTable) string) string {
+	if len(tables) == 1 {
+		return render(tables[0])
+	}
+
+	parts := make([]string, 0, len(tables))
+	for _, table := range tables {
+		parts = append(parts, "Table: "+table.Name+"\n\n"+render(table))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// formatTableCSV renders a table as CSV. The header holds each column as name:type.
+func formatTableCSV(table ResultTable) string {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	header := make([]string, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		header = append(header, column.Name+":"+column.Type)
+	}
+	writer.Write(header)
+
+	for _, row := range table.Rows {
+		record := make([]string, 0, len(row))
+		for _, v := range row {
+			record = append(record, textValue(v))
+		}
+		writer.Write(record)
+	}
+
+	writer.Flush()
+	return buf.String()
+}
+
+// formatTableMarkdown renders a table as a markdown table. The header holds each column as name (type).
+func formatTableMarkdown(table ResultTable) string {
+	var sb strings.Builder
+
+	sb.WriteString("|")
+	for _, column := range table.Columns {
+		sb.WriteString(" " + escapeMarkdown(column.Name) + " (" + column.Type + ") |")
+	}
+	sb.WriteString("\n|")
+	for range table.Columns {
+		sb.WriteString(" --- |")
+	}
+	sb.WriteString("\n")
+
+	for _, row := range table.Rows {
+		sb.WriteString("|")
+		for _, v := range row {
+			sb.WriteString(" " + escapeMarkdown(textValue(v)) + " |")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func escapeMarkdown(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	s = strings.ReplaceAll(s, "\r\n", "<br>")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
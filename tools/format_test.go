@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/value"
+)
+
+func testResultTable() ResultTable {
+	return ResultTable{
+		Name: "PrimaryResult",
+		Columns: []ResultColumn{
+			{Name: "State", Type: "string"},
+			{Name: "Count", Type: "long"},
+		},
+		Rows: [][]any{
+			{"TEXAS", int64(4701)},
+			{"a|b\nc", nil},
+		},
+	}
+}
+
+func TestFormatResultsColumnsRows(t *testing.T) {
+	result, err := formatResults(QueryResponse{Tables: []ResultTable{testResultTable()}}, formatColumnsRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"tables":[{"name":"PrimaryResult","columns":[{"name":"State","type":"string"},{"name":"Count","type":"long"}],"rows":[["TEXAS",4701],["a|b\nc",null]]}]}`
+	if result != expected {
+		t.Fatalf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestFormatResultsRows(t *testing.T) {
+	result, err := formatResults(QueryResponse{Tables: []ResultTable{testResultTable()}}, formatRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, `"rows":[{"Count":4701,"State":"TEXAS"},{"Count":null,"State":"a|b\nc"}]`) {
+		t.Fatalf("Unexpected rows result: %s", result)
+	}
+}
+
+func TestFormatResultsCSV(t *testing.T) {
+	result, err := formatResults(QueryResponse{Tables: []ResultTable{testResultTable()}}, formatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "State:string,Count:long\nTEXAS,4701\n\"a|b\nc\",\n"
+	if result != expected {
+		t.Fatalf("Expected %q, got %q", expected, result)
+	}
+}
+
+func TestFormatResultsMarkdown(t *testing.T) {
+	result, err := formatResults(QueryResponse{Tables: []ResultTable{testResultTable()}}, formatMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "| State (string) | Count (long) |\n| --- | --- |\n| TEXAS | 4701 |\n| a\\|b<br>c |  |\n"
+	if result != expected {
+		t.Fatalf("Expected %q, got %q", expected, result)
+	}
+}
+
+func TestFormatResultsMultipleTables(t *testing.T) {
+	second := testResultTable()
+	second.Name = "Table_1"
+
+	result, err := formatResults(QueryResponse{Tables: []ResultTable{testResultTable(), second}}, formatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(result, "Table: PrimaryResult\n\n") || !strings.Contains(result, "\nTable: Table_1\n\n") {
+		t.Fatalf("Expected table names in result, got %q", result)
+	}
+}
+
+func TestFormatResultsUnknownFormat(t *testing.T) {
+	if _, err := formatResults(QueryResponse{}, "xml"); err == nil {
+		t.Fatal("Expected error for unknown format")
+	}
+}
+
+func TestJSONValue(t *testing.T) {
+	long := int64(42)
+	real := 1.5
+	nan := math.NaN()
+
+	tests := []struct {
+		value    value.Kusto
+		expected any
+	}{
+		{value.NewString("text"), "text"},
+		{value.NewLong(long), long},
+		{value.NewNullLong(), nil},
+		{value.NewReal(real), real},
+		{value.NewReal(nan), "NaN"},
+		{value.NewNullReal(), nil},
+		{value.NewBool(true), true},
+	}
+
+	for _, test := range tests {
+		if got := jsonValue(test.value); got != test.expected {
+			t.Fatalf("Expected %v for %s, got %v", test.expected, test.value, got)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+	"github.com/Azure/azure-kusto-go/azkustodata/query"
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// ListFunctions returns a tool that lists the stored functions of a database.
+func ListFunctions(clients common.ClientFactory) (mcp.Tool, server.ToolHandlerFunc) {
+
+	return listFunctions(), listFunctionsHandler(clients)
+}
+
+func listFunctions() mcp.Tool {
+
+	return mcp.NewTool("list_functions",
+
+		mcp.WithString("cluster",
+			mcp.Description(clusterParameterDescription()),
+		),
+		mcp.WithString("database",
+			mcp.Description(databaseParameterDescription("Name of the database to list functions from.")),
+		),
+		mcp.WithDescription("List the stored functions of an Azure Data Explorer database with their folder, docstring and parameters. Stored functions often encode business logic, so prefer calling them with execute_query over reimplementing them."),
+	)
+}
+
+// ListFunctionsResponse is the response of list_functions.
+type ListFunctionsResponse struct {
+	Cluster   string              `json:"cluster"`
+	Database  string              `json:"database"`
+	Functions []FunctionSignature `json:"functions"`
+}
+
+func listFunctionsHandler(clients common.ClientFactory) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+
+		cluster, err := resolveCluster(request)
+		if err != nil {
+			return nil, err
+		}
+
+		dbName, err := resolveDatabase(request, cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := clients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		dataset, err := client.Mgmt(ctx, dbName, kql.New(".show functions"), serverTimeout(ctx)...)
+		if err != nil {
+			return nil, err
+		}
+
+		response := ListFunctionsResponse{Cluster: cluster.Name, Database: dbName, Functions: []FunctionSignature{}}
+		for _, row := range dataset.Tables()[0].Rows() {
+			function, err := functionFromRow(row)
+			if err != nil {
+				return nil, err
+			}
+			response.Functions = append(response.Functions, FunctionSignature{
+				Name:       function.Name,
+				Parameters: function.Signature,
+				Folder:     function.Folder,
+				DocString:  function.DocString,
+			})
+		}
+		sort.Slice(response.Functions, func(i, j int) bool { return response.Functions[i].Name < response.Functions[j].Name })
+
+		jsonResult, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+}
+
+// GetFunction returns a tool that retrieves the definition of a stored function.
+func GetFunction(clients common.ClientFactory) (mcp.Tool, server.ToolHandlerFunc) {
+
+	return getFunction(), getFunctionHandler(clients)
+}
+
+func getFunction() mcp.Tool {
+
+	return mcp.NewTool("get_function",
+
+		mcp.WithString("cluster",
+			mcp.Description(clusterParameterDescription()),
+		),
+		mcp.WithString("database",
+			mcp.Description(databaseParameterDescription("Name of the database.")),
+		),
+		mcp.WithString("function",
+			mcp.Required(),
+			mcp.Description("Name of the stored function."),
+		),
+		mcp.WithDescription("Get the body and the parameters of a stored function in an Azure Data Explorer database"),
+	)
+}
+
+// FunctionResponse describes a stored function.
+type FunctionResponse struct {
+	Cluster  string `json:"cluster"`
+	Database string `json:"database"`
+	Name     string `json:"name"`
+	// Signature is the parameter list of the function, e.g. (state:string, limit:long = 10).
+	Signature  string              `json:"signature"`
+	Parameters []FunctionParameter `json:"parameters"`
+	Body       string              `json:"body"`
+	Folder     string              `json:"folder,omitempty"`
+	DocString  string              `json:"docString,omitempty"`
+}
+
+// FunctionParameter is a parameter of a stored function.
+type FunctionParameter struct {
+	Name string `json:"name"`
+	// Type is the scalar type, or the columns of a tabular parameter, e.g. (State:string) or (*).
+	Type    string `json:"type"`
+	Tabular bool   `json:"tabular,omitempty"`
+	// Default is the KQL text of the default value, if the parameter has one.
+	Default string `json:"default,omitempty"`
+}
+
+// getFunctionHandler returns the definition of a stored function, using .show function.
+func getFunctionHandler(clients common.ClientFactory) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+
+		cluster, err := resolveCluster(request)
+		if err != nil {
+			return nil, err
+		}
+
+		dbName, err := resolveDatabase(request, cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		name, ok := request.GetArguments()["function"].(string)
+		if !ok || name == "" {
+			return nil, errors.New("function name missing")
+		}
+
+		client, err := clients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		response, err := cachedFunction(ctx, client, cluster, dbName, name)
+		if err != nil {
+			return nil, err
+		}
+		response.Cluster = cluster.Name
+		response.Database = dbName
+
+		jsonResult, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+}
+
+// showFunction returns the definition of a stored function, with its parameter list parsed.
+func showFunction(ctx context.Context, client common.KustoClient, dbName, name string) (FunctionResponse, error) {
+	dataset, err := client.Mgmt(ctx, dbName, kql.New(".show function ").AddFunction(name), serverTimeout(ctx)...)
+	if err != nil {
+		return FunctionResponse{}, err
+	}
+
+	rows := dataset.Tables()[0].Rows()
+	if len(rows) == 0 {
+		return FunctionResponse{}, fmt.Errorf("function %s not found", name)
+	}
+
+	function, err := functionFromRow(rows[0])
+	if err != nil {
+		return FunctionResponse{}, err
+	}
+	if function.Parameters, err = parseFunctionParameters(function.Signature); err != nil {
+		return FunctionResponse{}, err
+	}
+	return function, nil
+}
+
+// functionFromRow reads a row of .show function or .show functions.
+func functionFromRow(row query.Row) (FunctionResponse, error) {
+	function := FunctionResponse{}
+	err := readStrings(row, map[string]*string{
+		"Name":       &function.Name,
+		"Parameters": &function.Signature,
+		"Body":       &function.Body,
+		"Folder":     &function.Folder,
+		"DocString":  &function.DocString,
+	})
+	if err != nil {
+		return FunctionResponse{}, err
+	}
+	return function, nil
+}
+
+// parseFunctionParameters parses a parameter list such as (T:(State:string), limit:long = 10).
+func parseFunctionParameters(signature string) ([]FunctionParameter, error) {
+	invalid := fmt.Errorf("could not parse the parameter list %s", signature)
+
+	tokens, err := tokenizeKQL(signature)
+	if err != nil || len(tokens) < 2 || tokens[0].text != "(" || tokens[len(tokens)-1].text != ")" {
+		return nil, invalid
+	}
+	// the tokens between the outer parentheses
+	tokens = tokens[1 : len(tokens)-1]
+
+	parameters := []FunctionParameter{}
+	for i := 0; i < len(tokens); {
+		if i+2 >= len(tokens) || tokens[i].kind != kqlIdentifier || tokens[i+1].text != ":" {
+			return nil, invalid
+		}
+		parameter := FunctionParameter{Name: tokens[i].text}
+		i += 2
+
+		// a tabular parameter lists its columns in parentheses
+		end := i + 1
+		if tokens[i].text == "(" {
+			parameter.Tabular = true
+			end = matchingParenthesis(tokens, i)
+			if end < 0 {
+				return nil, invalid
+			}
+			end++
+		}
+		last := tokens[end-1]
+		parameter.Type = signature[tokens[i].offset : last.offset+len(last.text)]
+		i = end
+
+		// the default value runs up to the next comma outside of parentheses
+		if i < len(tokens) && tokens[i].text == "=" {
+			first, depth := i+1, 0
+			for i = first; i < len(tokens) && (depth > 0 || tokens[i].text != ","); i++ {
+				switch tokens[i].text {
+				case "(", "[", "{":
+					depth++
+				case ")", "]", "}":
+					depth--
+				}
+			}
+			if i == first {
+				return nil, invalid
+			}
+			last := tokens[i-1]
+			parameter.Default = signature[tokens[first].offset : last.offset+len(last.text)]
+		}
+		parameters = append(parameters, parameter)
+
+		if i < len(tokens) {
+			if tokens[i].text != "," {
+				return nil, invalid
+			}
+			i++
+		}
+	}
+	return parameters, nil
+}
+
+// matchingParenthesis returns the index of the parenthesis closing the one at start, or -1.
+func matchingParenthesis(tokens []kqlToken, start int) int {
+	depth := 0
+	for i := start; i < len(tokens); i++ {
+		switch tokens[i].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// functionCall builds a query that calls the stored function and nothing else. The arguments are passed as
+// query parameters named after the parameters of the function, and checked against their declared types.
+// Parameters without an argument fall back to their default value.
+func functionCall(ctx context.Context, client common.KustoClient, dbName, name string, arguments map[string]any) (string, *kql.Parameters, error) {
+	function, err := showFunction(ctx, client, dbName, name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for argument := range arguments {
+		if !containsParameter(function.Parameters, argument) {
+			return "", nil, fmt.Errorf("function %s has no parameter %s, its parameters are %s", function.Name, argument, function.Signature)
+		}
+	}
+
+	parameters := kql.NewParameters()
+	callArguments := []string{}
+	for _, parameter := range function.Parameters {
+		argument, ok := arguments[parameter.Name]
+		if !ok {
+			if parameter.Default == "" {
+				return "", nil, fmt.Errorf("missing argument %s of function %s%s", parameter.Name, function.Name, function.Signature)
+			}
+			callArguments = append(callArguments, parameter.Default)
+			continue
+		}
+		if parameter.Tabular {
+			return "", nil, fmt.Errorf("parameter %s of function %s is tabular, which execute_query cannot pass", parameter.Name, function.Name)
+		}
+		if !isParameterName(parameter.Name) {
+			return "", nil, fmt.Errorf("parameter %s of function %s cannot be passed as a query parameter", parameter.Name, function.Name)
+		}
+
+		argument, typ := typedArgument(argument)
+		if typ != "" && parameterTypes[typ] != parameterTypes[strings.ToLower(parameter.Type)] {
+			return "", nil, fmt.Errorf("parameter %s is declared as %s but the value is given as %s", parameter.Name, parameter.Type, typ)
+		}
+
+		v, err := parameterValue(argument, parameter.Type)
+		if err != nil {
+			return "", nil, fmt.Errorf("parameter %s: %w", parameter.Name, err)
+		}
+		parameters.AddValue(parameter.Name, v)
+		callArguments = append(callArguments, parameter.Name)
+	}
+
+	call := kql.New("").AddFunction(function.Name).String() + "(" + strings.Join(callArguments, ", ") + ")"
+	return call, parameters, nil
+}
+
+func containsParameter(parameters []FunctionParameter, name string) bool {
+	for _, parameter := range parameters {
+		if parameter.Name == name {
+			return true
+		}
+	}
+	return false
+}
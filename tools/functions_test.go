@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/types"
+)
+
+func TestParseFunctionParameters(t *testing.T) {
+	tests := []struct {
+		signature string
+		expected  []FunctionParameter
+	}{
+		{"()", []FunctionParameter{}},
+		{"(n:long)", []FunctionParameter{{Name: "n", Type: "long"}}},
+		{
+			"(state:string, limit:long = 10, since:datetime = ago(1d))",
+			[]FunctionParameter{{Name: "state", Type: "string"}, {Name: "limit", Type: "long", Default: "10"}, {Name: "since", Type: "datetime", Default: "ago(1d)"}},
+		},
+		{
+			"(T:(State:string, Count:long), U:(*), names:dynamic = dynamic([\"a\", \"b\"]))",
+			[]FunctionParameter{{Name: "T", Type: "(State:string, Count:long)", Tabular: true}, {Name: "U", Type: "(*)", Tabular: true}, {Name: "names", Type: "dynamic", Default: `dynamic(["a", "b"])`}},
+		},
+	}
+
+	for _, test := range tests {
+		parameters, err := parseFunctionParameters(test.signature)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", test.signature, err)
+		}
+		actual, _ := json.Marshal(parameters)
+		expected, _ := json.Marshal(test.expected)
+		if string(actual) != string(expected) {
+			t.Fatalf("Expected %s for %s, got %s", expected, test.signature, actual)
+		}
+	}
+
+	for _, signature := range []string{"", "n:long", "(n)", "(n:long,", "(n:long = )"} {
+		if _, err := parseFunctionParameters(signature); err == nil {
+			t.Fatalf("Expected %q to be rejected", signature)
+		}
+	}
+}
+
+func functionsClient() *fakeClient {
+	columns := []string{"Name", "Parameters", "Body", "Folder", "DocString"}
+	return &fakeClient{
+		mgmt: map[string]fakeTable{
+			".show functions": {columns: columns, rows: [][]any{
+				{"TopStates", "(n:long)", "{ StormEvents | top n by State }", "Reports", "Top states"},
+				{"StormsIn", "(state:string, limit:long = 10)", "{ StormEvents | where State == state | take limit }", "", ""},
+			}},
+			".show function StormsIn": {columns: columns, rows: [][]any{
+				{"StormsIn", "(state:string, limit:long = 10)", "{ StormEvents | where State == state | take limit }", "", ""},
+			}},
+			".show function StateCounts": {columns: columns, rows: [][]any{
+				{"StateCounts", "(T:(State:string))", "{ T | count }", "", ""},
+			}},
+		},
+		query: fakeTable{columns: []string{"State"}, types: []types.Column{types.String}, rows: [][]any{{"TEXAS"}}},
+	}
+}
+
+func TestListFunctionsHandlerWithFakeClient(t *testing.T) {
+	result, err := listFunctionsHandler(functionsClient().factory)(context.Background(), fakeRequest("list_functions", map[string]any{"cluster": "fake", "database": "Samples"}))
+	text := resultText(t, result, err)
+
+	var response ListFunctionsResponse
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+	if len(response.Functions) != 2 || response.Functions[0].Name != "StormsIn" || response.Functions[1].Parameters != "(n:long)" || response.Functions[1].Folder != "Reports" {
+		t.Fatalf("Unexpected functions %+v", response.Functions)
+	}
+}
+
+func TestGetFunctionHandlerWithFakeClient(t *testing.T) {
+	result, err := getFunctionHandler(functionsClient().factory)(context.Background(), fakeRequest("get_function", map[string]any{"cluster": "fake", "database": "Samples", "function": "StormsIn"}))
+	text := resultText(t, result, err)
+
+	var response FunctionResponse
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+	if response.Body != "{ StormEvents | where State == state | take limit }" || len(response.Parameters) != 2 || response.Parameters[1].Default != "10" {
+		t.Fatalf("Unexpected function %+v", response)
+	}
+
+	if _, err := getFunctionHandler(functionsClient().factory)(context.Background(), fakeRequest("get_function", map[string]any{"cluster": "fake", "database": "Samples"})); err == nil {
+		t.Fatal("Expected a missing function name to be rejected")
+	}
+}
+
+func TestFunctionCall(t *testing.T) {
+	client := functionsClient()
+
+	statement, parameters, err := functionCall(context.Background(), client, "Samples", "StormsIn", map[string]any{"state": "TEXAS' | take 1000000 //"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statement != "StormsIn(state, 10)" {
+		t.Fatalf("Unexpected call %s", statement)
+	}
+	if declaration := parameters.ToDeclarationString(); declaration != "declare query_parameters(state:string);" {
+		t.Fatalf("Unexpected declaration %s", declaration)
+	}
+
+	for _, test := range []struct {
+		function  string
+		arguments map[string]any
+		message   string
+	}{
+		{"StormsIn", map[string]any{}, "missing argument state"},
+		{"StormsIn", map[string]any{"state": "TEXAS", "take": float64(1)}, "has no parameter take"},
+		{"StormsIn", map[string]any{"state": "TEXAS", "limit": "ten"}, "expected a long value"},
+		{"StateCounts", map[string]any{"T": "StormEvents"}, "tabular"},
+		{"Unknown", map[string]any{}, "unexpected command"},
+	} {
+		_, _, err := functionCall(context.Background(), client, "Samples", test.function, test.arguments)
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Fatalf("Expected an error containing %q for %s %v, got %v", test.message, test.function, test.arguments, err)
+		}
+	}
+}
+
+func TestExecuteQueryCallsFunction(t *testing.T) {
+	client := functionsClient()
+
+	request := fakeRequest("execute_query", map[string]any{
+		"cluster":   "fake",
+		"database":  "Samples",
+		"function":  "StormsIn",
+		"arguments": map[string]any{"state": "TEXAS", "limit": float64(5)},
+		"format":    formatRows,
+	})
+	result, err := executeQueryHandler(client.factory)(context.Background(), request)
+	text := resultText(t, result, err)
+
+	if !strings.Contains(text, "TEXAS") || len(client.queries) != 1 || client.queries[0] != "StormsIn(state, limit)" {
+		t.Fatalf("Unexpected result %s for queries %v", text, client.queries)
+	}
+
+	// the invocation path runs the function call and nothing else
+	for _, arguments := range []map[string]any{
+		{"cluster": "fake", "database": "Samples", "function": "StormsIn", "query": "StormEvents"},
+		{"cluster": "fake", "database": "Samples", "function": "StormsIn", "parameters": map[string]any{"state": "TEXAS"}},
+		{"cluster": "fake", "database": "Samples", "query": "StormEvents", "arguments": map[string]any{"state": "TEXAS"}},
+		{"cluster": "fake", "database": "Samples"},
+	} {
+		if _, err := executeQueryHandler(client.factory)(context.Background(), fakeRequest("execute_query", arguments)); err == nil {
+			t.Fatalf("Expected %v to be rejected", arguments)
+		}
+	}
+	if len(client.queries) != 1 {
+		t.Fatalf("Expected no further queries, got %v", client.queries)
+	}
+}
@@ -0,0 +1,55 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/abhirockzz/mcp_kusto/kustotest"
+)
+
+// testClients is the ClientFactory of the tests that run against a cluster.
+var testClients common.ClientFactory = common.PooledClients
+
+// TestMain runs the cluster tests against a fake cluster unless CLUSTER_NAME points at a real one.
+// The fake cluster has the database, table and columns named by DB_NAME, TABLE_NAME and COLUMN_NAMES.
+func TestMain(m *testing.M) {
+	if os.Getenv("CLUSTER_NAME") != "" {
+		os.Exit(m.Run())
+	}
+
+	server := kustotest.NewServer()
+
+	columns := []kustotest.Column{}
+	row := []any{}
+	for _, name := range strings.Split(envOrDefault("COLUMN_NAMES", "column1,column2,column3"), ",") {
+		columns = append(columns, kustotest.Column{Name: name, Type: "string"})
+		row = append(row, "value")
+	}
+	server.AddTable(envOrDefault("DB_NAME", "testdb"), kustotest.Table{Name: envOrDefault("TABLE_NAME", "test_table"), Columns: columns, Rows: [][]any{row}})
+	os.Setenv("CLUSTER_NAME", server.URL)
+
+	testClients = fakeClusterClients
+
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// fakeClusterClients returns clients for fake clusters, which do not authenticate.
+// The SDK refuses to send tokens over http anyway.
+func fakeClusterClients(ctx context.Context, cluster common.Cluster) (common.KustoClient, error) {
+	cluster.Auth = common.AuthConfig{Mode: common.AuthNone}
+	return common.PooledClients(ctx, cluster)
+}
+
+// envOrDefault returns the environment variable, setting it to the default value if it is not set.
+func envOrDefault(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	os.Setenv(name, defaultValue)
+	return defaultValue
+}
@@ -0,0 +1,400 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+	"github.com/Azure/azure-kusto-go/azkustodata/types"
+	"github.com/Azure/azure-kusto-go/azkustodata/value"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// supportedParameterTypes lists the parameter types for error messages and tool descriptions.
+const supportedParameterTypes = "string, int, long, real, decimal, datetime, timespan, bool, guid and dynamic"
+
+// parameterTypes are the supported types of query parameters, with their synonyms in KQL.
+var parameterTypes = map[string]types.Column{
+	"string":   types.String,
+	"int":      types.Int,
+	"int32":    types.Int,
+	"long":     types.Long,
+	"int64":    types.Long,
+	"real":     types.Real,
+	"double":   types.Real,
+	"decimal":  types.Decimal,
+	"datetime": types.DateTime,
+	"date":     types.DateTime,
+	"timespan": types.Timespan,
+	"time":     types.Timespan,
+	"bool":     types.Bool,
+	"boolean":  types.Bool,
+	"guid":     types.GUID,
+	"uuid":     types.GUID,
+	"uniqueid": types.GUID,
+	"dynamic":  types.Dynamic,
+}
+
+// declaredParameter is a parameter of a declare query_parameters statement.
+type declaredParameter struct {
+	name string
+	typ  string
+	// defaultValue is the KQL text of the default value, empty if there is none
+	defaultValue string
+}
+
+// queryParameters converts the parameters argument of execute_query to Kusto query parameters.
+//
+// If the query declares its parameters with declare query_parameters, the values are checked against
+// the declared types. The declaration is removed from the query, since the SDK sends its own declaration
+// along with the parameters. Declared parameters without a value fall back to their default value.
+// Otherwise the type of a parameter is taken from its value, either given as {"type": ..., "value": ...}
+// or inferred from the JSON value.
+func queryParameters(query string, arguments map[string]any) (string, *kql.Parameters, error) {
+	parameters := kql.NewParameters()
+	if len(arguments) == 0 {
+		return query, parameters, nil
+	}
+
+	declared, query, err := removeParameterDeclaration(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	names := make([]string, 0, len(arguments))
+	for name := range arguments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !isParameterName(name) {
+			return "", nil, fmt.Errorf("invalid parameter name %q, parameter names must be valid identifiers", name)
+		}
+
+		argument, typ := typedArgument(arguments[name])
+
+		if declared != nil {
+			parameter, ok := findParameter(declared, name)
+			if !ok {
+				return "", nil, fmt.Errorf("parameter %s is not declared in the declare query_parameters statement of the query", name)
+			}
+			if typ != "" && parameterTypes[typ] != parameterTypes[parameter.typ] {
+				return "", nil, fmt.Errorf("parameter %s is declared as %s but the value is given as %s", name, parameter.typ, typ)
+			}
+			typ = parameter.typ
+		}
+
+		v, err := parameterValue(argument, typ)
+		if err != nil {
+			return "", nil, fmt.Errorf("parameter %s: %w", name, err)
+		}
+		parameters.AddValue(name, v)
+	}
+
+	// declared parameters without a value keep their default value
+	defaults := []string{}
+	for _, parameter := range declared {
+		if _, ok := arguments[parameter.name]; ok {
+			continue
+		}
+		if parameter.defaultValue == "" {
+			return "", nil, fmt.Errorf("parameter %s is declared without a default value, but no value is given for it", parameter.name)
+		}
+		defaults = append(defaults, fmt.Sprintf("let %s = %s;\n", parameter.name, parameter.defaultValue))
+	}
+
+	return strings.Join(defaults, "") + query, parameters, nil
+}
+
+// typedArgument unwraps a value given as {"type": ..., "value": ...}. The type is empty for plain JSON values.
+func typedArgument(argument any) (any, string) {
+	if typed, ok := argument.(map[string]any); ok && len(typed) == 2 && typed["type"] != nil {
+		if v, ok := typed["value"]; ok {
+			typ, _ := typed["type"].(string)
+			return v, strings.ToLower(typ)
+		}
+	}
+	return argument, ""
+}
+
+func isParameterName(name string) bool {
+	return name != "" && isIdentifierStart(name[0]) && !kql.RequiresQuoting(name)
+}
+
+func findParameter(declared []declaredParameter, name string) (declaredParameter, bool) {
+	for _, parameter := range declared {
+		if parameter.name == name {
+			return parameter, true
+		}
+	}
+	return declaredParameter{}, false
+}
+
+// removeParameterDeclaration finds the declare query_parameters statement of the query and removes it.
+// It returns nil parameters if the query has no such statement.
+func removeParameterDeclaration(query string) ([]declaredParameter, string, error) {
+	tokens, err := tokenizeKQL(query)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not parse query: %w", err)
+	}
+
+	for i := 0; i+2 < len(tokens); i++ {
+		if tokens[i].text != "declare" || !strings.EqualFold(tokens[i+1].text, "query_parameters") || tokens[i+2].text != "(" {
+			continue
+		}
+		if i > 0 && tokens[i-1].text != ";" {
+			continue
+		}
+
+		declared, end, err := parseParameterDeclaration(query, tokens, i+3)
+		if err != nil {
+			return nil, "", err
+		}
+
+		// the statement ends with a semicolon after the closing parenthesis
+		stop := tokens[end].offset + 1
+		if end+1 < len(tokens) && tokens[end+1].text == ";" {
+			stop = tokens[end+1].offset + 1
+		}
+		return declared, query[:tokens[i].offset] + query[stop:], nil
+	}
+	return nil, query, nil
+}
+
+// parseParameterDeclaration parses the list of parameters of declare query_parameters, starting after
+// the opening parenthesis. It returns the index of the closing parenthesis.
+func parseParameterDeclaration(query string, tokens []kqlToken, start int) ([]declaredParameter, int, error) {
+	declared := []declaredParameter{}
+	invalid := fmt.Errorf("could not parse the declare query_parameters statement at position %d", tokens[start-1].offset)
+
+	i := start
+	for i < len(tokens) {
+		if tokens[i].text == ")" && len(declared) == 0 {
+			return declared, i, nil
+		}
+		if i+2 >= len(tokens) || tokens[i].kind != kqlIdentifier || tokens[i+1].text != ":" || tokens[i+2].kind != kqlIdentifier {
+			return nil, 0, invalid
+		}
+
+		parameter := declaredParameter{name: tokens[i].text, typ: strings.ToLower(tokens[i+2].text)}
+		if _, ok := parameterTypes[parameter.typ]; !ok {
+			return nil, 0, fmt.Errorf("parameter %s has type %s, supported parameter types are %s", parameter.name, tokens[i+2].text, supportedParameterTypes)
+		}
+		i += 3
+
+		// the default value runs up to the next comma or the closing parenthesis
+		if i < len(tokens) && tokens[i].text == "=" {
+			i++
+			first, depth := i, 0
+			for i < len(tokens) && (depth > 0 || (tokens[i].text != "," && tokens[i].text != ")")) {
+				switch tokens[i].text {
+				case "(", "[", "{":
+					depth++
+				case ")", "]", "}":
+					depth--
+				}
+				i++
+			}
+			if i == first || i >= len(tokens) {
+				return nil, 0, invalid
+			}
+			last := tokens[i-1]
+			parameter.defaultValue = query[tokens[first].offset : last.offset+len(last.text)]
+		}
+		declared = append(declared, parameter)
+
+		if i >= len(tokens) {
+			return nil, 0, invalid
+		}
+		if tokens[i].text == ")" {
+			return declared, i, nil
+		}
+		if tokens[i].text != "," {
+			return nil, 0, invalid
+		}
+		i++
+	}
+	return nil, 0, invalid
+}
+
+// parameterValue converts a JSON value to a Kusto value of the type. Without a type, the type
+// is inferred from the JSON value.
+func parameterValue(v any, typ string) (value.Kusto, error) {
+	if typ == "" {
+		switch v := v.(type) {
+		case string:
+			typ = "string"
+		case bool:
+			typ = "bool"
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				typ = "long"
+			} else {
+				typ = "real"
+			}
+		case nil:
+			return nil, fmt.Errorf("null values need a type, e.g. {\"type\": \"string\", \"value\": null}")
+		default:
+			typ = "dynamic"
+		}
+	}
+
+	column, ok := parameterTypes[strings.ToLower(typ)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %s, supported parameter types are %s", typ, supportedParameterTypes)
+	}
+
+	if v == nil {
+		return value.Default(column), nil
+	}
+
+	mismatch := fmt.Errorf("expected a %s value, got %v", column, v)
+
+	switch column {
+	case types.String:
+		s, ok := v.(string)
+		if !ok {
+			return nil, mismatch
+		}
+		return value.NewString(s), nil
+
+	case types.Long:
+		f, ok := v.(float64)
+		// float64(math.MaxInt64) rounds up to 2^63, which is out of range
+		if !ok || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, mismatch
+		}
+		return value.NewLong(int64(f)), nil
+
+	case types.Int:
+		f, ok := v.(float64)
+		if !ok || f != math.Trunc(f) || f < math.MinInt32 || f > math.MaxInt32 {
+			return nil, mismatch
+		}
+		return value.NewInt(int32(f)), nil
+
+	case types.Real:
+		f, ok := v.(float64)
+		if !ok {
+			return nil, mismatch
+		}
+		return value.NewReal(f), nil
+
+	case types.Decimal:
+		// strings keep all digits, JSON numbers only those of a float64
+		switch v := v.(type) {
+		case float64:
+			return value.NewDecimal(decimal.NewFromFloat(v)), nil
+		case string:
+			d, err := decimal.NewFromString(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid decimal %q", v)
+			}
+			return value.NewDecimal(d), nil
+		}
+		return nil, mismatch
+
+	case types.Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, mismatch
+		}
+		return value.NewBool(b), nil
+
+	case types.GUID:
+		s, ok := v.(string)
+		if !ok {
+			return nil, mismatch
+		}
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid guid %q, expected e.g. 74be27de-1e4e-49d9-b579-fe0b331d3642", s)
+		}
+		return value.NewGUID(id), nil
+
+	case types.DateTime:
+		s, ok := v.(string)
+		if !ok {
+			return nil, mismatch
+		}
+		t, err := parseDatetime(s)
+		if err != nil {
+			return nil, err
+		}
+		return value.NewDateTime(t), nil
+
+	case types.Timespan:
+		s, ok := v.(string)
+		if !ok {
+			return nil, mismatch
+		}
+		d, err := parseTimespan(s)
+		if err != nil {
+			return nil, err
+		}
+		return value.NewTimespan(d), nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return value.NewDynamic(data), nil
+}
+
+var datetimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.9999999", "2006-01-02 15:04:05.9999999", "2006-01-02"}
+
+// parseDatetime parses an ISO 8601 date and time. Times without a time zone are in UTC.
+func parseDatetime(s string) (time.Time, error) {
+	for _, layout := range datetimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid datetime %q, expected an ISO 8601 date and time such as 2024-01-31T12:00:00Z", s)
+}
+
+var timespanPattern = regexp.MustCompile(`^(-)?(?:(\d+)\.)?(\d{1,2}):(\d{2}):(\d{2})(?:\.(\d{1,7}))?$`)
+
+// parseTimespan parses a timespan in the Kusto format ([-][d.]hh:mm:ss[.fffffff]), a number of days such
+// as 2d, or a Go duration such as 1h30m.
+func parseTimespan(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid timespan %q, expected e.g. 1.02:30:00, 2d or 1h30m", s)
+
+	if match := timespanPattern.FindStringSubmatch(s); match != nil {
+		days, _ := strconv.ParseInt("0"+match[2], 10, 64)
+		hours, _ := strconv.ParseInt(match[3], 10, 64)
+		minutes, _ := strconv.ParseInt(match[4], 10, 64)
+		seconds, _ := strconv.ParseInt(match[5], 10, 64)
+		ticks, _ := strconv.ParseInt((match[6] + "0000000")[:7], 10, 64)
+
+		d := time.Duration(days)*24*time.Hour + time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+			time.Duration(seconds)*time.Second + time.Duration(ticks)*100*time.Nanosecond
+		if match[1] == "-" {
+			d = -d
+		}
+		return d, nil
+	}
+
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, invalid
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, invalid
+	}
+	return d, nil
+}
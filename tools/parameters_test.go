@@ -0,0 +1,154 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryParametersInferTypes(t *testing.T) {
+	query := "StormEvents | where State == state and DamageProperty > damage | take n"
+	arguments := map[string]any{
+		"state":  "TEXAS' or 1 == 1 //",
+		"damage": 1.5,
+		"n":      float64(10),
+		"since":  map[string]any{"type": "datetime", "value": "2007-01-01"},
+		"window": map[string]any{"type": "timespan", "value": "1.02:00:00"},
+		"flag":   true,
+		"tags":   []any{"a", "b"},
+	}
+
+	statement, parameters, err := queryParameters(query, arguments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statement != query {
+		t.Fatalf("Expected query to be unchanged, got %q", statement)
+	}
+
+	expected := "declare query_parameters(damage:real, flag:bool, n:long, since:datetime, state:string, tags:dynamic, window:timespan);"
+	if declaration := parameters.ToDeclarationString(); declaration != expected {
+		t.Fatalf("Expected %s, got %s", expected, declaration)
+	}
+
+	values := parameters.ToParameterCollection()
+	if values["state"] != `"TEXAS\' or 1 == 1 //"` {
+		t.Fatalf("Expected string value to be quoted, got %s", values["state"])
+	}
+	if values["since"] != "datetime(2007-01-01T00:00:00Z)" || values["window"] != "timespan(1.02:00:00.0000000)" {
+		t.Fatalf("Unexpected datetime or timespan values: %v", values)
+	}
+}
+
+func TestQueryParametersDeclared(t *testing.T) {
+	query := "// storms\ndeclare query_parameters(state:string, n:long = 10, since:datetime = datetime(2007-01-01));\nStormEvents | where State == state and StartTime > since | take n"
+
+	statement, parameters, err := queryParameters(query, map[string]any{"state": "TEXAS", "n": float64(5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "let since = datetime(2007-01-01);\n// storms\n\nStormEvents | where State == state and StartTime > since | take n"
+	if statement != expected {
+		t.Fatalf("Expected %q, got %q", expected, statement)
+	}
+	if declaration := parameters.ToDeclarationString(); declaration != "declare query_parameters(n:long, state:string);" {
+		t.Fatalf("Unexpected declaration: %s", declaration)
+	}
+}
+
+func TestQueryParametersTypeChecks(t *testing.T) {
+	declared := "declare query_parameters(n:long, since:datetime, d:dynamic);\nT | take n"
+
+	invalid := map[string]map[string]any{
+		"not an integer":    {"n": 1.5, "since": "2007-01-01"},
+		"string for long":   {"n": "10", "since": "2007-01-01"},
+		"invalid datetime":  {"n": float64(1), "since": "yesterday"},
+		"type mismatch":     {"n": map[string]any{"type": "string", "value": "1"}, "since": "2007-01-01"},
+		"undeclared":        {"n": float64(1), "since": "2007-01-01", "other": "x"},
+		"missing value":     {"n": float64(1)},
+		"invalid name":      {"n": float64(1), "since": "2007-01-01", "d": 1, "a b": 1},
+		"missing null type": {"n": float64(1), "since": nil},
+		"long out of range": {"n": 9223372036854775808.0, "since": "2007-01-01"},
+	}
+
+	for name, arguments := range invalid {
+		if _, _, err := queryParameters(declared, arguments); err == nil {
+			t.Fatalf("Expected parameters with %s to be rejected", name)
+		}
+	}
+
+	if _, _, err := queryParameters("T", map[string]any{"x": map[string]any{"type": "xml", "value": "1"}}); err == nil || !strings.Contains(err.Error(), "unsupported type") {
+		t.Fatalf("Expected unsupported type to be rejected, got %v", err)
+	}
+	if _, _, err := queryParameters("declare query_parameters(x:xml);\nT", map[string]any{"x": "1"}); err == nil {
+		t.Fatal("Expected unsupported declared type to be rejected")
+	}
+}
+
+func TestQueryParametersIntGUIDAndDecimal(t *testing.T) {
+	query := "declare query_parameters(n:int, id:guid, amount:decimal, price:decimal);\nT"
+	arguments := map[string]any{"n": float64(-5), "id": "74BE27DE-1E4E-49D9-B579-FE0B331D3642", "amount": "12345678901234567890.123", "price": 1.5}
+
+	_, parameters, err := queryParameters(query, arguments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if declaration := parameters.ToDeclarationString(); declaration != "declare query_parameters(amount:decimal, id:guid, n:int, price:decimal);" {
+		t.Fatalf("Unexpected declaration: %s", declaration)
+	}
+	values := parameters.ToParameterCollection()
+	expected := map[string]string{
+		"n":      "int(-5)",
+		"id":     "guid(74be27de-1e4e-49d9-b579-fe0b331d3642)",
+		"amount": "decimal(12345678901234567890.123)",
+		"price":  "decimal(1.5)",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Fatalf("Expected %s for %s, got %s", value, name, values[name])
+		}
+	}
+
+	// the type can also be given with the value, using the synonyms of KQL
+	_, parameters, err = queryParameters("T", map[string]any{"id": map[string]any{"type": "uuid", "value": "74be27de-1e4e-49d9-b579-fe0b331d3642"}, "n": map[string]any{"type": "int", "value": float64(7)}})
+	if err != nil || parameters.ToDeclarationString() != "declare query_parameters(id:guid, n:int);" {
+		t.Fatalf("Unexpected parameters %s, %v", parameters.ToDeclarationString(), err)
+	}
+
+	invalid := map[string]map[string]any{
+		"int out of range": {"n": float64(1 << 31), "id": "74be27de-1e4e-49d9-b579-fe0b331d3642", "amount": "1", "price": 1.0},
+		"fractional int":   {"n": 1.5, "id": "74be27de-1e4e-49d9-b579-fe0b331d3642", "amount": "1", "price": 1.0},
+		"invalid guid":     {"n": float64(1), "id": "not-a-guid", "amount": "1", "price": 1.0},
+		"number for guid":  {"n": float64(1), "id": float64(1), "amount": "1", "price": 1.0},
+		"invalid decimal":  {"n": float64(1), "id": "74be27de-1e4e-49d9-b579-fe0b331d3642", "amount": "1.2.3", "price": 1.0},
+		"bool for decimal": {"n": float64(1), "id": "74be27de-1e4e-49d9-b579-fe0b331d3642", "amount": true, "price": 1.0},
+	}
+	for name, arguments := range invalid {
+		if _, _, err := queryParameters(query, arguments); err == nil {
+			t.Fatalf("Expected parameters with %s to be rejected", name)
+		}
+	}
+}
+
+func TestParseTimespan(t *testing.T) {
+	tests := map[string]time.Duration{
+		"00:30:00":         30 * time.Minute,
+		"1.02:00:00":       26 * time.Hour,
+		"-00:00:01.5":      -1500 * time.Millisecond,
+		"00:00:00.0000001": 100 * time.Nanosecond,
+		"2d":               48 * time.Hour,
+		"1h30m":            90 * time.Minute,
+	}
+
+	for s, expected := range tests {
+		d, err := parseTimespan(s)
+		if err != nil || d != expected {
+			t.Fatalf("Expected %s for %s, got %s, %v", expected, s, d, err)
+		}
+	}
+
+	if _, err := parseTimespan("soon"); err == nil {
+		t.Fatal("Expected invalid timespan to be rejected")
+	}
+}
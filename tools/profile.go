@@ -0,0 +1,383 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// The limits of profile_table, which keep the profiling query cheap on large tables.
+const (
+	defaultProfileSampleSize = 10000
+	maxProfileSampleSize     = 1000000
+	defaultProfileTop        = 5
+	maxProfileTop            = 20
+	maxProfiledColumns       = 100
+)
+
+// ProfileTable returns a tool that profiles the data distribution of the columns of a table.
+func ProfileTable(clients common.ClientFactory) (mcp.Tool, server.ToolHandlerFunc) {
+
+	return profileTable(), profileTableHandler(clients)
+}
+
+func profileTable() mcp.Tool {
+
+	return mcp.NewTool("profile_table",
+
+		mcp.WithString("cluster",
+			mcp.Description(clusterParameterDescription()),
+		),
+		mcp.WithString("database",
+			mcp.Description(databaseParameterDescription("Name of the database.")),
+		),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Name of the table to profile."),
+		),
+		mcp.WithString("kind",
+			mcp.Description("Kind of the entity, as returned by list_entities. Defaults to table."),
+			mcp.Enum(entityKinds...),
+		),
+		mcp.WithArray("columns",
+			mcp.Description(fmt.Sprintf("Names of the columns to profile. Defaults to all columns, of which the first %d are profiled.", maxProfiledColumns)),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("time_column",
+			mcp.Description("Name of a datetime column to filter on with lookback."),
+		),
+		mcp.WithString("lookback",
+			mcp.Description("Only profile rows whose time_column is within this timespan before now, e.g. 1h, 1d or 7d. Requires time_column."),
+		),
+		mcp.WithNumber("sample_size",
+			mcp.Description(fmt.Sprintf("Number of random rows to profile, at most %d. Defaults to %d.", maxProfileSampleSize, defaultProfileSampleSize)),
+		),
+		mcp.WithNumber("top",
+			mcp.Description(fmt.Sprintf("Number of most common values of string columns and keys of dynamic columns to return, at most %d. Defaults to %d.", maxProfileTop, defaultProfileTop)),
+		),
+		mcp.WithBoolean("refresh",
+			mcp.Description("Fetch the schema of the table from the cluster instead of the schema cache, e.g. after a column was added. The profile itself is always computed from the current data."),
+		),
+		mcp.WithDescription("Profile the data of a table: for each column the ratio of null or empty values and the number of distinct values, the minimum and maximum of numeric, datetime and timespan columns, the most common values of string columns and the most common keys of dynamic columns. The profile is computed over a random sample of rows, optionally within a time window. Use it to learn which values to filter on before writing a query."),
+		mcp.WithToolAnnotation(mcp.ToolAnnotation{
+			Title:           "Profile table columns",
+			ReadOnlyHint:    mcp.ToBoolPtr(true),
+			DestructiveHint: mcp.ToBoolPtr(false),
+			IdempotentHint:  mcp.ToBoolPtr(false),
+			OpenWorldHint:   mcp.ToBoolPtr(true),
+		}),
+	)
+}
+
+// ProfileTableResponse is the response of profile_table.
+type ProfileTableResponse struct {
+	Cluster  string `json:"cluster"`
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	// Query is the profiling query. The lookback is passed to it as the query parameter lookback.
+	Query string `json:"query"`
+	// Rows is the number of sampled rows the profile is computed over.
+	Rows    int64           `json:"rows"`
+	Columns []ColumnProfile `json:"columns"`
+	// OmittedColumns are the columns beyond the limit of profiled columns.
+	OmittedColumns []string `json:"omittedColumns,omitempty"`
+	// SchemaCacheAge is how old the schema of the table is when it comes from the schema cache, e.g. 4m30s.
+	SchemaCacheAge string `json:"schemaCacheAge,omitempty"`
+}
+
+// ColumnProfile describes the values of a column in the sampled rows.
+type ColumnProfile struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// NullRatio is the ratio of null values, or of null and empty values for strings.
+	NullRatio float64 `json:"nullRatio"`
+	// DistinctCount is an estimate of the number of distinct values.
+	DistinctCount int64 `json:"distinctCount"`
+	// Min and Max are set for numeric, datetime and timespan columns.
+	Min any `json:"min,omitempty"`
+	Max any `json:"max,omitempty"`
+	// TopValues are the most common values of a string column.
+	TopValues []ValueCount `json:"topValues,omitempty"`
+	// CommonKeys are the most common property names of the objects in a dynamic column.
+	CommonKeys []ValueCount `json:"commonKeys,omitempty"`
+}
+
+// ValueCount is a value and the number of sampled rows it occurs in.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// profiledColumn is a column of the profiling query, with the aggregates that apply to its type.
+type profiledColumn struct {
+	name      string
+	cslType   string
+	quoted    string
+	hasMinMax bool
+}
+
+func newProfiledColumn(name, cslType string) profiledColumn {
+	column := profiledColumn{name: name, cslType: cslType, quoted: quoteIdentifier(name)}
+	switch cslType {
+	case "int", "long", "real", "decimal", "datetime", "timespan":
+		column.hasMinMax = true
+	}
+	return column
+}
+
+func profileTableHandler(clients common.ClientFactory) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+
+		cluster, err := resolveCluster(request)
+		if err != nil {
+			return nil, err
+		}
+
+		dbName, err := resolveDatabase(request, cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		table, ok := request.GetArguments()["table"].(string)
+		if !ok || table == "" {
+			return nil, errors.New("table name missing")
+		}
+
+		kind, err := entityKind(request)
+		if err != nil {
+			return nil, err
+		}
+
+		sampleSize, err := intArgument(request, "sample_size", defaultProfileSampleSize)
+		if err != nil {
+			return nil, err
+		}
+		if sampleSize > maxProfileSampleSize {
+			return nil, fmt.Errorf("sample_size must be at most %d", maxProfileSampleSize)
+		}
+
+		top, err := intArgument(request, "top", defaultProfileTop)
+		if err != nil {
+			return nil, err
+		}
+		if top > maxProfileTop {
+			return nil, fmt.Errorf("top must be at most %d", maxProfileTop)
+		}
+
+		selected, err := stringListArgument(request, "columns")
+		if err != nil {
+			return nil, err
+		}
+
+		filter, parameters, err := lookbackFilter(request)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := clients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		jsonSchema, cacheAge, err := cachedSchema(ctx, client, cluster, dbName, table, kind, refreshArgument(request))
+		if err != nil {
+			return nil, err
+		}
+		var schema TableSchemaResponse
+		if err := json.Unmarshal([]byte(jsonSchema), &schema); err != nil {
+			return nil, fmt.Errorf("error parsing the schema of %s: %w", table, err)
+		}
+
+		response := ProfileTableResponse{Cluster: cluster.Name, Database: dbName, Table: table, Columns: []ColumnProfile{}, SchemaCacheAge: cacheAge}
+
+		columns := []profiledColumn{}
+		known := map[string]bool{}
+		for _, column := range schema.OrderedColumns {
+			known[column.Name] = true
+			if len(selected) > 0 && !slices.Contains(selected, column.Name) {
+				continue
+			}
+			if len(columns) == maxProfiledColumns {
+				response.OmittedColumns = append(response.OmittedColumns, column.Name)
+				continue
+			}
+			columns = append(columns, newProfiledColumn(column.Name, column.CslType))
+		}
+		for _, name := range selected {
+			if !known[name] {
+				return nil, fmt.Errorf("%s has no column %s", table, name)
+			}
+		}
+		if len(columns) == 0 {
+			return nil, fmt.Errorf("%s has no columns to profile", table)
+		}
+
+		response.Query = profileQuery(entitySource(table, kind)+filter, columns, sampleSize, top)
+
+		options := append(serverTimeout(ctx), azkustodata.RequestReadonly())
+		if parameters.Count() > 0 {
+			options = append(options, azkustodata.QueryParameters(parameters))
+		}
+
+		dataset, err := client.Query(ctx, dbName, kql.New("").AddUnsafe(response.Query), options...)
+		if err != nil {
+			return nil, queryError(ctx, err)
+		}
+
+		if err := readProfile(&response, columns, primaryResults(dataset)); err != nil {
+			return nil, err
+		}
+
+		jsonResult, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+}
+
+// profileQuery builds a query that samples the source once and returns two tables: the aggregates of
+// every column in one row, and the top values or keys of string and dynamic columns, by column index.
+func profileQuery(source string, columns []profiledColumn, sampleSize, top int) string {
+	projected := []string{}
+	aggregates := []string{"Rows = count()"}
+	tops := []string{}
+
+	for i, column := range columns {
+		projected = append(projected, column.quoted)
+
+		empty := fmt.Sprintf("isnull(%s)", column.quoted)
+		distinct := fmt.Sprintf("dcount(%s)", column.quoted)
+		switch column.cslType {
+		case "string":
+			empty = fmt.Sprintf("isempty(%s)", column.quoted)
+		case "dynamic":
+			// dcount does not accept dynamic values
+			distinct = fmt.Sprintf("dcount(tostring(%s))", column.quoted)
+		}
+		aggregates = append(aggregates, fmt.Sprintf("Empty%d = countif(%s)", i, empty), fmt.Sprintf("Distinct%d = %s", i, distinct))
+
+		if column.hasMinMax {
+			aggregates = append(aggregates, fmt.Sprintf("Min%d = min(%s)", i, column.quoted), fmt.Sprintf("Max%d = max(%s)", i, column.quoted))
+		}
+
+		switch column.cslType {
+		case "string":
+			tops = append(tops, fmt.Sprintf("(profiled | where isnotempty(%s) | summarize Count = count() by Value = %s | top %d by Count | extend Column = %d)", column.quoted, column.quoted, top, i))
+		case "dynamic":
+			tops = append(tops, fmt.Sprintf("(profiled | mv-expand Value = bag_keys(%s) to typeof(string) | where isnotempty(Value) | summarize Count = count() by Value | top %d by Count | extend Column = %d)", column.quoted, top, i))
+		}
+	}
+
+	query := fmt.Sprintf("let profiled = materialize(%s | sample %d | project %s);\n", source, sampleSize, strings.Join(projected, ", "))
+	query += "profiled | summarize " + strings.Join(aggregates, ", ")
+	if len(tops) > 0 {
+		query += ";\nunion " + strings.Join(tops, ",\n  ")
+	}
+	return query
+}
+
+// readProfile fills the column profiles from the result tables of the profiling query.
+func readProfile(response *ProfileTableResponse, columns []profiledColumn, tables []ResultTable) error {
+	if len(tables) == 0 || len(tables[0].Rows) == 0 {
+		return errors.New("the profiling query returned no result")
+	}
+	summary := tables[0]
+	cell := func(name string) any {
+		index := slices.IndexFunc(summary.Columns, func(c ResultColumn) bool { return c.Name == name })
+		if index < 0 {
+			return nil
+		}
+		return summary.Rows[0][index]
+	}
+
+	response.Rows = countValue(cell("Rows"))
+	for i, column := range columns {
+		profile := ColumnProfile{Name: column.name, Type: column.cslType, DistinctCount: countValue(cell(fmt.Sprintf("Distinct%d", i)))}
+		if response.Rows > 0 {
+			profile.NullRatio = float64(countValue(cell(fmt.Sprintf("Empty%d", i)))) / float64(response.Rows)
+		}
+		if column.hasMinMax {
+			profile.Min = cell(fmt.Sprintf("Min%d", i))
+			profile.Max = cell(fmt.Sprintf("Max%d", i))
+		}
+		response.Columns = append(response.Columns, profile)
+	}
+
+	if len(tables) < 2 {
+		return nil
+	}
+	topValues := tables[1]
+	value := slices.IndexFunc(topValues.Columns, func(c ResultColumn) bool { return c.Name == "Value" })
+	count := slices.IndexFunc(topValues.Columns, func(c ResultColumn) bool { return c.Name == "Count" })
+	columnIndex := slices.IndexFunc(topValues.Columns, func(c ResultColumn) bool { return c.Name == "Column" })
+	if value < 0 || count < 0 || columnIndex < 0 {
+		return errors.New("unexpected columns in the top values of the profiling query")
+	}
+
+	for _, row := range topValues.Rows {
+		i := int(countValue(row[columnIndex]))
+		if i < 0 || i >= len(response.Columns) {
+			continue
+		}
+		top := ValueCount{Value: textValue(row[value]), Count: countValue(row[count])}
+		if columns[i].cslType == "dynamic" {
+			response.Columns[i].CommonKeys = append(response.Columns[i].CommonKeys, top)
+		} else {
+			response.Columns[i].TopValues = append(response.Columns[i].TopValues, top)
+		}
+	}
+	// union returns the rows of its legs in any order
+	for i := range response.Columns {
+		for _, values := range [][]ValueCount{response.Columns[i].TopValues, response.Columns[i].CommonKeys} {
+			slices.SortStableFunc(values, func(a, b ValueCount) int { return cmp.Compare(b.Count, a.Count) })
+		}
+	}
+	return nil
+}
+
+// countValue converts a count of a result table to a number. Nulls become 0.
+func countValue(v any) int64 {
+	switch v := v.(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// stringListArgument returns an argument that has to be a list of non-empty strings, or nil if it is not set.
+func stringListArgument(request mcp.CallToolRequest, name string) ([]string, error) {
+	value, ok := request.GetArguments()[name]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list of names", name)
+	}
+	names := []string{}
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("%s must be a list of names", name)
+		}
+		names = append(names, s)
+	}
+	return names, nil
+}
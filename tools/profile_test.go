@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/types"
+)
+
+const profileSchema = `{"Name":"StormEvents","OrderedColumns":[
+	{"Name":"State","Type":"System.String","CslType":"string"},
+	{"Name":"Damage Property","Type":"System.Int64","CslType":"long"},
+	{"Name":"Details","Type":"System.Object","CslType":"dynamic"}]}`
+
+func profileClient() *fakeClient {
+	return &fakeClient{
+		mgmt: map[string]fakeTable{
+			".show table StormEvents schema as json": {columns: []string{"TableName", "Schema"}, rows: [][]any{{"StormEvents", profileSchema}}},
+		},
+		results: []fakeTable{
+			{
+				columns: []string{"Rows", "Empty0", "Distinct0", "Empty1", "Distinct1", "Min1", "Max1", "Empty2", "Distinct2"},
+				types:   []types.Column{types.Long, types.Long, types.Long, types.Long, types.Long, types.Long, types.Long, types.Long, types.Long},
+				rows:    [][]any{{200, 10, 50, 0, 120, 0, 5000000, 100, 80}},
+			},
+			{
+				columns: []string{"Value", "Count", "Column"},
+				types:   []types.Column{types.String, types.Long, types.Long},
+				rows:    [][]any{{"Source", 60, 2}, {"KANSAS", 20, 0}, {"TEXAS", 30, 0}, {"Magnitude", 90, 2}},
+			},
+		},
+	}
+}
+
+func TestProfileTableHandlerWithFakeClient(t *testing.T) {
+	resetSchemaCache(t)
+	client := profileClient()
+
+	request := fakeRequest("profile_table", map[string]any{"cluster": "fake", "database": "Samples", "table": "StormEvents", "time_column": "StartTime", "lookback": "30d", "top": float64(3)})
+	result, err := profileTableHandler(client.factory)(context.Background(), request)
+	text := resultText(t, result, err)
+
+	var response ProfileTableResponse
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+
+	expected := "let profiled = materialize(['StormEvents'] | where ['StartTime'] > ago(lookback) | sample 10000 | project ['State'], ['Damage Property'], ['Details']);\n" +
+		"profiled | summarize Rows = count(), Empty0 = countif(isempty(['State'])), Distinct0 = dcount(['State']), " +
+		"Empty1 = countif(isnull(['Damage Property'])), Distinct1 = dcount(['Damage Property']), Min1 = min(['Damage Property']), Max1 = max(['Damage Property']), " +
+		"Empty2 = countif(isnull(['Details'])), Distinct2 = dcount(tostring(['Details']));\n" +
+		"union (profiled | where isnotempty(['State']) | summarize Count = count() by Value = ['State'] | top 3 by Count | extend Column = 0),\n" +
+		"  (profiled | mv-expand Value = bag_keys(['Details']) to typeof(string) | where isnotempty(Value) | summarize Count = count() by Value | top 3 by Count | extend Column = 2)"
+	if response.Query != expected || len(client.queries) != 1 || client.queries[0] != expected {
+		t.Fatalf("Expected query\n%s\ngot\n%s", expected, response.Query)
+	}
+
+	if response.Rows != 200 || len(response.Columns) != 3 {
+		t.Fatalf("Unexpected profile %+v", response)
+	}
+	state, damage, details := response.Columns[0], response.Columns[1], response.Columns[2]
+	if state.NullRatio != 0.05 || state.DistinctCount != 50 || len(state.TopValues) != 2 || state.TopValues[0].Value != "TEXAS" || state.Min != nil {
+		t.Fatalf("Unexpected string column profile %+v", state)
+	}
+	if damage.Min != float64(0) || damage.Max != float64(5000000) || damage.TopValues != nil {
+		t.Fatalf("Unexpected numeric column profile %+v", damage)
+	}
+	if details.NullRatio != 0.5 || len(details.CommonKeys) != 2 || details.CommonKeys[0].Value != "Magnitude" || details.CommonKeys[0].Count != 90 {
+		t.Fatalf("Unexpected dynamic column profile %+v", details)
+	}
+}
+
+func TestProfileExternalTable(t *testing.T) {
+	resetSchemaCache(t)
+	client := profileClient()
+	client.mgmt[".show external table ArchivedStorms schema as json"] = client.mgmt[".show table StormEvents schema as json"]
+
+	request := fakeRequest("profile_table", map[string]any{"cluster": "fake", "database": "Samples", "table": "ArchivedStorms", "kind": kindExternalTable})
+	result, err := profileTableHandler(client.factory)(context.Background(), request)
+	resultText(t, result, err)
+
+	if len(client.queries) != 1 || !strings.HasPrefix(client.queries[0], "let profiled = materialize(external_table('ArchivedStorms') | sample 10000 |") {
+		t.Fatalf("Expected the external table to be read with external_table(), got %v", client.queries)
+	}
+}
+
+func TestProfileTableUsesSchemaCache(t *testing.T) {
+	resetSchemaCache(t)
+	client := profileClient()
+
+	profile := func(arguments map[string]any) ProfileTableResponse {
+		t.Helper()
+		client.queries = nil
+		result, err := profileTableHandler(client.factory)(context.Background(), fakeRequest("profile_table", arguments))
+		var response ProfileTableResponse
+		if err := json.Unmarshal([]byte(resultText(t, result, err)), &response); err != nil {
+			t.Fatalf("Failed to unmarshal content: %v", err)
+		}
+		return response
+	}
+
+	arguments := map[string]any{"cluster": "fake", "database": "Samples", "table": "StormEvents"}
+	profile(arguments)
+	if response := profile(arguments); response.SchemaCacheAge == "" || len(client.commands) != 1 {
+		t.Fatalf("Expected the schema from the cache, got age %q after %v", response.SchemaCacheAge, client.commands)
+	}
+
+	arguments["refresh"] = true
+	if response := profile(arguments); response.SchemaCacheAge != "" || len(client.commands) != 2 {
+		t.Fatalf("Expected refresh to fetch the schema, got age %q after %v", response.SchemaCacheAge, client.commands)
+	}
+}
+
+func TestProfileTableRejectsArguments(t *testing.T) {
+	resetSchemaCache(t)
+	for _, arguments := range []map[string]any{
+		{"table": "StormEvents", "columns": []any{"Unknown"}},
+		{"table": "StormEvents", "sample_size": float64(10000000)},
+		{"table": "StormEvents", "top": float64(0)},
+		{"table": "StormEvents", "kind": "function"},
+		{"table": "StormEvents", "time_column": "StartTime"},
+	} {
+		arguments["cluster"] = "fake"
+		arguments["database"] = "Samples"
+		client := profileClient()
+		_, err := profileTableHandler(client.factory)(context.Background(), fakeRequest("profile_table", arguments))
+		if err == nil || len(client.queries) != 0 {
+			t.Fatalf("Expected %v to be rejected without a query, got %v", arguments, err)
+		}
+	}
+}
+
+func TestProfileQueryColumnSubset(t *testing.T) {
+	query := profileQuery("T", []profiledColumn{newProfiledColumn("Flag", "bool")}, 100, 5)
+	if strings.Contains(query, "union") || strings.Contains(query, "min(") || !strings.Contains(query, "| sample 100 | project ['Flag']") {
+		t.Fatalf("Unexpected query %s", query)
+	}
+}
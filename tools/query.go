@@ -4,16 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
+	"github.com/Azure/azure-kusto-go/azkustodata"
 	"github.com/Azure/azure-kusto-go/azkustodata/kql"
 	"github.com/abhirockzz/mcp_kusto/common"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
-func ExecuteQuery() (mcp.Tool, server.ToolHandlerFunc) {
+func ExecuteQuery(clients common.ClientFactory) (mcp.Tool, server.ToolHandlerFunc) {
 
-	return executeQuery(), executeQueryHandler
+	return executeQuery(), executeQueryHandler(clients)
 }
 
 func executeQuery() mcp.Tool {
@@ -21,12 +24,10 @@ func executeQuery() mcp.Tool {
 	return mcp.NewTool("execute_query",
 
 		mcp.WithString("cluster",
-			mcp.Required(),
-			mcp.Description(CLUSTER_PARAMETER_DESCRIPTION),
+			mcp.Description(clusterParameterDescription()),
 		),
 		mcp.WithString("database",
-			mcp.Required(),
-			mcp.Description("Name of the database."),
+			mcp.Description(databaseParameterDescription("Name of the database.")),
 		),
 
 		// mcp.WithString("table",
@@ -34,47 +35,202 @@ func executeQuery() mcp.Tool {
 		// 	mcp.Description("Name of the table."),
 		// ),
 		mcp.WithString("query",
-			mcp.Required(),
-			mcp.Description("The query to execute."),
+			mcp.Description("The query to execute. Either query or function is required."),
 		),
-		mcp.WithDescription("Execute a read-only query. Ask the user for permission before executing the query. It has to be a valid KQL query. Write queries are not allowed. Result truncation is a limit set by default on the result set returned by the query. Kusto limits the number of records returned to the client to 500,000, and the overall data size for those records to 64 MB. When either of these limits is exceeded, the query fails with a partial query failure. Exceeding these limits will generate an exception. Reduce the result set size by modifying the query to only return interesting data. There are several strategies to avoid this. 1/ Use the summarize operator group and aggregate over similar records in the query output. 2/ Potentially sample some columns by using the take_any aggregation function. 3/ Use a take operator to sample the query output. 4/Use the substring function to trim wide free-text columns. 5/ Use the project operator to drop any uninteresting column from the result set."),
+		mcp.WithString("function",
+			mcp.Description("Name of a stored function to call instead of running a query, e.g. from list_functions. The query then consists of the function call only."),
+		),
+		mcp.WithObject("arguments",
+			mcp.Description("Arguments of the function call, by parameter name. Values are given like the values of parameters, and are checked against the parameter types of the function. Parameters with a default value can be left out."),
+		),
+		mcp.WithObject("parameters",
+			mcp.Description("Values for the query parameters, by parameter name. Always pass values that come from the user or from data as parameters instead of adding them to the query text, and refer to them by name in the query. A value is either a JSON value (strings become string, integers long, other numbers real, booleans bool, objects and arrays dynamic) or an object with type and value, e.g. {\"type\": \"datetime\", \"value\": \"2024-01-31T00:00:00Z\"} or {\"type\": \"timespan\", \"value\": \"1h30m\"}. Supported types are string, int, long, real, decimal, datetime, timespan, bool, guid and dynamic. If the query has a declare query_parameters statement, the values are checked against the declared types."),
+		),
+		mcp.WithString("format",
+			mcp.Enum(resultFormats...),
+			mcp.Description("Format of the result. markdown (default) returns a markdown table with the column names and types in the header, which can be shown to the user as is. columns+rows lists the column names and types once followed by the rows as arrays (preferred when processing the values further), rows returns each row as an object keyed by column name, csv returns CSV with a name:type header, and raw returns the unprocessed Kusto v2 response frames."),
+		),
+		mcp.WithDescription("Execute a read-only query. Ask the user for permission before executing the query. It has to be a valid KQL query. Write queries are not allowed: control commands (starting with a dot, e.g. .show, .set-or-append, .ingest, .drop) are rejected and the query runs in read-only mode. Large results are truncated to the configured row and byte budget of the server; the response then reports the total row count, suggests a reduced query and returns a cursor to fetch the next page with fetch_results. Result truncation is a limit set by default on the result set returned by the query. Kusto limits the number of records returned to the client to 500,000, and the overall data size for those records to 64 MB. When either of these limits is exceeded, the query fails with a partial query failure. Exceeding these limits will generate an exception. Reduce the result set size by modifying the query to only return interesting data. There are several strategies to avoid this. 1/ Use the summarize operator group and aggregate over similar records in the query output. 2/ Potentially sample some columns by using the take_any aggregation function. 3/ Use a take operator to sample the query output. 4/Use the substring function to trim wide free-text columns. 5/ Use the project operator to drop any uninteresting column from the result set."),
 	)
 }
 
-func executeQueryHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-
-	clusterName, ok := request.Params.Arguments["cluster"].(string)
-	if !ok {
-		return nil, errors.New("cluster name missing")
+func executeQueryHandler(clients common.ClientFactory) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+
+		cluster, err := resolveCluster(request)
+		if err != nil {
+			return nil, err
+		}
+
+		dbName, err := resolveDatabase(request, cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		// table, ok := request.GetArguments()["table"].(string)
+		// if !ok {
+		// 	return nil, errors.New("table name missing")
+		// }
+
+		query, _ := request.GetArguments()["query"].(string)
+		function, _ := request.GetArguments()["function"].(string)
+		switch {
+		case query != "" && function != "":
+			return nil, errors.New("pass either a query or a function to call, not both")
+		case query == "" && function == "":
+			return nil, errors.New("query missing, pass a query or a function to call")
+		}
+
+		if function == "" {
+			if err := checkReadOnly(query); err != nil {
+				return nil, err
+			}
+		}
+
+		format, _ := request.GetArguments()["format"].(string)
+		if format == "" {
+			format = defaultResultFormat
+		}
+		if !slices.Contains(resultFormats, format) {
+			return nil, fmt.Errorf("unsupported format %s, expected one of: %s", format, strings.Join(resultFormats, ", "))
+		}
+
+		arguments, err := objectArgument(request, "parameters")
+		if err != nil {
+			return nil, err
+		}
+		functionArguments, err := objectArgument(request, "arguments")
+		if err != nil {
+			return nil, err
+		}
+		if function != "" && len(arguments) > 0 {
+			return nil, errors.New("pass the arguments of a function call in arguments, not parameters")
+		}
+		if function == "" && len(functionArguments) > 0 {
+			return nil, errors.New("arguments are only used with function, use parameters to pass values to a query")
+		}
+
+		var statement string
+		var parameters *kql.Parameters
+		prefixLines := 0
+		if function == "" {
+			statement, parameters, err = queryParameters(query, arguments)
+			if err != nil {
+				return nil, err
+			}
+			// default values of parameters, and the declaration the SDK sends with the parameters, come before the query
+			prefixLines = strings.Count(statement, "\n") - strings.Count(query, "\n")
+			if parameters.Count() > 0 {
+				prefixLines++
+			}
+		}
+
+		client, err := clients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		// the call is built from the definition of the function, so that nothing but the call runs
+		if function != "" {
+			statement, parameters, err = functionCall(ctx, client, dbName, function, functionArguments)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		stmt := kql.New("").AddUnsafe(statement)
+
+		// request_readonly makes the engine reject anything that writes, in case the check above misses something
+		options := append(serverTimeout(ctx), azkustodata.RequestReadonly())
+		if parameters.Count() > 0 {
+			options = append(options, azkustodata.QueryParameters(parameters))
+		}
+
+		if format == formatRaw {
+			queryResponse, err := client.QueryToJson(ctx, dbName, stmt, options...)
+			if err != nil {
+				return nil, queryPositionError(query, prefixLines, queryError(ctx, err))
+			}
+			// raw frames cannot be truncated without breaking them
+			if _, maxBytes := common.GetConfig().ResultBudget(); len(queryResponse) > maxBytes {
+				return nil, fmt.Errorf("raw result is %d bytes, which exceeds the result budget of %d bytes. Use another format, which truncates the result, or reduce the result set of the query", len(queryResponse), maxBytes)
+			}
+			return mcp.NewToolResultText(queryResponse), nil
+		}
+
+		dataset, err := client.Query(ctx, dbName, stmt, options...)
+		if err != nil {
+			return nil, queryPositionError(query, prefixLines, queryError(ctx, err))
+		}
+
+		tables := primaryResults(dataset)
+
+		response, next, err := resultPage(tables, cursor{})
+		if err != nil {
+			return nil, err
+		}
+
+		// the rest of the result is kept, so that it can be fetched without running the query again
+		if next != nil {
+			ttl, maxResults, maxBytes := common.GetConfig().ResultStoreLimits()
+			caller, _ := common.CallerFromContext(ctx)
+			if id, err := results.put(caller.ID, tables, ttl, maxResults, maxBytes); err == nil {
+				next.ResultID = id
+				response.Cursor = next.encode()
+			}
+		}
+		// a reduced function call would lose its arguments, which are passed as parameters
+		if response.Truncated && len(tables) == 1 && function == "" {
+			response.SuggestedQuery = suggestReducedQuery(query, response.Tables)
+		}
+
+		result, err := formatResults(response, format)
+		if err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(result), nil
 	}
+}
 
-	dbName, ok := request.Params.Arguments["database"].(string)
-	if !ok {
-		return nil, errors.New("database name missing")
+// objectArgument returns an argument that has to be a JSON object, or nil if it is not set.
+func objectArgument(request mcp.CallToolRequest, name string) (map[string]any, error) {
+	value, ok := request.GetArguments()[name]
+	if !ok || value == nil {
+		return nil, nil
 	}
-
-	// table, ok := request.Params.Arguments["table"].(string)
-	// if !ok {
-	// 	return nil, errors.New("table name missing")
-	// }
-
-	query, ok := request.Params.Arguments["query"].(string)
+	object, ok := value.(map[string]any)
 	if !ok {
-		return nil, errors.New("query missing")
+		return nil, fmt.Errorf("%s must be an object mapping parameter names to values", name)
 	}
+	return object, nil
+}
 
-	client, err := common.GetClient(fmt.Sprintf(clusterNameFormat, clusterName))
-	if err != nil {
-		return nil, err
+// queryError reports a cancelled or timed out tool call instead of the error it caused in the Kusto client.
+func queryError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("query did not complete: %w", ctx.Err())
 	}
-	defer client.Close()
+	return err
+}
 
-	stmt := kql.New("").AddUnsafe(query)
+// positionError is the error of a query that was sent with lines before it, so that classifyError reports
+// the position of syntax errors in the query of the caller.
+type positionError struct {
+	err         error
+	query       string
+	prefixLines int
+}
 
-	queryResponse, err := client.QueryToJson(context.Background(), dbName, stmt)
-	if err != nil {
-		return nil, err
-	}
+func (e *positionError) Error() string { return e.err.Error() }
 
-	return mcp.NewToolResultText(queryResponse), nil
+func (e *positionError) Unwrap() error { return e.err }
+
+// queryPositionError wraps the error of the query if lines were sent before it.
+func queryPositionError(query string, prefixLines int, err error) error {
+	if prefixLines == 0 {
+		return err
+	}
+	return &positionError{err: err, query: query, prefixLines: prefixLines}
 }
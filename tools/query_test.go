@@ -2,9 +2,13 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/abhirockzz/mcp_kusto/kustotest"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
@@ -35,13 +39,7 @@ func TestExecuteQueryHandler(t *testing.T) {
 	query := tableName + " | count"
 
 	request := mcp.CallToolRequest{
-		Params: struct {
-			Name      string         `json:"name"`
-			Arguments map[string]any `json:"arguments,omitempty"`
-			Meta      *struct {
-				ProgressToken mcp.ProgressToken `json:"progressToken,omitempty"`
-			} `json:"_meta,omitempty"`
-		}{
+		Params: mcp.CallToolParams{
 			Name: "execute_query",
 			Arguments: map[string]any{
 				"cluster":  clusterName,
@@ -51,7 +49,7 @@ func TestExecuteQueryHandler(t *testing.T) {
 		},
 	}
 
-	result, err := executeQueryHandler(ctx, request)
+	result, err := executeQueryHandler(testClients)(ctx, request)
 	if err != nil {
 		t.Fatalf("executeQueryHandler failed: %v", err)
 	}
@@ -73,3 +71,47 @@ func TestExecuteQueryHandler(t *testing.T) {
 		t.Fatal("Expected non-empty content")
 	}
 }
+
+func TestExecuteQueryFaults(t *testing.T) {
+	common.SetConfig(common.Config{Retry: common.RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond}})
+	defer common.SetConfig(common.Config{})
+
+	server := kustotest.NewServer()
+	defer server.Close()
+	server.AddTable("Samples", kustotest.Table{Name: "StormEvents", Columns: []kustotest.Column{{Name: "State", Type: "string"}}, Rows: [][]any{{"TEXAS"}}})
+
+	_, handler := WithAttemptCount(WithErrorResult(ExecuteQuery(fakeClusterClients)))
+	request := fakeRequest("execute_query", map[string]any{"cluster": server.URL, "database": "Samples", "query": "StormEvents | take 10"})
+
+	call := func() (*mcp.CallToolResult, ToolError) {
+		t.Helper()
+		result, err := handler(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Expected an error result instead of an error, got %v", err)
+		}
+		var payload struct {
+			Error ToolError `json:"error"`
+		}
+		if result.IsError {
+			if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &payload); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return result, payload.Error
+	}
+
+	server.InjectFault(kustotest.Throttled(2, ""))
+	if result, toolError := call(); result.IsError || result.Meta["attempts"] != 3 {
+		t.Fatalf("Expected the throttled query to succeed on the third attempt, got %+v, attempts %v", toolError, result.Meta["attempts"])
+	}
+
+	server.InjectFault(kustotest.Throttled(3, ""))
+	if _, toolError := call(); toolError.Category != categoryThrottled {
+		t.Fatalf("Expected a throttled error once the attempts are used up, got %+v", toolError)
+	}
+
+	server.InjectFault(kustotest.PartialFailure())
+	if _, toolError := call(); toolError.Category != categoryLimitExceeded || toolError.Code != "LimitsExceeded" {
+		t.Fatalf("Expected a limits exceeded error, got %+v", toolError)
+	}
+}
@@ -0,0 +1,204 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type kqlTokenKind int
+
+const (
+	kqlIdentifier kqlTokenKind = iota
+	kqlNumber
+	kqlString
+	kqlPunctuation
+)
+
+// kqlToken is a lexical token of a KQL script. Comments and whitespace are dropped.
+type kqlToken struct {
+	kind kqlTokenKind
+	text string
+	// offset of the token in the script, in bytes
+	offset int
+}
+
+// tokenizeKQL is a lightweight KQL lexer. It understands comments, the different string literal
+// forms (quoted, verbatim, multi-line) and enough of the rest of the syntax to find statement boundaries.
+func tokenizeKQL(script string) ([]kqlToken, error) {
+	tokens := []kqlToken{}
+
+	for i := 0; i < len(script); {
+		c := script[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+
+		case strings.HasPrefix(script[i:], "//"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 1
+			}
+
+		case strings.HasPrefix(script[i:], "```") || strings.HasPrefix(script[i:], "~~~"):
+			delimiter := script[i : i+3]
+			end := strings.Index(script[i+3:], delimiter)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated multi-line string literal at position %d", i)
+			}
+			length := 3 + end + 3
+			tokens = append(tokens, kqlToken{kind: kqlString, text: script[i : i+length], offset: i})
+			i += length
+
+		case (c == '@' || c == 'h' || c == 'H') && i+1 < len(script) && (script[i+1] == '\'' || script[i+1] == '"'):
+			// verbatim (@'...') and obfuscated (h'...') strings
+			length, err := scanString(script[i+1:], c == '@')
+			if err != nil {
+				return nil, fmt.Errorf("%w at position %d", err, i)
+			}
+			tokens = append(tokens, kqlToken{kind: kqlString, text: script[i : i+1+length], offset: i})
+			i += 1 + length
+
+		case c == '\'' || c == '"':
+			length, err := scanString(script[i:], false)
+			if err != nil {
+				return nil, fmt.Errorf("%w at position %d", err, i)
+			}
+			tokens = append(tokens, kqlToken{kind: kqlString, text: script[i : i+length], offset: i})
+			i += length
+
+		case isIdentifierStart(c):
+			start := i
+			for i < len(script) && isIdentifierPart(script[i]) {
+				i++
+			}
+			tokens = append(tokens, kqlToken{kind: kqlIdentifier, text: script[start:i], offset: start})
+
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(script) && (isIdentifierPart(script[i]) || script[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, kqlToken{kind: kqlNumber, text: script[start:i], offset: start})
+
+		default:
+			tokens = append(tokens, kqlToken{kind: kqlPunctuation, text: script[i : i+1], offset: i})
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+// scanString returns the length of the string literal at the start of s, including the quotes.
+// Verbatim strings have no escape sequences and represent a quote by doubling it.
+func scanString(s string, verbatim bool) (int, error) {
+	quote := s[0]
+
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\n':
+			return 0, errors.New("unterminated string literal")
+		case s[i] == '\\' && !verbatim:
+			i++
+		case s[i] == quote:
+			if verbatim && i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+	return 0, errors.New("unterminated string literal")
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || c == '$' || c > unicode.MaxASCII || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || (c >= '0' && c <= '9')
+}
+
+// splitKQLStatements splits a tokenized script into statements separated by semicolons.
+// Empty statements are dropped.
+func splitKQLStatements(tokens []kqlToken) [][]kqlToken {
+	statements := [][]kqlToken{}
+	depth := 0
+	start := 0
+
+	for i, token := range tokens {
+		if token.kind != kqlPunctuation {
+			continue
+		}
+		switch token.text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case ";":
+			if depth == 0 {
+				if i > start {
+					statements = append(statements, tokens[start:i])
+				}
+				start = i + 1
+			}
+		}
+	}
+	if start < len(tokens) {
+		statements = append(statements, tokens[start:])
+	}
+	return statements
+}
+
+// checkReadOnly rejects scripts containing control commands (including ingestion and .set* commands)
+// or client directives. Only query statements such as let, set, declare and tabular expressions are allowed.
+func checkReadOnly(query string) error {
+	tokens, err := tokenizeKQL(query)
+	if err != nil {
+		return fmt.Errorf("could not parse query: %w", err)
+	}
+
+	statements := splitKQLStatements(tokens)
+	if len(statements) == 0 {
+		return errors.New("query is empty")
+	}
+
+	for _, statement := range statements {
+		first := statement[0]
+
+		// set request_readonly=false would undo the engine side enforcement
+		if first.kind == kqlIdentifier && first.text == "set" && len(statement) > 1 && strings.EqualFold(statement[1].text, "request_readonly") {
+			return fmt.Errorf("setting request_readonly is not allowed (found at position %d)", first.offset)
+		}
+
+		if first.kind != kqlPunctuation {
+			continue
+		}
+
+		switch first.text {
+		case ".":
+			command := commandName(query, statement)
+			return fmt.Errorf("control commands are not allowed, only read-only queries can be executed (found %s at position %d)", command, first.offset)
+		case "#":
+			return fmt.Errorf("client directives are not allowed (found at position %d)", first.offset)
+		}
+	}
+	return nil
+}
+
+// commandName returns the name of the control command a statement starts with, e.g. ".set-or-append".
+func commandName(query string, statement []kqlToken) string {
+	end := statement[0].offset + 1
+	for _, token := range statement[1:] {
+		if token.offset != end || (token.kind != kqlIdentifier && token.text != "-") {
+			break
+		}
+		end += len(token.text)
+	}
+	return query[statement[0].offset:end]
+}
@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckReadOnlyAllowsQueries(t *testing.T) {
+	queries := []string{
+		"StormEvents | take 10",
+		"StormEvents | where State == '.drop table StormEvents' | count",
+		"// .drop table StormEvents\nStormEvents | count",
+		"let x = 1;\nStormEvents | take x",
+		"set notruncation;\nStormEvents | take 10",
+		"declare query_parameters(n:long);\nStormEvents | take n",
+		"StormEvents | where Message has @'c:\\.set-or-append'",
+		"print s = ```\n.drop table T;\n```",
+		"StormEvents | extend x = \"a \\\" ; .drop table T\"",
+		"let f = () { StormEvents | take 1; }; f()",
+		"StormEvents | take 10;",
+	}
+
+	for _, query := range queries {
+		if err := checkReadOnly(query); err != nil {
+			t.Fatalf("Expected query to be allowed: %q, got %v", query, err)
+		}
+	}
+}
+
+func TestCheckReadOnlyRejectsCommands(t *testing.T) {
+	queries := map[string]string{
+		".drop table StormEvents":                          ".drop",
+		"  .set-or-append T <| StormEvents":                ".set-or-append",
+		".set T <| print 1":                                ".set",
+		"// comment\n.ingest inline into table T <| 1":     ".ingest",
+		"StormEvents | count; .drop table StormEvents":     ".drop",
+		"let x = 1;\n.append T <| print x":                 ".append",
+		"print ';'; .set-or-replace T <| print 1":          ".set-or-replace",
+		". drop table StormEvents":                         ".",
+		"#connect cluster('other').database('db')":         "client directives",
+		"set request_readonly=false; StormEvents | take 1": "request_readonly",
+	}
+
+	for query, expected := range queries {
+		err := checkReadOnly(query)
+		if err == nil {
+			t.Fatalf("Expected query to be rejected: %q", query)
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected error for %q to mention %s, got %v", query, expected, err)
+		}
+	}
+}
+
+func TestCheckReadOnlyInvalidScripts(t *testing.T) {
+	for _, query := range []string{"", "// only a comment", ";;", "print 'unterminated", "print ```open"} {
+		if err := checkReadOnly(query); err == nil {
+			t.Fatalf("Expected script to be rejected: %q", query)
+		}
+	}
+}
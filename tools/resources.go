@@ -0,0 +1,92 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// The URI templates of the resources. The cluster is a short cluster name or a configured alias,
+// as full cluster URIs do not fit into a URI.
+const (
+	databaseURITemplate    = "kusto://{cluster}/{database}"
+	tableSchemaURITemplate = "kusto://{cluster}/{database}/tables/{table}/schema"
+	functionURITemplate    = "kusto://{cluster}/{database}/functions/{function}"
+)
+
+// DatabaseResource returns a resource template for the catalog of a database, the tables listed by list_tables.
+func DatabaseResource(clients common.ClientFactory) (mcp.ResourceTemplate, server.ResourceTemplateHandlerFunc) {
+
+	return mcp.NewResourceTemplate(databaseURITemplate, "Database catalog",
+		mcp.WithTemplateDescription("The tables of an Azure Data Explorer database"),
+		mcp.WithTemplateMIMEType("application/json"),
+	), toolResource("list_tables", listTablesHandler(clients))
+}
+
+// TableSchemaResource returns a resource template for the schema of a table, as returned by get_table_schema.
+func TableSchemaResource(clients common.ClientFactory) (mcp.ResourceTemplate, server.ResourceTemplateHandlerFunc) {
+
+	return mcp.NewResourceTemplate(tableSchemaURITemplate, "Table schema",
+		mcp.WithTemplateDescription("The columns and types of a table in an Azure Data Explorer database"),
+		mcp.WithTemplateMIMEType("application/json"),
+	), toolResource("get_table_schema", getSchemaHandler(clients))
+}
+
+// FunctionResource returns a resource template for the definition of a stored function.
+func FunctionResource(clients common.ClientFactory) (mcp.ResourceTemplate, server.ResourceTemplateHandlerFunc) {
+
+	return mcp.NewResourceTemplate(functionURITemplate, "Stored function",
+		mcp.WithTemplateDescription("The parameters, body, folder and docstring of a stored function in an Azure Data Explorer database"),
+		mcp.WithTemplateMIMEType("application/json"),
+	), toolResource("get_function", getFunctionHandler(clients))
+}
+
+// toolResource serves a resource template with the handler of a tool, so that resources and tools return
+// the same content. The variables of the URI become the arguments of the tool call, and the tool's timeout applies.
+func toolResource(tool string, handler server.ToolHandlerFunc) server.ResourceTemplateHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		ctx, cancel := context.WithTimeout(ctx, common.GetConfig().TimeoutFor(tool))
+		defer cancel()
+
+		call := mcp.CallToolRequest{}
+		call.Params.Name = tool
+		call.Params.Arguments = uriArguments(request.Params.Arguments)
+
+		result, err := handler(ctx, call)
+		if err != nil {
+			toolError := classifyError(err)
+			return nil, fmt.Errorf("%s error reading %s: %s", toolError.Category, request.Params.URI, toolError.Message)
+		}
+
+		// the JSON document comes first, notes for the model, such as the age of a cached schema, follow it
+		text := ""
+		if len(result.Content) > 0 {
+			if textContent, ok := result.Content[0].(mcp.TextContent); ok {
+				text = textContent.Text
+			}
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{URI: request.Params.URI, MIMEType: "application/json", Text: text},
+		}, nil
+	}
+}
+
+// uriArguments turns the variables matched from a URI template, which are lists of values, into tool arguments.
+func uriArguments(variables map[string]any) map[string]any {
+	arguments := map[string]any{}
+	for name, value := range variables {
+		switch v := value.(type) {
+		case []string:
+			if len(v) > 0 {
+				arguments[name] = v[0]
+			}
+		case string:
+			arguments[name] = v
+		}
+	}
+	return arguments
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// readResource reads a resource through the MCP server, so that the URI is matched against the templates.
+func readResource(t *testing.T, s *server.MCPServer, uri string) (string, *mcp.JSONRPCError) {
+	t.Helper()
+
+	message := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":%q}}`, uri)
+	switch response := s.HandleMessage(context.Background(), json.RawMessage(message)).(type) {
+	case mcp.JSONRPCResponse:
+		result := response.Result.(mcp.ReadResourceResult)
+		return result.Contents[0].(mcp.TextResourceContents).Text, nil
+	case mcp.JSONRPCError:
+		return "", &response
+	default:
+		t.Fatalf("Unexpected response %T", response)
+		return "", nil
+	}
+}
+
+func TestResources(t *testing.T) {
+	resetSchemaCache(t)
+	schema := `{"Name":"StormEvents","OrderedColumns":[{"Name":"State","Type":"System.String","CslType":"string"}]}`
+	client := &fakeClient{mgmt: map[string]fakeTable{
+		".show tables":                           {columns: []string{"TableName", "DatabaseName"}, rows: [][]any{{"StormEvents", "Samples"}}},
+		".show table StormEvents schema as json": {columns: []string{"TableName", "Schema"}, rows: [][]any{{"StormEvents", schema}}},
+		".show function TopStates": {
+			columns: []string{"Name", "Parameters", "Body", "Folder", "DocString"},
+			rows:    [][]any{{"TopStates", "(n:long)", "{ StormEvents | top n by State }", "Reports", "Top states"}},
+		},
+	}}
+
+	s := server.NewMCPServer("test", "0.0.1")
+	s.AddResourceTemplate(DatabaseResource(client.factory))
+	s.AddResourceTemplate(TableSchemaResource(client.factory))
+	s.AddResourceTemplate(FunctionResource(client.factory))
+
+	text, rpcError := readResource(t, s, "kusto://fake/Samples")
+	if rpcError != nil || text != `{"cluster":"fake","database":"Samples","tables":["StormEvents"]}` {
+		t.Fatalf("Unexpected database catalog %s, %+v", text, rpcError)
+	}
+
+	text, rpcError = readResource(t, s, "kusto://fake/Samples/tables/StormEvents/schema")
+	if rpcError != nil || text != schema {
+		t.Fatalf("Unexpected table schema %s, %+v", text, rpcError)
+	}
+
+	text, rpcError = readResource(t, s, "kusto://fake/Samples/functions/TopStates")
+	var function FunctionResponse
+	if rpcError != nil || json.Unmarshal([]byte(text), &function) != nil {
+		t.Fatalf("Unexpected function %s, %+v", text, rpcError)
+	}
+	if function.Name != "TopStates" || function.Signature != "(n:long)" || len(function.Parameters) != 1 || function.Folder != "Reports" || function.Database != "Samples" {
+		t.Fatalf("Unexpected function %+v", function)
+	}
+
+	_, rpcError = readResource(t, s, "kusto://fake/Samples/tables/Unknown/schema")
+	if rpcError == nil || !strings.Contains(rpcError.Error.Message, "kusto://fake/Samples/tables/Unknown/schema") {
+		t.Fatalf("Expected an error naming the resource, got %+v", rpcError)
+	}
+}
@@ -0,0 +1,193 @@
+package tools
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+)
+
+var errResultNotFound = errors.New("the result of this cursor has expired or was evicted, run the query again")
+
+// storedResult is a query result kept for fetching later pages.
+type storedResult struct {
+	id string
+	// callerID is the caller that ran the query, the only one that can fetch the result
+	callerID string
+	tables   []ResultTable
+	size     int
+	expires  time.Time
+	element  *list.Element
+}
+
+// resultStore keeps query results in memory for a limited time so that the pages of a large
+// result can be fetched without running the query again. When it is full, the least recently
+// used results are evicted.
+type resultStore struct {
+	mu      sync.Mutex
+	results map[string]*storedResult
+	// lru holds the result ids, most recently used first
+	lru  *list.List
+	size int
+	now  func() time.Time
+}
+
+func newResultStore() *resultStore {
+	return &resultStore{results: map[string]*storedResult{}, lru: list.New(), now: time.Now}
+}
+
+var results = newResultStore()
+
+// put stores the tables for the caller and returns the id of the stored result.
+func (s *resultStore) put(callerID string, tables []ResultTable, ttl time.Duration, maxResults, maxBytes int) (string, error) {
+	size := 0
+	for _, table := range tables {
+		_, tableSize := rowsWithin(table.Rows, math.MaxInt)
+		size += tableSize
+	}
+	if size > maxBytes {
+		return "", fmt.Errorf("result of %d bytes is too large to keep for pagination", size)
+	}
+
+	id, err := newResultID()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeExpired()
+	for s.lru.Len() > 0 && (s.lru.Len() >= maxResults || s.size+size > maxBytes) {
+		s.remove(s.results[s.lru.Back().Value.(string)])
+	}
+
+	result := &storedResult{id: id, callerID: callerID, tables: tables, size: size, expires: s.now().Add(ttl)}
+	result.element = s.lru.PushFront(id)
+	s.results[id] = result
+	s.size += size
+
+	return id, nil
+}
+
+// get returns the tables of a stored result that has not expired. The results of other callers are not found.
+func (s *resultStore) get(callerID, id string) ([]ResultTable, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeExpired()
+	result, ok := s.results[id]
+	if !ok || result.callerID != callerID {
+		return nil, errResultNotFound
+	}
+	s.lru.MoveToFront(result.element)
+	return result.tables, nil
+}
+
+func (s *resultStore) removeExpired() {
+	now := s.now()
+	for _, result := range s.results {
+		if !now.Before(result.expires) {
+			s.remove(result)
+		}
+	}
+}
+
+func (s *resultStore) remove(result *storedResult) {
+	s.lru.Remove(result.element)
+	delete(s.results, result.id)
+	s.size -= result.size
+}
+
+func newResultID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// cursor points at the first row of the next page of a stored result.
+type cursor struct {
+	ResultID string `json:"r"`
+	Table    int    `json:"t"`
+	Row      int    `json:"o"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.ResultID == "" || c.Table < 0 || c.Row < 0 {
+		return c, errors.New("invalid cursor, pass the cursor returned by execute_query or fetch_results unchanged")
+	}
+	return c, nil
+}
+
+// resultPage returns the rows of the result starting at the position of the cursor that fit the result budget,
+// and the position of the next page if there are rows left.
+func resultPage(tables []ResultTable, start cursor) (QueryResponse, *cursor, error) {
+	if start.Table >= len(tables) || start.Row > len(tables[start.Table].Rows) {
+		return QueryResponse{}, nil, errors.New("invalid cursor, it points past the end of the result")
+	}
+
+	// the page gets its own row slices since applyBudget cuts them down
+	page := []ResultTable{}
+	for i, table := range tables[start.Table:] {
+		offset := 0
+		if i == 0 {
+			offset = start.Row
+		}
+		page = append(page, ResultTable{Name: table.Name, Columns: table.Columns, Rows: slices.Clone(table.Rows[offset:])})
+	}
+
+	maxRows, maxBytes := common.GetConfig().ResultBudget()
+	truncated := applyBudget(page, maxRows, maxBytes)
+
+	// a single row over the byte budget is returned anyway, so that every page makes progress
+	if len(page[0].Rows) == 0 && start.Row < len(tables[start.Table].Rows) {
+		page[0].Rows = page[0].Rows[:1]
+		page[0].Truncation.ReturnedRows = 1
+	}
+
+	var next *cursor
+	for i := range page {
+		total := len(tables[start.Table+i].Rows)
+		offset := 0
+		if i == 0 {
+			offset = start.Row
+		}
+
+		if offset > 0 && page[i].Truncation == nil {
+			page[i].Truncation = &TableTruncation{ReturnedRows: len(page[i].Rows)}
+		}
+		if page[i].Truncation == nil {
+			continue
+		}
+		page[i].Truncation.TotalRows = total
+		page[i].Truncation.Offset = offset
+
+		// later tables are returned on the next pages
+		if returned := offset + page[i].Truncation.ReturnedRows; returned < total {
+			next = &cursor{Table: start.Table + i, Row: returned}
+			page = page[:i+1]
+			break
+		}
+	}
+
+	return QueryResponse{Tables: page, Truncated: truncated || start.Table > 0 || start.Row > 0}, next, nil
+}
@@ -0,0 +1,177 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func newTestResultStore() (*resultStore, *time.Time) {
+	now := time.Now()
+	store := newResultStore()
+	store.now = func() time.Time { return now }
+	return store, &now
+}
+
+func TestResultStoreExpires(t *testing.T) {
+	store, now := newTestResultStore()
+
+	id, err := store.put("", []ResultTable{testBudgetTable(3)}, time.Minute, 10, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.get("", id); err != nil {
+		t.Fatalf("Expected stored result, got %v", err)
+	}
+
+	*now = now.Add(time.Minute)
+	if _, err := store.get("", id); !errors.Is(err, errResultNotFound) {
+		t.Fatalf("Expected expired result, got %v", err)
+	}
+	if store.size != 0 || store.lru.Len() != 0 {
+		t.Fatalf("Expected expired result to be removed, size %d, entries %d", store.size, store.lru.Len())
+	}
+}
+
+func TestResultStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	store, _ := newTestResultStore()
+
+	first, _ := store.put("", []ResultTable{testBudgetTable(1)}, time.Minute, 2, 1<<20)
+	second, _ := store.put("", []ResultTable{testBudgetTable(1)}, time.Minute, 2, 1<<20)
+
+	// using the first result makes the second one the least recently used
+	if _, err := store.get("", first); err != nil {
+		t.Fatal(err)
+	}
+	third, _ := store.put("", []ResultTable{testBudgetTable(1)}, time.Minute, 2, 1<<20)
+
+	if _, err := store.get("", second); err == nil {
+		t.Fatal("Expected least recently used result to be evicted")
+	}
+	for _, id := range []string{first, third} {
+		if _, err := store.get("", id); err != nil {
+			t.Fatalf("Expected result %s to be kept, got %v", id, err)
+		}
+	}
+
+	// evicting by size
+	if _, err := store.put("", []ResultTable{testBudgetTable(3)}, time.Minute, 10, 3500); err != nil {
+		t.Fatal(err)
+	}
+	if store.lru.Len() != 1 {
+		t.Fatalf("Expected other results to be evicted to make room, got %d results", store.lru.Len())
+	}
+
+	if _, err := store.put("", []ResultTable{testBudgetTable(10)}, time.Minute, 10, 3500); err == nil {
+		t.Fatal("Expected result over the size limit to be rejected")
+	}
+}
+
+func TestResultStoreIsPerCaller(t *testing.T) {
+	store, _ := newTestResultStore()
+
+	id, err := store.put("alice", []ResultTable{testBudgetTable(3)}, time.Minute, 10, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, caller := range []string{"mallory", ""} {
+		if _, err := store.get(caller, id); !errors.Is(err, errResultNotFound) {
+			t.Fatalf("Expected the result to be hidden from caller %q, got %v", caller, err)
+		}
+	}
+	if _, err := store.get("alice", id); err != nil {
+		t.Fatalf("Expected the result for its caller, got %v", err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	c := cursor{ResultID: "abc", Table: 1, Row: 500}
+
+	decoded, err := decodeCursor(c.encode())
+	if err != nil || decoded != c {
+		t.Fatalf("Expected %+v, got %+v, %v", c, decoded, err)
+	}
+
+	for _, invalid := range []string{"", "not a cursor", cursor{Table: 1}.encode(), cursor{ResultID: "abc", Row: -1}.encode()} {
+		if _, err := decodeCursor(invalid); err == nil {
+			t.Fatalf("Expected cursor %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestResultPages(t *testing.T) {
+	common.SetConfig(common.Config{MaxResultRows: 40})
+	defer common.SetConfig(common.Config{})
+
+	tables := []ResultTable{testBudgetTable(100), testBudgetTable(10)}
+	tables[1].Name = "Table_1"
+
+	seen := map[string]int{}
+	start := cursor{}
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("Expected pagination to end")
+		}
+
+		response, next, err := resultPage(tables, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !response.Truncated {
+			t.Fatal("Expected every page to be marked as truncated")
+		}
+		for _, table := range response.Tables {
+			seen[table.Name] += len(table.Rows)
+		}
+
+		if next == nil {
+			break
+		}
+		start = *next
+	}
+
+	if seen["PrimaryResult"] != 100 || seen["Table_1"] != 10 {
+		t.Fatalf("Expected every row once, got %v", seen)
+	}
+}
+
+func TestFetchResultsHandler(t *testing.T) {
+	common.SetConfig(common.Config{MaxResultRows: 40})
+	defer common.SetConfig(common.Config{})
+
+	tables := []ResultTable{testBudgetTable(100)}
+	id, err := results.put("", tables, time.Minute, 10, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "fetch_results"
+	request.Params.Arguments = map[string]any{"cursor": cursor{ResultID: id, Row: 40}.encode(), "format": formatMarkdown}
+
+	result, err := fetchResultsHandler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("fetchResultsHandler failed: %v", err)
+	}
+
+	text := result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(text, "has 100 rows, 40 returned starting at row 40.") || !strings.Contains(text, "call fetch_results with cursor: "+cursor{ResultID: id, Row: 80}.encode()) {
+		t.Fatalf("Unexpected page: %s", text)
+	}
+
+	// the cursor is only valid for the caller that ran the query
+	other := common.WithCaller(context.Background(), common.Caller{ID: "other", Name: "other"})
+	if _, err := fetchResultsHandler(other, request); !errors.Is(err, errResultNotFound) {
+		t.Fatalf("Expected the result of another caller not to be found, got %v", err)
+	}
+
+	request.GetArguments()["cursor"] = cursor{ResultID: "unknown"}.encode()
+	if _, err := fetchResultsHandler(context.Background(), request); !errors.Is(err, errResultNotFound) {
+		t.Fatalf("Expected unknown result error, got %v", err)
+	}
+}
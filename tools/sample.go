@@ -0,0 +1,264 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// The limits of sample_table, which is meant to show what the data looks like rather than to return data.
+const (
+	defaultSampleRows     = 10
+	maxSampleRows         = 100
+	defaultMaxCellLength  = 256
+	sampleMethodTake      = "take"
+	sampleMethodSample    = "sample"
+	truncatedCellEllipsis = "…"
+)
+
+// SampleTable returns a tool that returns a few rows of a table, to see what its data looks like.
+func SampleTable(clients common.ClientFactory) (mcp.Tool, server.ToolHandlerFunc) {
+
+	return sampleTable(), sampleTableHandler(clients)
+}
+
+func sampleTable() mcp.Tool {
+
+	return mcp.NewTool("sample_table",
+
+		mcp.WithString("cluster",
+			mcp.Description(clusterParameterDescription()),
+		),
+		mcp.WithString("database",
+			mcp.Description(databaseParameterDescription("Name of the database.")),
+		),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Name of the table, materialized view or external table to sample."),
+		),
+		mcp.WithString("kind",
+			mcp.Description("Kind of the entity, as returned by list_entities. Defaults to table."),
+			mcp.Enum(entityKinds...),
+		),
+		mcp.WithNumber("rows",
+			mcp.Description(fmt.Sprintf("Number of rows to return, at most %d. Defaults to %d.", maxSampleRows, defaultSampleRows)),
+		),
+		mcp.WithArray("columns",
+			mcp.Description("Names of the columns to return. Defaults to all columns."),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("time_column",
+			mcp.Description("Name of a datetime column to filter on with lookback."),
+		),
+		mcp.WithString("lookback",
+			mcp.Description("Only sample rows whose time_column is within this timespan before now, e.g. 1h, 1d or 7d. Requires time_column."),
+		),
+		mcp.WithString("method",
+			mcp.Description("take returns any rows, which is fastest. sample returns random rows, which are more representative but take longer on large tables. Defaults to take."),
+			mcp.Enum(sampleMethodTake, sampleMethodSample),
+		),
+		mcp.WithNumber("max_cell_length",
+			mcp.Description(fmt.Sprintf("Strings and dynamic values longer than this many characters are cut off. Defaults to %d.", defaultMaxCellLength)),
+		),
+		mcp.WithDescription("Return a few rows of a table to see what its data looks like before writing a query. The tool is read-only and builds the query itself, so it can be used instead of running T | take 10 with execute_query."),
+		mcp.WithToolAnnotation(mcp.ToolAnnotation{
+			Title:           "Sample table rows",
+			ReadOnlyHint:    mcp.ToBoolPtr(true),
+			DestructiveHint: mcp.ToBoolPtr(false),
+			IdempotentHint:  mcp.ToBoolPtr(false),
+			OpenWorldHint:   mcp.ToBoolPtr(true),
+		}),
+	)
+}
+
+// SampleTableResponse is the response of sample_table.
+type SampleTableResponse struct {
+	Cluster  string `json:"cluster"`
+	Database string `json:"database"`
+	// Query is the query that returned the sample, a starting point for execute_query. The lookback is
+	// passed to it as the query parameter lookback.
+	Query  string      `json:"query"`
+	Sample ResultTable `json:"sample"`
+	// TruncatedCells is the number of values that were cut off at max_cell_length.
+	TruncatedCells int `json:"truncatedCells,omitempty"`
+}
+
+func sampleTableHandler(clients common.ClientFactory) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+
+		cluster, err := resolveCluster(request)
+		if err != nil {
+			return nil, err
+		}
+
+		dbName, err := resolveDatabase(request, cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		table, ok := request.GetArguments()["table"].(string)
+		if !ok || table == "" {
+			return nil, errors.New("table name missing")
+		}
+
+		kind, err := entityKind(request)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := intArgument(request, "rows", defaultSampleRows)
+		if err != nil {
+			return nil, err
+		}
+		if rows > maxSampleRows {
+			return nil, fmt.Errorf("rows must be at most %d, use execute_query to return more rows", maxSampleRows)
+		}
+
+		maxCellLength, err := intArgument(request, "max_cell_length", defaultMaxCellLength)
+		if err != nil {
+			return nil, err
+		}
+
+		columns, err := stringListArgument(request, "columns")
+		if err != nil {
+			return nil, err
+		}
+
+		method, _ := request.GetArguments()["method"].(string)
+		if method == "" {
+			method = sampleMethodTake
+		}
+		if method != sampleMethodTake && method != sampleMethodSample {
+			return nil, fmt.Errorf("unsupported method %s, expected %s or %s", method, sampleMethodTake, sampleMethodSample)
+		}
+
+		// names are quoted and the lookback is passed as a query parameter, so nothing from the arguments becomes KQL
+		filter, parameters, err := lookbackFilter(request)
+		if err != nil {
+			return nil, err
+		}
+		sampleQuery := entitySource(table, kind) + filter
+		if len(columns) > 0 {
+			quoted := []string{}
+			for _, column := range columns {
+				quoted = append(quoted, quoteIdentifier(column))
+			}
+			sampleQuery += " | project " + strings.Join(quoted, ", ")
+		}
+		sampleQuery += fmt.Sprintf(" | %s %d", method, rows)
+
+		client, err := clients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		options := append(serverTimeout(ctx), azkustodata.RequestReadonly())
+		if parameters.Count() > 0 {
+			options = append(options, azkustodata.QueryParameters(parameters))
+		}
+
+		dataset, err := client.Query(ctx, dbName, kql.New("").AddUnsafe(sampleQuery), options...)
+		if err != nil {
+			return nil, queryError(ctx, err)
+		}
+
+		tables := primaryResults(dataset)
+		if len(tables) == 0 {
+			return nil, fmt.Errorf("no result returned for %s", sampleQuery)
+		}
+
+		// the cells are cut first, so that the budget keeps as many rows as possible
+		truncatedCells := truncateCells(tables[0].Rows, maxCellLength)
+		maxRows, maxBytes := common.GetConfig().ResultBudget()
+		applyBudget(tables[:1], maxRows, maxBytes)
+
+		response := SampleTableResponse{Cluster: cluster.Name, Database: dbName, Query: sampleQuery, Sample: tables[0], TruncatedCells: truncatedCells}
+
+		jsonResult, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+}
+
+// entitySource returns the source of a query that reads an entity. External tables are read with
+// external_table(), tables and materialized views by their name.
+func entitySource(table, kind string) string {
+	if kind == kindExternalTable {
+		return "external_table(" + quoteString(table) + ")"
+	}
+	return quoteIdentifier(table)
+}
+
+// lookbackFilter returns a where operator for the time_column and lookback arguments, with the lookback
+// as a query parameter, or an empty filter if they are not set.
+func lookbackFilter(request mcp.CallToolRequest) (string, *kql.Parameters, error) {
+	parameters := kql.NewParameters()
+
+	timeColumn, _ := request.GetArguments()["time_column"].(string)
+	lookback, _ := request.GetArguments()["lookback"].(string)
+	if (timeColumn == "") != (lookback == "") {
+		return "", nil, errors.New("time_column and lookback are only used together")
+	}
+	if lookback == "" {
+		return "", parameters, nil
+	}
+
+	value, err := parameterValue(lookback, "timespan")
+	if err != nil {
+		return "", nil, fmt.Errorf("lookback: %w", err)
+	}
+	parameters.AddValue("lookback", value)
+	return " | where " + quoteIdentifier(timeColumn) + " > ago(lookback)", parameters, nil
+}
+
+// intArgument returns a positive whole number argument, or the default if it is not set.
+func intArgument(request mcp.CallToolRequest, name string, defaultValue int) (int, error) {
+	value, ok := request.GetArguments()[name]
+	if !ok || value == nil {
+		return defaultValue, nil
+	}
+	number, ok := value.(float64)
+	if !ok || number < 1 || number != float64(int(number)) {
+		return 0, fmt.Errorf("%s must be a positive whole number", name)
+	}
+	return int(number), nil
+}
+
+// truncateCells cuts strings and dynamic values down to maxLength characters and returns how many were cut.
+// Dynamic values that are cut become strings, as they are no longer valid JSON.
+func truncateCells(rows [][]any, maxLength int) int {
+	truncated := 0
+	for _, row := range rows {
+		for i, v := range row {
+			var text string
+			switch v := v.(type) {
+			case string:
+				text = v
+			case json.RawMessage:
+				text = string(v)
+			default:
+				continue
+			}
+
+			if utf8.RuneCountInString(text) <= maxLength {
+				continue
+			}
+			row[i] = string([]rune(text)[:maxLength]) + truncatedCellEllipsis
+			truncated++
+		}
+	}
+	return truncated
+}
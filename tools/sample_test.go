@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/types"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestSampleTableHandlerWithFakeClient(t *testing.T) {
+	client := &fakeClient{query: fakeTable{
+		columns: []string{"State", "EpisodeNarrative"},
+		types:   []types.Column{types.String, types.String},
+		rows:    [][]any{{"TEXAS", strings.Repeat("a", 300)}, {"KANSAS", "short"}},
+	}}
+
+	request := fakeRequest("sample_table", map[string]any{
+		"cluster":         "fake",
+		"database":        "Samples",
+		"table":           "Storm Events",
+		"rows":            float64(2),
+		"columns":         []any{"State", "EpisodeNarrative"},
+		"time_column":     "StartTime",
+		"lookback":        "7d",
+		"method":          "sample",
+		"max_cell_length": float64(100),
+	})
+	result, err := sampleTableHandler(client.factory)(context.Background(), request)
+	text := resultText(t, result, err)
+
+	var response SampleTableResponse
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+
+	expected := "['Storm Events'] | where ['StartTime'] > ago(lookback) | project ['State'], ['EpisodeNarrative'] | sample 2"
+	if response.Query != expected || len(client.queries) != 1 || client.queries[0] != expected {
+		t.Fatalf("Expected query %s, got %s (queries %v)", expected, response.Query, client.queries)
+	}
+	if len(response.Sample.Rows) != 2 || response.TruncatedCells != 1 || response.Sample.Rows[0][1] != strings.Repeat("a", 100)+truncatedCellEllipsis {
+		t.Fatalf("Unexpected sample %+v", response)
+	}
+}
+
+func TestSampleExternalTable(t *testing.T) {
+	client := &fakeClient{query: fakeTable{columns: []string{"State"}, types: []types.Column{types.String}, rows: [][]any{{"TEXAS"}}}}
+
+	request := fakeRequest("sample_table", map[string]any{"cluster": "fake", "database": "Samples", "table": "Archived 'Storms'", "kind": kindExternalTable})
+	result, err := sampleTableHandler(client.factory)(context.Background(), request)
+	resultText(t, result, err)
+
+	if expected := `external_table('Archived \'Storms\'') | take 10`; len(client.queries) != 1 || client.queries[0] != expected {
+		t.Fatalf("Expected query %s, got %v", expected, client.queries)
+	}
+}
+
+func TestSampleTableRejectsArguments(t *testing.T) {
+	client := &fakeClient{}
+
+	for _, arguments := range []map[string]any{
+		{"table": "StormEvents", "rows": float64(1000)},
+		{"table": "StormEvents", "rows": float64(-1)},
+		{"table": "StormEvents", "lookback": "1d"},
+		{"table": "StormEvents", "time_column": "StartTime", "lookback": "yesterday"},
+		{"table": "StormEvents", "method": "top"},
+		{"table": "StormEvents", "columns": "State"},
+		{"table": "StormEvents", "kind": "function"},
+		{},
+	} {
+		arguments["cluster"] = "fake"
+		arguments["database"] = "Samples"
+		if _, err := sampleTableHandler(client.factory)(context.Background(), fakeRequest("sample_table", arguments)); err == nil {
+			t.Fatalf("Expected %v to be rejected", arguments)
+		}
+	}
+	if len(client.queries) != 0 {
+		t.Fatalf("Expected no queries, got %v", client.queries)
+	}
+
+	if annotations := sampleTable().Annotations; !*annotations.ReadOnlyHint || *annotations.DestructiveHint {
+		t.Fatalf("Expected sample_table to be marked read-only, got %+v", annotations)
+	}
+}
+
+func TestTruncateCells(t *testing.T) {
+	rows := [][]any{{"äöü", json.RawMessage(`{"a":[1,2,3]}`), int64(1234567), nil}}
+
+	if truncated := truncateCells(rows, 2); truncated != 2 {
+		t.Fatalf("Expected 2 truncated cells, got %d", truncated)
+	}
+	if rows[0][0] != "äö"+truncatedCellEllipsis || rows[0][1] != `{"`+truncatedCellEllipsis || rows[0][2] != int64(1234567) {
+		t.Fatalf("Unexpected cells %v", rows[0])
+	}
+}
+
+func TestSampleTableHandler(t *testing.T) {
+	request := mcp.CallToolRequest{
+		Params: mcp.CallToolParams{
+			Name: "sample_table",
+			Arguments: map[string]any{
+				"cluster":  os.Getenv("CLUSTER_NAME"),
+				"database": os.Getenv("DB_NAME"),
+				"table":    os.Getenv("TABLE_NAME"),
+				"rows":     float64(3),
+			},
+		},
+	}
+
+	result, err := sampleTableHandler(testClients)(context.Background(), request)
+	if err != nil {
+		t.Fatalf("sampleTableHandler failed: %v", err)
+	}
+
+	var response SampleTableResponse
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+	if len(response.Sample.Rows) == 0 || len(response.Sample.Rows) > 3 {
+		t.Fatalf("Expected up to 3 rows, got %d", len(response.Sample.Rows))
+	}
+}
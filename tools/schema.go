@@ -0,0 +1,300 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// GetDatabaseSchema returns a tool that retrieves the schema of every entity of a database in one call.
+func GetDatabaseSchema(clients common.ClientFactory) (mcp.Tool, server.ToolHandlerFunc) {
+
+	return getDatabaseSchema(), getDatabaseSchemaHandler(clients)
+}
+
+func getDatabaseSchema() mcp.Tool {
+
+	return mcp.NewTool("get_database_schema",
+
+		mcp.WithString("cluster",
+			mcp.Description(clusterParameterDescription()),
+		),
+		mcp.WithString("database",
+			mcp.Description(databaseParameterDescription("Name of the database.")),
+		),
+		mcp.WithString("name_pattern",
+			mcp.Description("Only return the tables, materialized views, external tables and functions whose name matches this case-insensitive wildcard pattern, e.g. Storm* or *Events."),
+		),
+		mcp.WithNumber("max_bytes",
+			mcp.Description("Maximum size of the response in bytes. Entities that do not fit are omitted and counted. Defaults to the result budget of the server."),
+		),
+		mcp.WithDescription("Get the schema of a whole Azure Data Explorer database in one call: every table, materialized view and external table with its columns (as name:type) and docstrings, and the signature of every stored function. Prefer it over calling get_table_schema for many tables."),
+	)
+}
+
+// DatabaseSchemaResponse is the compact schema of a database.
+type DatabaseSchemaResponse struct {
+	Cluster           string              `json:"cluster"`
+	Database          string              `json:"database"`
+	Tables            []EntitySchema      `json:"tables"`
+	MaterializedViews []EntitySchema      `json:"materializedViews,omitempty"`
+	ExternalTables    []EntitySchema      `json:"externalTables,omitempty"`
+	Functions         []FunctionSignature `json:"functions,omitempty"`
+	// Omitted is the number of entities left out to stay within the size cap.
+	Omitted int    `json:"omitted,omitempty"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// EntitySchema is the schema of a table, materialized view or external table.
+type EntitySchema struct {
+	Name      string `json:"name"`
+	Folder    string `json:"folder,omitempty"`
+	DocString string `json:"docString,omitempty"`
+	// SourceTable is the source of a materialized view.
+	SourceTable string `json:"sourceTable,omitempty"`
+	// Columns are name:type pairs, e.g. StartTime:datetime.
+	Columns []string `json:"columns"`
+	// ColumnDocs holds the docstrings of the columns that have one.
+	ColumnDocs map[string]string `json:"columnDocs,omitempty"`
+}
+
+// FunctionSignature describes a stored function without its body.
+type FunctionSignature struct {
+	Name string `json:"name"`
+	// Parameters is the parameter list, e.g. (state:string, limit:long = 10).
+	Parameters string `json:"parameters"`
+	Folder     string `json:"folder,omitempty"`
+	DocString  string `json:"docString,omitempty"`
+}
+
+// databaseSchemaJSON is the result of .show database D schema as json.
+type databaseSchemaJSON struct {
+	Databases map[string]struct {
+		Tables            map[string]entitySchemaJSON   `json:"Tables"`
+		MaterializedViews map[string]entitySchemaJSON   `json:"MaterializedViews"`
+		ExternalTables    map[string]entitySchemaJSON   `json:"ExternalTables"`
+		Functions         map[string]functionSchemaJSON `json:"Functions"`
+	} `json:"Databases"`
+}
+
+type entitySchemaJSON struct {
+	Name           string             `json:"Name"`
+	Folder         string             `json:"Folder"`
+	DocString      string             `json:"DocString"`
+	SourceTable    string             `json:"SourceTable"`
+	OrderedColumns []columnSchemaJSON `json:"OrderedColumns"`
+}
+
+type columnSchemaJSON struct {
+	Name      string `json:"Name"`
+	CslType   string `json:"CslType"`
+	DocString string `json:"DocString"`
+}
+
+type functionSchemaJSON struct {
+	Name            string                `json:"Name"`
+	Folder          string                `json:"Folder"`
+	DocString       string                `json:"DocString"`
+	InputParameters []parameterSchemaJSON `json:"InputParameters"`
+}
+
+type parameterSchemaJSON struct {
+	Name            string  `json:"Name"`
+	CslType         string  `json:"CslType"`
+	CslDefaultValue *string `json:"CslDefaultValue"`
+	// Columns are the columns of a tabular parameter.
+	Columns []columnSchemaJSON `json:"Columns"`
+}
+
+func getDatabaseSchemaHandler(clients common.ClientFactory) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+
+		cluster, err := resolveCluster(request)
+		if err != nil {
+			return nil, err
+		}
+
+		dbName, err := resolveDatabase(request, cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		pattern, _ := request.GetArguments()["name_pattern"].(string)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q: %w", pattern, err)
+		}
+
+		_, maxBytes := common.GetConfig().ResultBudget()
+		if value, ok := request.GetArguments()["max_bytes"].(float64); ok {
+			if value <= 0 {
+				return nil, errors.New("max_bytes must be positive")
+			}
+			maxBytes = int(value)
+		}
+
+		client, err := clients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		// AddDatabase would produce database("name"), which is a query expression, so the name is quoted as an identifier
+		command := kql.New(".show database ").AddTable(dbName).AddLiteral(" schema as json")
+		dataset, err := client.Mgmt(ctx, dbName, command, serverTimeout(ctx)...)
+		if err != nil {
+			return nil, err
+		}
+
+		rows := dataset.Tables()[0].Rows()
+		if len(rows) == 0 {
+			return nil, fmt.Errorf("no schema returned for database %s", dbName)
+		}
+		jsonSchema, err := rows[0].StringByName("DatabaseSchema")
+		if err != nil {
+			return nil, err
+		}
+
+		var schema databaseSchemaJSON
+		if err := json.Unmarshal([]byte(jsonSchema), &schema); err != nil {
+			return nil, fmt.Errorf("error parsing database schema: %w", err)
+		}
+
+		response := DatabaseSchemaResponse{Cluster: cluster.Name, Database: dbName, Tables: []EntitySchema{}}
+		for _, db := range schema.Databases {
+			tables := compactEntities(db.Tables, pattern)
+			views := compactEntities(db.MaterializedViews, pattern)
+			externalTables := compactEntities(db.ExternalTables, pattern)
+			functions := functionSignatures(db.Functions, pattern)
+
+			fitSchema(&response, tables, views, externalTables, functions, maxBytes)
+		}
+
+		jsonResult, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+}
+
+// matchName reports whether the name matches the case-insensitive wildcard pattern. An empty pattern matches every name.
+func matchName(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return matched
+}
+
+func compactEntities(entities map[string]entitySchemaJSON, pattern string) []EntitySchema {
+	result := []EntitySchema{}
+	for _, entity := range entities {
+		if !matchName(pattern, entity.Name) {
+			continue
+		}
+
+		compact := EntitySchema{Name: entity.Name, Folder: entity.Folder, DocString: entity.DocString, SourceTable: entity.SourceTable, Columns: []string{}}
+		for _, column := range entity.OrderedColumns {
+			compact.Columns = append(compact.Columns, column.Name+":"+column.CslType)
+			if column.DocString != "" {
+				if compact.ColumnDocs == nil {
+					compact.ColumnDocs = map[string]string{}
+				}
+				compact.ColumnDocs[column.Name] = column.DocString
+			}
+		}
+		result = append(result, compact)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func functionSignatures(functions map[string]functionSchemaJSON, pattern string) []FunctionSignature {
+	result := []FunctionSignature{}
+	for _, function := range functions {
+		if !matchName(pattern, function.Name) {
+			continue
+		}
+		result = append(result, FunctionSignature{Name: function.Name, Parameters: parameterList(function.InputParameters), Folder: function.Folder, DocString: function.DocString})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// parameterList formats parameters the way .show functions does, e.g. (T:(State:string), limit:long = 10).
+func parameterList(parameters []parameterSchemaJSON) string {
+	formatted := []string{}
+	for _, parameter := range parameters {
+		parameterType := parameter.CslType
+		if parameterType == "" && len(parameter.Columns) > 0 {
+			columns := []string{}
+			for _, column := range parameter.Columns {
+				columns = append(columns, column.Name+":"+column.CslType)
+			}
+			parameterType = "(" + strings.Join(columns, ", ") + ")"
+		} else if parameterType == "" {
+			parameterType = "(*)"
+		}
+
+		parameterText := parameter.Name + ":" + parameterType
+		if parameter.CslDefaultValue != nil {
+			parameterText += " = " + *parameter.CslDefaultValue
+		}
+		formatted = append(formatted, parameterText)
+	}
+	return "(" + strings.Join(formatted, ", ") + ")"
+}
+
+// fitSchema adds the entities to the response until it reaches maxBytes of JSON. Tables come first, as they are
+// queried most, followed by materialized views, external tables and functions. The remaining entities are counted.
+func fitSchema(response *DatabaseSchemaResponse, tables, views, externalTables []EntitySchema, functions []FunctionSignature, maxBytes int) {
+	empty, _ := json.Marshal(response)
+	size := len(empty)
+
+	fits := func(entity any) bool {
+		data, err := json.Marshal(entity)
+		if err != nil || size+len(data)+1 > maxBytes {
+			response.Omitted++
+			return false
+		}
+		size += len(data) + 1
+		return true
+	}
+
+	for _, table := range tables {
+		if fits(table) {
+			response.Tables = append(response.Tables, table)
+		}
+	}
+	for _, view := range views {
+		if fits(view) {
+			response.MaterializedViews = append(response.MaterializedViews, view)
+		}
+	}
+	for _, externalTable := range externalTables {
+		if fits(externalTable) {
+			response.ExternalTables = append(response.ExternalTables, externalTable)
+		}
+	}
+	for _, function := range functions {
+		if fits(function) {
+			response.Functions = append(response.Functions, function)
+		}
+	}
+
+	if response.Omitted > 0 {
+		response.Hint = fmt.Sprintf("%d entities were omitted to stay within %d bytes. Use name_pattern to get the schema of the others.", response.Omitted, maxBytes)
+	}
+}
@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const testDatabaseSchema = `{"Databases":{"Samples":{"Name":"Samples",
+"Tables":{
+	"StormEvents":{"Name":"StormEvents","EntityType":"Table","Folder":"Weather","DocString":"US storms","OrderedColumns":[
+		{"Name":"StartTime","Type":"System.DateTime","CslType":"datetime","DocString":"Start of the event"},
+		{"Name":"State","Type":"System.String","CslType":"string"}]},
+	"PopulationData":{"Name":"PopulationData","EntityType":"Table","OrderedColumns":[{"Name":"State","Type":"System.String","CslType":"string"}]}},
+"MaterializedViews":{
+	"DailyStorms":{"Name":"DailyStorms","EntityType":"MaterializedView","SourceTable":"StormEvents","OrderedColumns":[{"Name":"Day","Type":"System.DateTime","CslType":"datetime"}]}},
+"ExternalTables":{
+	"ArchivedStorms":{"Name":"ArchivedStorms","EntityType":"ExternalTable","OrderedColumns":[{"Name":"State","Type":"System.String","CslType":"string"}]}},
+"Functions":{
+	"StormsIn":{"Name":"StormsIn","Body":"{ StormEvents | where State == state | take limit }","Folder":"Reports","DocString":"Storms of a state","InputParameters":[
+		{"Name":"state","Type":"System.String","CslType":"string","CslDefaultValue":null},
+		{"Name":"limit","Type":"System.Int64","CslType":"long","CslDefaultValue":"10"}]},
+	"StateCounts":{"Name":"StateCounts","Body":"{ T | count }","InputParameters":[{"Name":"T","Columns":[{"Name":"State","Type":"System.String","CslType":"string"}]}]}}
+}}}`
+
+func databaseSchemaClient() *fakeClient {
+	return &fakeClient{mgmt: map[string]fakeTable{
+		".show database Samples schema as json": {columns: []string{"DatabaseSchema"}, rows: [][]any{{testDatabaseSchema}}},
+	}}
+}
+
+func getDatabaseSchemaResponse(t *testing.T, client *fakeClient, arguments map[string]any) DatabaseSchemaResponse {
+	t.Helper()
+
+	arguments["cluster"] = "fake"
+	arguments["database"] = "Samples"
+	result, err := getDatabaseSchemaHandler(client.factory)(context.Background(), fakeRequest("get_database_schema", arguments))
+	text := resultText(t, result, err)
+
+	var response DatabaseSchemaResponse
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+	return response
+}
+
+func TestGetDatabaseSchemaHandlerWithFakeClient(t *testing.T) {
+	response := getDatabaseSchemaResponse(t, databaseSchemaClient(), map[string]any{})
+
+	if len(response.Tables) != 2 || response.Tables[1].Name != "StormEvents" {
+		t.Fatalf("Expected the tables sorted by name, got %+v", response.Tables)
+	}
+	storms := response.Tables[1]
+	if strings.Join(storms.Columns, ",") != "StartTime:datetime,State:string" || storms.ColumnDocs["StartTime"] != "Start of the event" || storms.Folder != "Weather" {
+		t.Fatalf("Unexpected table schema %+v", storms)
+	}
+	if len(response.MaterializedViews) != 1 || response.MaterializedViews[0].SourceTable != "StormEvents" {
+		t.Fatalf("Unexpected materialized views %+v", response.MaterializedViews)
+	}
+	if len(response.ExternalTables) != 1 || response.ExternalTables[0].Name != "ArchivedStorms" {
+		t.Fatalf("Unexpected external tables %+v", response.ExternalTables)
+	}
+
+	signatures := []string{}
+	for _, function := range response.Functions {
+		signatures = append(signatures, function.Name+function.Parameters)
+	}
+	if strings.Join(signatures, ";") != "StateCounts(T:(State:string));StormsIn(state:string, limit:long = 10)" {
+		t.Fatalf("Unexpected function signatures %v", signatures)
+	}
+	if response.Omitted != 0 {
+		t.Fatalf("Expected nothing to be omitted, got %d", response.Omitted)
+	}
+}
+
+func TestGetDatabaseSchemaFilters(t *testing.T) {
+	response := getDatabaseSchemaResponse(t, databaseSchemaClient(), map[string]any{"name_pattern": "*storms*"})
+	names := []string{}
+	for _, entity := range slices.Concat(response.Tables, response.MaterializedViews, response.ExternalTables) {
+		names = append(names, entity.Name)
+	}
+	if strings.Join(names, ",") != "DailyStorms,ArchivedStorms" || len(response.Functions) != 1 || response.Functions[0].Name != "StormsIn" {
+		t.Fatalf("Unexpected entities for the pattern: %v, %+v", names, response.Functions)
+	}
+
+	// the cap keeps the tables, which come first, and counts the rest
+	response = getDatabaseSchemaResponse(t, databaseSchemaClient(), map[string]any{"max_bytes": float64(300)})
+	if len(response.Tables) == 0 || response.Omitted == 0 || !strings.Contains(response.Hint, "name_pattern") {
+		t.Fatalf("Expected the schema to be capped, got %+v", response)
+	}
+	if total := len(response.Tables) + len(response.MaterializedViews) + len(response.ExternalTables) + len(response.Functions) + response.Omitted; total != 6 {
+		t.Fatalf("Expected every entity to be returned or counted, got %d", total)
+	}
+
+	if _, err := getDatabaseSchemaHandler(databaseSchemaClient().factory)(context.Background(), fakeRequest("get_database_schema", map[string]any{"cluster": "fake", "database": "Samples", "name_pattern": "["})); err == nil {
+		t.Fatal("Expected an invalid pattern to be rejected")
+	}
+}
+
+func TestGetDatabaseSchemaHandler(t *testing.T) {
+	request := mcp.CallToolRequest{
+		Params: mcp.CallToolParams{
+			Name: "get_database_schema",
+			Arguments: map[string]any{
+				"cluster":  os.Getenv("CLUSTER_NAME"),
+				"database": os.Getenv("DB_NAME"),
+			},
+		},
+	}
+
+	result, err := getDatabaseSchemaHandler(testClients)(context.Background(), request)
+	if err != nil {
+		t.Fatalf("getDatabaseSchemaHandler failed: %v", err)
+	}
+
+	var response DatabaseSchemaResponse
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+
+	index := slices.IndexFunc(response.Tables, func(table EntitySchema) bool { return table.Name == os.Getenv("TABLE_NAME") })
+	if index < 0 {
+		t.Fatalf("Expected table %s in the schema, got %+v", os.Getenv("TABLE_NAME"), response.Tables)
+	}
+	for _, column := range strings.Split(os.Getenv("COLUMN_NAMES"), ",") {
+		if !slices.ContainsFunc(response.Tables[index].Columns, func(c string) bool { return strings.HasPrefix(c, column+":") }) {
+			t.Fatalf("Expected column %s in %v", column, response.Tables[index].Columns)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// The ways search_schema matches names.
+const (
+	matchSubstring = "substring"
+	matchRegex     = "regex"
+	matchFuzzy     = "fuzzy"
+)
+
+const (
+	defaultSearchResults = 50
+	maxSearchResults     = 500
+	// minFuzzySimilarity is the similarity a name needs to be a fuzzy match, from 0 (nothing in common) to 1 (equal).
+	minFuzzySimilarity = 0.6
+	// docStringWeight ranks matches in docstrings below matches in names.
+	docStringWeight = 0.5
+)
+
+// kindColumn and kindFunction are the kinds of search hits besides the entities.
+const (
+	kindColumn   = "column"
+	kindFunction = "function"
+)
+
+// SearchSchema returns a tool that searches the names and docstrings of tables, columns and functions.
+func SearchSchema(clients common.ClientFactory) (mcp.Tool, server.ToolHandlerFunc) {
+
+	return searchSchema(), searchSchemaHandler(clients)
+}
+
+func searchSchema() mcp.Tool {
+
+	return mcp.NewTool("search_schema",
+
+		mcp.WithString("cluster",
+			mcp.Description(clusterParameterDescription()),
+		),
+		mcp.WithString("database",
+			mcp.Description("Name of the database to search. Defaults to all databases of the cluster."),
+		),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("The name or text to search for, e.g. TenantId."),
+		),
+		mcp.WithString("match",
+			mcp.Description("How names are matched: substring (case-insensitive, the default), regex (a case-sensitive regular expression, prefix it with (?i) to ignore case) or fuzzy (names that are spelled similarly, e.g. tenantid for TenantID)."),
+			mcp.Enum(matchSubstring, matchRegex, matchFuzzy),
+		),
+		mcp.WithNumber("max_results",
+			mcp.Description(fmt.Sprintf("Maximum number of hits to return. Defaults to %d.", defaultSearchResults)),
+		),
+		mcp.WithDescription("Search the names and docstrings of the tables, materialized views, external tables, columns and functions of one or all databases of a cluster in one call, e.g. to find the tables with a TenantId column. Hits are ranked, with exact name matches first and docstring matches last."),
+	)
+}
+
+// SearchSchemaResponse is the response of search_schema.
+type SearchSchemaResponse struct {
+	Cluster   string      `json:"cluster"`
+	Databases []string    `json:"databases"`
+	Hits      []SchemaHit `json:"hits"`
+	// TotalHits is the number of hits before max_results applied.
+	TotalHits int `json:"totalHits"`
+}
+
+// SchemaHit is a table, materialized view, external table, column or function that matches the search.
+type SchemaHit struct {
+	Database string `json:"database"`
+	Kind     string `json:"kind"`
+	// Name is the name of the entity, or of the table a column belongs to.
+	Name   string `json:"name"`
+	Column string `json:"column,omitempty"`
+	// Type is the type of a column, or the parameter list of a function.
+	Type      string `json:"type,omitempty"`
+	Folder    string `json:"folder,omitempty"`
+	DocString string `json:"docString,omitempty"`
+	// MatchedDocString is set when the docstring matched rather than the name.
+	MatchedDocString bool `json:"matchedDocString,omitempty"`
+	// Score ranks the hits from 1 (exact name match) down to 0.
+	Score float64 `json:"score"`
+}
+
+// searchSchemaHandler searches the schemas of the databases, which it fetches with .show databases schema.
+func searchSchemaHandler(clients common.ClientFactory) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+
+		cluster, err := resolveCluster(request)
+		if err != nil {
+			return nil, err
+		}
+
+		query, ok := request.GetArguments()["query"].(string)
+		if !ok || strings.TrimSpace(query) == "" {
+			return nil, errors.New("search query missing")
+		}
+
+		mode, _ := request.GetArguments()["match"].(string)
+		if mode == "" {
+			mode = matchSubstring
+		}
+		matcher, err := newNameMatcher(query, mode)
+		if err != nil {
+			return nil, err
+		}
+
+		maxResults, err := intArgument(request, "max_results", defaultSearchResults)
+		if err != nil {
+			return nil, err
+		}
+		if maxResults > maxSearchResults {
+			return nil, fmt.Errorf("max_results must be at most %d", maxSearchResults)
+		}
+
+		client, err := clients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		databases := []string{}
+		if dbName, _ := request.GetArguments()["database"].(string); dbName != "" {
+			if dbName, err = cluster.ResolveDatabase(dbName); err != nil {
+				return nil, err
+			}
+			databases = append(databases, dbName)
+		} else {
+			allowed, _, err := cachedDatabases(ctx, client, cluster, false)
+			if err != nil {
+				return nil, err
+			}
+			// the cached list is shared, so it is sorted into a copy
+			databases = slices.Sorted(slices.Values(allowed))
+		}
+
+		if len(databases) == 0 {
+			return nil, fmt.Errorf("no databases to search on cluster %s", cluster.Name)
+		}
+
+		// the schemas of all databases are fetched with one command
+		command := kql.New(".show databases (")
+		for i, dbName := range databases {
+			if i > 0 {
+				command.AddLiteral(", ")
+			}
+			command.AddTable(dbName)
+		}
+		command.AddLiteral(") schema as json")
+
+		dataset, err := client.Mgmt(ctx, "", command, serverTimeout(ctx)...)
+		if err != nil {
+			return nil, err
+		}
+		rows := dataset.Tables()[0].Rows()
+		if len(rows) == 0 {
+			return nil, errors.New("no schema returned for the databases")
+		}
+		jsonSchema, err := rows[0].StringByName("DatabaseSchema")
+		if err != nil {
+			return nil, err
+		}
+
+		var schema databaseSchemaJSON
+		if err := json.Unmarshal([]byte(jsonSchema), &schema); err != nil {
+			return nil, fmt.Errorf("error parsing database schema: %w", err)
+		}
+
+		response := SearchSchemaResponse{Cluster: cluster.Name, Databases: databases, Hits: []SchemaHit{}}
+		for dbName, db := range schema.Databases {
+			for kind, entities := range map[string]map[string]entitySchemaJSON{
+				kindTable:            db.Tables,
+				kindMaterializedView: db.MaterializedViews,
+				kindExternalTable:    db.ExternalTables,
+			} {
+				for _, entity := range entities {
+					hit := SchemaHit{Database: dbName, Kind: kind, Name: entity.Name, Folder: entity.Folder, DocString: entity.DocString}
+					response.Hits = matcher.appendHit(response.Hits, hit, entity.Name, entity.DocString)
+
+					for _, column := range entity.OrderedColumns {
+						hit := SchemaHit{Database: dbName, Kind: kindColumn, Name: entity.Name, Column: column.Name, Type: column.CslType, DocString: column.DocString}
+						response.Hits = matcher.appendHit(response.Hits, hit, column.Name, column.DocString)
+					}
+				}
+			}
+
+			for _, function := range db.Functions {
+				hit := SchemaHit{Database: dbName, Kind: kindFunction, Name: function.Name, Type: parameterList(function.InputParameters), Folder: function.Folder, DocString: function.DocString}
+				response.Hits = matcher.appendHit(response.Hits, hit, function.Name, function.DocString)
+			}
+		}
+
+		sort.Slice(response.Hits, func(i, j int) bool {
+			a, b := response.Hits[i], response.Hits[j]
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+			if a.Database != b.Database {
+				return a.Database < b.Database
+			}
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+			if a.Column != b.Column {
+				return a.Column < b.Column
+			}
+			return a.Kind < b.Kind
+		})
+		response.TotalHits = len(response.Hits)
+		if len(response.Hits) > maxResults {
+			response.Hits = response.Hits[:maxResults]
+		}
+
+		jsonResult, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+}
+
+// nameMatcher scores names and docstrings against the search query.
+type nameMatcher struct {
+	mode  string
+	query string
+	regex *regexp.Regexp
+}
+
+func newNameMatcher(query, mode string) (nameMatcher, error) {
+	matcher := nameMatcher{mode: mode, query: strings.ToLower(strings.TrimSpace(query))}
+	switch mode {
+	case matchSubstring, matchFuzzy:
+	case matchRegex:
+		regex, err := regexp.Compile(query)
+		if err != nil {
+			return nameMatcher{}, fmt.Errorf("invalid regular expression %q: %w", query, err)
+		}
+		matcher.regex = regex
+	default:
+		return nameMatcher{}, fmt.Errorf("unsupported match %s, expected one of: %s, %s, %s", mode, matchSubstring, matchRegex, matchFuzzy)
+	}
+	return matcher, nil
+}
+
+// appendHit appends the hit if the name or the docstring matches, scored by the better of the two.
+func (m nameMatcher) appendHit(hits []SchemaHit, hit SchemaHit, name, docString string) []SchemaHit {
+	score := m.scoreName(name)
+	if docScore := m.scoreDocString(docString) * docStringWeight; docScore > score {
+		score = docScore
+		hit.MatchedDocString = true
+	}
+	if score == 0 {
+		return hits
+	}
+	hit.Score = math.Round(score*100) / 100
+	return append(hits, hit)
+}
+
+// scoreName returns 1 for an exact match, less for partial matches, and 0 if the name does not match.
+func (m nameMatcher) scoreName(name string) float64 {
+	if name == "" {
+		return 0
+	}
+
+	if m.mode == matchRegex {
+		location := m.regexMatch(name)
+		if location == nil {
+			return 0
+		}
+		return partialScore(location[1]-location[0], location[0] == 0, len(name))
+	}
+
+	lower := strings.ToLower(name)
+	if index := strings.Index(lower, m.query); index >= 0 {
+		return partialScore(len(m.query), index == 0, len(lower))
+	}
+	if m.mode != matchFuzzy {
+		return 0
+	}
+
+	// misspellings count against the similarity, so that they rank below substring matches
+	similarity := 1 - float64(editDistance(m.query, lower))/float64(max(len(m.query), len(lower)))
+	if similarity < minFuzzySimilarity {
+		return 0
+	}
+	return similarity * 0.6
+}
+
+// scoreDocString matches docstrings by substring, or by the regex, as fuzzy matching of text finds too much.
+func (m nameMatcher) scoreDocString(docString string) float64 {
+	if docString == "" {
+		return 0
+	}
+	if m.mode == matchRegex {
+		if m.regexMatch(docString) != nil {
+			return 1
+		}
+		return 0
+	}
+	if strings.Contains(strings.ToLower(docString), m.query) {
+		return 1
+	}
+	return 0
+}
+
+// regexMatch returns the location of the first match of the regex that is not empty, or nil. Patterns such
+// as x* or ^ match the empty string in every name, which is no match.
+func (m nameMatcher) regexMatch(s string) []int {
+	for _, location := range m.regex.FindAllStringIndex(s, -1) {
+		if location[0] < location[1] {
+			return location
+		}
+	}
+	return nil
+}
+
+// partialScore ranks a match of matched characters in a name of length characters: a full match scores 1,
+// prefixes score above other substrings, and longer matches score above shorter ones.
+func partialScore(matched int, prefix bool, length int) float64 {
+	if matched == length {
+		return 1
+	}
+	score := 0.6 + 0.2*float64(matched)/float64(length)
+	if prefix {
+		score += 0.1
+	}
+	return score
+}
+
+// editDistance is the Levenshtein distance of two strings, in bytes.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,176 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const testLogsSchema = `"Logs":{"Name":"Logs",
+"Tables":{
+	"Requests":{"Name":"Requests","OrderedColumns":[
+		{"Name":"TenantId","Type":"System.String","CslType":"string"},
+		{"Name":"Url","Type":"System.String","CslType":"string","DocString":"Request URL including the tenant"}]},
+	"Tenants":{"Name":"Tenants","OrderedColumns":[{"Name":"Id","Type":"System.String","CslType":"string"}]}},
+"Functions":{
+	"RequestsOfTenant":{"Name":"RequestsOfTenant","Body":"{ Requests | where TenantId == tenant }","InputParameters":[{"Name":"tenant","Type":"System.String","CslType":"string"}]}}
+}`
+
+func searchClient() *fakeClient {
+	bothSchemas := strings.TrimSuffix(testDatabaseSchema, "}}") + "," + testLogsSchema + "}}"
+	return &fakeClient{mgmt: map[string]fakeTable{
+		".show databases": {columns: []string{"DatabaseName"}, rows: [][]any{{"Samples"}, {"Logs"}, {"Secret"}}},
+		".show databases (Logs, Samples) schema as json": {columns: []string{"DatabaseSchema"}, rows: [][]any{{bothSchemas}}},
+		".show databases (Logs) schema as json":          {columns: []string{"DatabaseSchema"}, rows: [][]any{{`{"Databases":{` + testLogsSchema + `}}`}}},
+	}}
+}
+
+func searchSchemaResponse(t *testing.T, client *fakeClient, arguments map[string]any) SearchSchemaResponse {
+	t.Helper()
+
+	arguments["cluster"] = "fake"
+	result, err := searchSchemaHandler(client.factory)(context.Background(), fakeRequest("search_schema", arguments))
+	text := resultText(t, result, err)
+
+	var response SearchSchemaResponse
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+	return response
+}
+
+func hitNames(hits []SchemaHit) string {
+	names := []string{}
+	for _, hit := range hits {
+		name := hit.Database + "." + hit.Name
+		if hit.Column != "" {
+			name += "." + hit.Column
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestSearchSchemaAcrossDatabases(t *testing.T) {
+	resetSchemaCache(t)
+	err := common.SetConfig(common.Config{Clusters: []common.ClusterConfig{
+		{Name: "fake", Endpoint: "https://fake.kusto.windows.net", AllowedDatabases: []string{"Samples", "Logs"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer common.SetConfig(common.Config{})
+
+	response := searchSchemaResponse(t, searchClient(), map[string]any{"query": "tenant"})
+	if strings.Join(response.Databases, ",") != "Logs,Samples" {
+		t.Fatalf("Expected the allowed databases to be searched, got %v", response.Databases)
+	}
+	// the list of databases is cached, and sorting it for the search leaves the cached list as it was
+	result, err := listDatabasesHandler((&fakeClient{}).factory)(context.Background(), fakeRequest("list_databases", map[string]any{"cluster": "fake"}))
+	if text := resultText(t, result, err); !strings.Contains(text, `"databases":["Samples","Logs"]`) {
+		t.Fatalf("Expected the databases from the cache, got %s", text)
+	}
+	// the table named like the query ranks first, the prefix matches next and the docstring match last
+	expected := "Logs.Tenants,Logs.Requests.TenantId,Logs.RequestsOfTenant,Logs.Requests.Url"
+	if names := hitNames(response.Hits); names != expected {
+		t.Fatalf("Expected hits %s, got %s (%+v)", expected, names, response.Hits)
+	}
+	if hit := response.Hits[1]; hit.Kind != kindColumn || hit.Type != "string" {
+		t.Fatalf("Unexpected column hit %+v", hit)
+	}
+	if hit := response.Hits[2]; hit.Kind != kindFunction || hit.Type != "(tenant:string)" {
+		t.Fatalf("Unexpected function hit %+v", hit)
+	}
+	if !response.Hits[3].MatchedDocString || response.Hits[3].Score >= response.Hits[2].Score {
+		t.Fatalf("Expected the docstring match to rank last, got %+v", response.Hits)
+	}
+
+	response = searchSchemaResponse(t, searchClient(), map[string]any{"query": "storms", "max_results": float64(2)})
+	if response.TotalHits != 4 || len(response.Hits) != 2 {
+		t.Fatalf("Expected 2 of 4 hits, got %d of %d", len(response.Hits), response.TotalHits)
+	}
+}
+
+func TestSearchSchemaMatchModes(t *testing.T) {
+	response := searchSchemaResponse(t, searchClient(), map[string]any{"database": "Logs", "query": "^(Tenant|Url)", "match": "regex"})
+	if names := hitNames(response.Hits); names != "Logs.Requests.Url,Logs.Tenants,Logs.Requests.TenantId" {
+		t.Fatalf("Unexpected regex hits %s", names)
+	}
+
+	for _, query := range []string{"x*", "^", "(?i)z?"} {
+		if response := searchSchemaResponse(t, searchClient(), map[string]any{"database": "Logs", "query": query, "match": "regex"}); len(response.Hits) != 0 {
+			t.Fatalf("Expected no hits for %s, which only matches the empty string, got %s", query, hitNames(response.Hits))
+		}
+	}
+	// the empty match at the start does not hide a match later in the name
+	response = searchSchemaResponse(t, searchClient(), map[string]any{"database": "Logs", "query": "q*", "match": "regex"})
+	if names := hitNames(response.Hits); names != "Logs.Requests,Logs.RequestsOfTenant,Logs.Requests.Url" {
+		t.Fatalf("Unexpected hits for q* %s", names)
+	}
+
+	response = searchSchemaResponse(t, searchClient(), map[string]any{"database": "Logs", "query": "tennantid", "match": "fuzzy"})
+	if names := hitNames(response.Hits); names != "Logs.Requests.TenantId,Logs.Tenants" {
+		t.Fatalf("Unexpected fuzzy hits %s", names)
+	}
+
+	for _, arguments := range []map[string]any{
+		{"query": "(", "match": "regex"},
+		{"query": "a", "match": "exact"},
+		{"query": " "},
+		{"query": "a", "max_results": float64(100000)},
+	} {
+		arguments["cluster"] = "fake"
+		if _, err := searchSchemaHandler(searchClient().factory)(context.Background(), fakeRequest("search_schema", arguments)); err == nil {
+			t.Fatalf("Expected %v to be rejected", arguments)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "abc", 3},
+		{"tenantid", "tenantid", 0},
+		{"tennantid", "tenantid", 1},
+		{"kitten", "sitting", 3},
+	} {
+		if distance := editDistance(test.a, test.b); distance != test.distance {
+			t.Fatalf("Expected distance %d between %s and %s, got %d", test.distance, test.a, test.b, distance)
+		}
+	}
+}
+
+func TestSearchSchemaHandler(t *testing.T) {
+	request := mcp.CallToolRequest{
+		Params: mcp.CallToolParams{
+			Name: "search_schema",
+			Arguments: map[string]any{
+				"cluster": os.Getenv("CLUSTER_NAME"),
+				"query":   strings.Split(os.Getenv("COLUMN_NAMES"), ",")[0],
+			},
+		},
+	}
+
+	result, err := searchSchemaHandler(testClients)(context.Background(), request)
+	if err != nil {
+		t.Fatalf("searchSchemaHandler failed: %v", err)
+	}
+
+	var response SearchSchemaResponse
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+	if !slices.ContainsFunc(response.Hits, func(hit SchemaHit) bool {
+		return hit.Database == os.Getenv("DB_NAME") && hit.Name == os.Getenv("TABLE_NAME") && hit.Kind == kindColumn
+	}) {
+		t.Fatalf("Expected a column of %s in the hits, got %+v", os.Getenv("TABLE_NAME"), response.Hits)
+	}
+}
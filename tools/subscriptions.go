@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Subscriptions keeps the resources that each session subscribed to with resources/subscribe. When the schema
+// cache fetches a table list, table schema or function definition that changed, the sessions subscribed to it
+// are sent notifications/resources/updated.
+type Subscriptions struct {
+	mu       sync.Mutex
+	sessions map[string]map[string]resourceRef
+}
+
+// resourceRef identifies a resource regardless of the cluster name or alias in its URI.
+type resourceRef struct {
+	endpoint string
+	// path is the part of the URI after the cluster, e.g. /Samples/tables/StormEvents/schema.
+	path string
+}
+
+// subscriptions holds the subscriptions of all sessions.
+var subscriptions = &Subscriptions{sessions: map[string]map[string]resourceRef{}}
+
+// ResourceSubscriptions returns the subscriptions that the schema cache notifies. mcp-go does not handle
+// resources/subscribe, so the transports pass the requests on to them.
+func ResourceSubscriptions() *Subscriptions {
+	return subscriptions
+}
+
+// Subscribe subscribes the session to the resource. URIs that are not kusto:// URIs of a valid cluster are
+// ignored, as they never change.
+func (s *Subscriptions) Subscribe(sessionID, uri string) {
+	ref, ok := parseResourceURI(uri)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sessions[sessionID] == nil {
+		s.sessions[sessionID] = map[string]resourceRef{}
+	}
+	s.sessions[sessionID][uri] = ref
+}
+
+// Unsubscribe removes the subscription of the session to the resource.
+func (s *Subscriptions) Unsubscribe(sessionID, uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions[sessionID], uri)
+	if len(s.sessions[sessionID]) == 0 {
+		delete(s.sessions, sessionID)
+	}
+}
+
+func (s *Subscriptions) unsubscribeAll(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sessionID)
+}
+
+// watched reports whether any session subscribed to the resource.
+func (s *Subscriptions) watched(ref resourceRef) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, resources := range s.sessions {
+		for _, subscribed := range resources {
+			if subscribed == ref {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subscribers returns the URIs that sessions subscribed to the resource with, by session.
+func (s *Subscriptions) subscribers(ref resourceRef) map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uris := map[string][]string{}
+	for sessionID, resources := range s.sessions {
+		for uri, subscribed := range resources {
+			if subscribed == ref {
+				uris[sessionID] = append(uris[sessionID], uri)
+			}
+		}
+	}
+	return uris
+}
+
+// parseResourceURI resolves the cluster of a resource URI, e.g. kusto://help/Samples/tables/StormEvents/schema.
+func parseResourceURI(uri string) (resourceRef, bool) {
+	rest, ok := strings.CutPrefix(uri, "kusto://")
+	if !ok {
+		return resourceRef{}, false
+	}
+	cluster, path, ok := strings.Cut(rest, "/")
+	if !ok {
+		return resourceRef{}, false
+	}
+	endpoint, err := common.ResolveEndpoint(cluster)
+	if err != nil {
+		return resourceRef{}, false
+	}
+	path, err = url.PathUnescape(path)
+	if err != nil {
+		return resourceRef{}, false
+	}
+	return resourceRef{endpoint: endpoint, path: "/" + path}, true
+}
+
+// notifyResourceUpdated sends notifications/resources/updated to the sessions that subscribed to the resource.
+// The subscriptions of sessions that have gone away are dropped.
+func notifyResourceUpdated(ctx context.Context, ref resourceRef) {
+	s := server.ServerFromContext(ctx)
+	if s == nil {
+		return
+	}
+
+	for sessionID, uris := range subscriptions.subscribers(ref) {
+		for _, uri := range uris {
+			err := s.SendNotificationToSpecificClient(sessionID, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri})
+			if errors.Is(err, server.ErrSessionNotFound) {
+				subscriptions.unsubscribeAll(sessionID)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type fakeSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (f *fakeSession) SessionID() string                                   { return f.id }
+func (f *fakeSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return f.notifications }
+func (f *fakeSession) Initialize()                                         {}
+func (f *fakeSession) Initialized() bool                                   { return true }
+
+func resetSubscriptions(t *testing.T) {
+	subscriptions.sessions = map[string]map[string]resourceRef{}
+	t.Cleanup(func() { subscriptions.sessions = map[string]map[string]resourceRef{} })
+}
+
+func TestResourceUpdatedNotifications(t *testing.T) {
+	resetSchemaCache(t)
+	resetSubscriptions(t)
+	now := fakeClock(t)
+	client := schemaClient()
+
+	s := server.NewMCPServer("test", "0.0.1", server.WithResourceCapabilities(true, false))
+	s.AddResourceTemplate(DatabaseResource(client.factory))
+	s.AddResourceTemplate(TableSchemaResource(client.factory))
+
+	session := &fakeSession{id: "session", notifications: make(chan mcp.JSONRPCNotification, 10)}
+	if err := s.RegisterSession(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(uri string) {
+		t.Helper()
+		message, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": "resources/read", "params": map[string]any{"uri": uri}})
+		if response, ok := s.HandleMessage(context.Background(), message).(mcp.JSONRPCResponse); !ok {
+			t.Fatalf("Expected a response to reading %s, got %+v", uri, response)
+		}
+	}
+	notified := func() []string {
+		uris := []string{}
+		for {
+			select {
+			case notification := <-session.notifications:
+				if notification.Method != mcp.MethodNotificationResourceUpdated {
+					t.Fatalf("Unexpected notification %s", notification.Method)
+				}
+				uris = append(uris, notification.Params.AdditionalFields["uri"].(string))
+			default:
+				return uris
+			}
+		}
+	}
+
+	// the subscription is matched regardless of the cluster name in the URI
+	schemaURI := "kusto://fake.kusto.windows.net/Samples/tables/StormEvents/schema"
+	subscriptions.Subscribe(session.id, schemaURI)
+	read("kusto://fake/Samples/tables/StormEvents/schema")
+	read("kusto://fake/Samples")
+	if uris := notified(); len(uris) != 0 {
+		t.Fatalf("Expected no notification for the first fetch, got %v", uris)
+	}
+
+	// the expired schema is kept when another entry is cached, so that the change is seen when it is fetched again
+	client.mgmt[".show table StormEvents schema as json"] = fakeTable{columns: []string{"TableName", "Schema"}, rows: [][]any{{"StormEvents", `{"Name":"StormEvents","OrderedColumns":[]}`}}}
+	client.mgmt[".show tables"] = fakeTable{columns: []string{"TableName", "DatabaseName"}, rows: [][]any{{"StormEvents", "Samples"}, {"Covid19", "Samples"}}}
+	*now = now.Add(10 * time.Minute)
+	read("kusto://fake/Logs")
+	read("kusto://fake/Samples/tables/StormEvents/schema")
+	read("kusto://fake/Samples")
+	if uris := notified(); len(uris) != 1 || uris[0] != schemaURI {
+		t.Fatalf("Expected a notification for the changed schema only, got %v", uris)
+	}
+
+	*now = now.Add(10 * time.Minute)
+	read("kusto://fake/Samples/tables/StormEvents/schema")
+	if uris := notified(); len(uris) != 0 {
+		t.Fatalf("Expected no notification for an unchanged schema, got %v", uris)
+	}
+
+	// sessions that went away lose their subscriptions
+	s.UnregisterSession(context.Background(), session.id)
+	client.mgmt[".show table StormEvents schema as json"] = fakeTable{columns: []string{"TableName", "Schema"}, rows: [][]any{{"StormEvents", cachedSchemaJSON}}}
+	*now = now.Add(10 * time.Minute)
+	read("kusto://fake/Samples/tables/StormEvents/schema")
+	if subscriptions.watched(resourceRef{endpoint: "https://fake.kusto.windows.net", path: "/Samples/tables/StormEvents/schema"}) {
+		t.Fatal("Expected the subscriptions of the session to be dropped")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/Azure/azure-kusto-go/azkustodata/kql"
 	"github.com/abhirockzz/mcp_kusto/common"
@@ -12,9 +14,9 @@ import (
 	"github.com/mark3labs/mcp-go/server"
 )
 
-func ListTables() (mcp.Tool, server.ToolHandlerFunc) {
+func ListTables(clients common.ClientFactory) (mcp.Tool, server.ToolHandlerFunc) {
 
-	return listTables(), listTablesHandler
+	return listTables(), listTablesHandler(clients)
 }
 
 // listTables returns a tool that lists all tables in a specific Azure Data Explorer database.
@@ -23,12 +25,13 @@ func listTables() mcp.Tool {
 	return mcp.NewTool("list_tables",
 
 		mcp.WithString("cluster",
-			mcp.Required(),
-			mcp.Description(CLUSTER_PARAMETER_DESCRIPTION),
+			mcp.Description(clusterParameterDescription()),
 		),
 		mcp.WithString("database",
-			mcp.Required(),
-			mcp.Description("Name of the database to list tables from."),
+			mcp.Description(databaseParameterDescription("Name of the database to list tables from.")),
+		),
+		mcp.WithBoolean("refresh",
+			mcp.Description(refreshParameterDescription),
 		),
 		mcp.WithDescription("List all tables in a specific Azure Data Explorer database"),
 	)
@@ -41,28 +44,54 @@ type ListTablesResponse struct {
 	Cluster  string   `json:"cluster"`
 	Database string   `json:"database"`
 	Tables   []string `json:"tables"`
+	// CacheAge is how old the list is when it comes from the schema cache, e.g. 4m30s.
+	CacheAge string `json:"cacheAge,omitempty"`
 }
 
 // listTablesHandler handles the request to list all tables in a specific Azure Data Explorer database.
-func listTablesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func listTablesHandler(clients common.ClientFactory) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 
-	clusterName, ok := request.Params.Arguments["cluster"].(string)
-	if !ok {
-		return nil, errors.New("cluster name missing")
-	}
+		cluster, err := resolveCluster(request)
+		if err != nil {
+			return nil, err
+		}
 
-	dbName, ok := request.Params.Arguments["database"].(string)
-	if !ok {
-		return nil, errors.New("database name missing")
-	}
+		dbName, err := resolveDatabase(request, cluster)
+		if err != nil {
+			return nil, err
+		}
 
-	client, err := common.GetClient(fmt.Sprintf(clusterNameFormat, clusterName))
-	if err != nil {
-		return nil, err
+		client, err := clients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		tableNames, cacheAge, err := cachedTables(ctx, client, cluster, dbName, refreshArgument(request))
+		if err != nil {
+			return nil, err
+		}
+
+		response := ListTablesResponse{
+			Cluster:  cluster.Name,
+			Database: dbName,
+			Tables:   tableNames,
+			CacheAge: cacheAge,
+		}
+
+		jsonResult, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(string(jsonResult)), nil
 	}
-	defer client.Close()
+}
 
-	dataset, err := client.Mgmt(ctx, dbName, kql.New(".show tables"))
+// showTables lists the tables of the database.
+func showTables(ctx context.Context, client common.KustoClient, dbName string) ([]string, error) {
+	dataset, err := client.Mgmt(ctx, dbName, kql.New(".show tables"), serverTimeout(ctx)...)
 	if err != nil {
 		return nil, err
 	}
@@ -78,25 +107,13 @@ func listTablesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.C
 		}
 		tableNames = append(tableNames, tableName)
 	}
-
-	response := ListTablesResponse{
-		Cluster:  clusterName,
-		Database: dbName,
-		Tables:   tableNames,
-	}
-
-	jsonResult, err := json.Marshal(response)
-	if err != nil {
-		return nil, err
-	}
-
-	return mcp.NewToolResultText(string(jsonResult)), nil
+	return tableNames, nil
 }
 
 // GetTableSchema returns a tool that retrieves the schema of a specific table in an Azure Data Explorer database.
-func GetTableSchema() (mcp.Tool, server.ToolHandlerFunc) {
+func GetTableSchema(clients common.ClientFactory) (mcp.Tool, server.ToolHandlerFunc) {
 
-	return getSchema(), getSchemaHandler
+	return getSchema(), getSchemaHandler(clients)
 }
 
 // getSchema returns a tool that retrieves the schema of a specific table in an Azure Data Explorer database.
@@ -105,19 +122,24 @@ func getSchema() mcp.Tool {
 	return mcp.NewTool("get_table_schema",
 
 		mcp.WithString("cluster",
-			mcp.Required(),
-			mcp.Description(CLUSTER_PARAMETER_DESCRIPTION),
+			mcp.Description(clusterParameterDescription()),
 		),
 		mcp.WithString("database",
-			mcp.Required(),
-			mcp.Description("Name of the database."),
+			mcp.Description(databaseParameterDescription("Name of the database.")),
 		),
 
 		mcp.WithString("table",
 			mcp.Required(),
 			mcp.Description("Name of the table to get the schema for."),
 		),
-		mcp.WithDescription("Get the schema of a specific table in an Azure Data Explorer database"),
+		mcp.WithString("kind",
+			mcp.Description("Kind of the entity, as returned by list_entities. Defaults to table."),
+			mcp.Enum(entityKinds...),
+		),
+		mcp.WithBoolean("refresh",
+			mcp.Description(refreshParameterDescription),
+		),
+		mcp.WithDescription("Get the schema of a specific table, materialized view or external table in an Azure Data Explorer database"),
 	)
 }
 
@@ -133,58 +155,94 @@ type TableSchemaResponse struct {
 	} `json:"OrderedColumns"`
 }
 
-func getSchemaHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func getSchemaHandler(clients common.ClientFactory) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 
-	clusterName, ok := request.Params.Arguments["cluster"].(string)
-	if !ok {
-		return nil, errors.New("cluster name missing")
-	}
+		cluster, err := resolveCluster(request)
+		if err != nil {
+			return nil, err
+		}
 
-	dbName, ok := request.Params.Arguments["database"].(string)
-	if !ok {
-		return nil, errors.New("database name missing")
-	}
+		dbName, err := resolveDatabase(request, cluster)
+		if err != nil {
+			return nil, err
+		}
 
-	table, ok := request.Params.Arguments["table"].(string)
-	if !ok {
-		return nil, errors.New("table name missing")
-	}
+		table, ok := request.GetArguments()["table"].(string)
+		if !ok {
+			return nil, errors.New("table name missing")
+		}
 
-	client, err := common.GetClient(fmt.Sprintf(clusterNameFormat, clusterName))
-	if err != nil {
-		return nil, err
-	}
-	defer client.Close()
+		kind, err := entityKind(request)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := clients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
 
-	command := kql.New(".show table ").AddTable(table).AddLiteral(" schema as json")
+		jsonSchema, cacheAge, err := cachedSchema(ctx, client, cluster, dbName, table, kind, refreshArgument(request))
+		if err != nil {
+			return nil, err
+		}
 
-	//fmt.Println("Command:", command.String())
+		// var schemaResponse TableSchemaResponse
+		// err = json.Unmarshal([]byte(jsonSchema), &schemaResponse)
+		// if err != nil {
+		// 	return nil, err
+		// }
 
-	dataset, err := client.Mgmt(ctx, dbName, command)
-	if err != nil {
-		return nil, err
-	}
+		// responseJSON, err := json.Marshal(schemaResponse)
+		// if err != nil {
+		// 	return nil, err
+		// }
 
-	// Process the schema information
-	//fmt.Println("Schema for table", table)
-	jsonSchema, err := dataset.Tables()[0].Rows()[0].StringByName("Schema")
+		//return mcp.NewToolResultText(string(responseJSON)), nil
 
-	if err != nil {
-		return nil, err
+		result := mcp.NewToolResultText(jsonSchema)
+		// the schema stays the only JSON content, and the age of a cached schema follows it
+		if cacheAge != "" {
+			result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("The schema is from the schema cache and is %s old. Set refresh to true to fetch it again.", cacheAge)))
+		}
+		return result, nil
 	}
+}
 
-	// var schemaResponse TableSchemaResponse
-	// err = json.Unmarshal([]byte(jsonSchema), &schemaResponse)
-	// if err != nil {
-	// 	return nil, err
-	// }
+// entityKind returns the kind argument of a tool call, which defaults to table.
+func entityKind(request mcp.CallToolRequest) (string, error) {
+	kind, _ := request.GetArguments()["kind"].(string)
+	if kind == "" {
+		return kindTable, nil
+	}
+	if !slices.Contains(entityKinds, kind) {
+		return "", fmt.Errorf("unsupported kind %s, expected one of: %s", kind, strings.Join(entityKinds, ", "))
+	}
+	return kind, nil
+}
 
-	// responseJSON, err := json.Marshal(schemaResponse)
-	// if err != nil {
-	// 	return nil, err
-	// }
+// showSchema returns the schema of a table, materialized view or external table as JSON.
+func showSchema(ctx context.Context, client common.KustoClient, dbName, table, kind string) (string, error) {
+	// materialized views and external tables have their own commands, which return the schema in the same format
+	command := kql.New(".show table ")
+	switch kind {
+	case kindMaterializedView:
+		command = kql.New(".show materialized-view ")
+	case kindExternalTable:
+		command = kql.New(".show external table ")
+	}
+	command.AddTable(table).AddLiteral(" schema as json")
 
-	//return mcp.NewToolResultText(string(responseJSON)), nil
+	dataset, err := client.Mgmt(ctx, dbName, command, serverTimeout(ctx)...)
+	if err != nil {
+		return "", err
+	}
 
-	return mcp.NewToolResultText(jsonSchema), nil
+	rows := dataset.Tables()[0].Rows()
+	if len(rows) == 0 {
+		return "", fmt.Errorf("no schema returned for %s", table)
+	}
+	return rows[0].StringByName("Schema")
 }
@@ -32,13 +32,7 @@ func TestListTablesHandler(t *testing.T) {
 	}
 
 	request := mcp.CallToolRequest{
-		Params: struct {
-			Name      string         `json:"name"`
-			Arguments map[string]any `json:"arguments,omitempty"`
-			Meta      *struct {
-				ProgressToken mcp.ProgressToken `json:"progressToken,omitempty"`
-			} `json:"_meta,omitempty"`
-		}{
+		Params: mcp.CallToolParams{
 			Name: "list_tables",
 			Arguments: map[string]any{
 				"cluster":  clusterName,
@@ -47,7 +41,7 @@ func TestListTablesHandler(t *testing.T) {
 		},
 	}
 
-	result, err := listTablesHandler(ctx, request)
+	result, err := listTablesHandler(testClients)(ctx, request)
 	if err != nil {
 		t.Fatalf("listTablesHandler failed: %v", err)
 	}
@@ -114,13 +108,7 @@ func TestGetSchemaHandler(t *testing.T) {
 	// }
 
 	request := mcp.CallToolRequest{
-		Params: struct {
-			Name      string         `json:"name"`
-			Arguments map[string]any `json:"arguments,omitempty"`
-			Meta      *struct {
-				ProgressToken mcp.ProgressToken `json:"progressToken,omitempty"`
-			} `json:"_meta,omitempty"`
-		}{
+		Params: mcp.CallToolParams{
 			Name: "get_table_schema",
 			Arguments: map[string]any{
 				"cluster":  clusterName,
@@ -131,7 +119,7 @@ func TestGetSchemaHandler(t *testing.T) {
 	}
 
 	// Call the handler
-	result, err := getSchemaHandler(ctx, request)
+	result, err := getSchemaHandler(testClients)(ctx, request)
 	if err != nil {
 		t.Fatalf("Handler returned an error: %v", err)
 	}
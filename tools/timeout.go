@@ -0,0 +1,39 @@
+package tools
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// WithTimeout applies the deadline configured for the tool to its handler.
+// It takes and returns a tool and its handler so that it can wrap the tool constructors, e.g.
+// s.AddTool(tools.WithTimeout(tools.ExecuteQuery())).
+func WithTimeout(tool mcp.Tool, handler server.ToolHandlerFunc) (mcp.Tool, server.ToolHandlerFunc) {
+
+	return tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(ctx, common.GetConfig().TimeoutFor(tool.Name))
+		defer cancel()
+
+		return handler(ctx, request)
+	}
+}
+
+// serverTimeout derives the Kusto servertimeout request property from the deadline of the tool call,
+// so that the engine stops working on a request nobody is waiting for anymore.
+func serverTimeout(ctx context.Context) []azkustodata.QueryOption {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+
+	remaining := time.Until(deadline)
+	if remaining < time.Second {
+		remaining = time.Second
+	}
+	return []azkustodata.QueryOption{azkustodata.ServerTimeout(remaining)}
+}
@@ -0,0 +1,264 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// schemaSuffix is appended to every tabular statement, so that the query returns the schema of its results
+// instead of data.
+const schemaSuffix = " | getschema"
+
+// nonTabularStatements are the statements that do not return a result.
+var nonTabularStatements = []string{"let", "set", "declare", "alias", "pattern", "restrict"}
+
+// ValidateQuery returns a tool that checks a query against a database without running it.
+func ValidateQuery(clients common.ClientFactory) (mcp.Tool, server.ToolHandlerFunc) {
+
+	return validateQuery(), validateQueryHandler(clients)
+}
+
+func validateQuery() mcp.Tool {
+
+	return mcp.NewTool("validate_query",
+
+		mcp.WithString("cluster",
+			mcp.Description(clusterParameterDescription()),
+		),
+		mcp.WithString("database",
+			mcp.Description(databaseParameterDescription("Name of the database.")),
+		),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("The query to validate, as it would be passed to execute_query."),
+		),
+		mcp.WithObject("parameters",
+			mcp.Description("Values for the query parameters, as they would be passed to execute_query."),
+		),
+		mcp.WithDescription("Check a read-only KQL query against a database without returning any data, e.g. before asking the user for permission to run it with execute_query. The query is compiled against the schema of the database: a valid query returns the columns and types of each result table, and an invalid one returns the syntax or semantic error (e.g. an unknown column or a type mismatch) with its line and column, so that the query can be fixed first."),
+		mcp.WithToolAnnotation(mcp.ToolAnnotation{
+			Title:           "Validate query",
+			ReadOnlyHint:    mcp.ToBoolPtr(true),
+			DestructiveHint: mcp.ToBoolPtr(false),
+			IdempotentHint:  mcp.ToBoolPtr(true),
+			OpenWorldHint:   mcp.ToBoolPtr(true),
+		}),
+	)
+}
+
+// ValidateQueryResponse is the response of validate_query.
+type ValidateQueryResponse struct {
+	Valid bool `json:"valid"`
+	// Results has the columns of each result table of a valid query, in order.
+	Results []ResultSchema `json:"results,omitempty"`
+	// Error is the reason an invalid query was rejected, with the line and column in the query.
+	Error *ToolError `json:"error,omitempty"`
+}
+
+// ResultSchema is the schema of a result table.
+type ResultSchema struct {
+	Columns []ResultColumn `json:"columns"`
+}
+
+// validateQueryHandler runs the query with getschema appended to its tabular statements, which makes Kusto
+// compile the query and return the schema of its results without reading any data. Syntax and semantic
+// errors make the query invalid, other errors (e.g. throttling) fail the tool call.
+func validateQueryHandler(clients common.ClientFactory) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+
+		cluster, err := resolveCluster(request)
+		if err != nil {
+			return nil, err
+		}
+
+		dbName, err := resolveDatabase(request, cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		query, ok := request.GetArguments()["query"].(string)
+		if !ok || strings.TrimSpace(query) == "" {
+			return nil, errors.New("query missing")
+		}
+
+		arguments, err := objectArgument(request, "parameters")
+		if err != nil {
+			return nil, err
+		}
+
+		schemaStatement, insertions, err := schemaQuery(query)
+		if err != nil {
+			return invalidQuery(ToolError{Category: categorySyntax, Message: err.Error(), Hint: remediationHints[categorySyntax]})
+		}
+
+		// execute_query would reject the query before sending it
+		if err := checkReadOnly(query); err != nil {
+			return invalidQuery(ToolError{Category: categoryInvalidRequest, Message: err.Error(), Hint: "Only read-only queries can be executed. Control commands cannot be validated."})
+		}
+
+		statement, parameters, err := queryParameters(schemaStatement, arguments)
+		if err != nil {
+			return nil, err
+		}
+		// default values of parameters, and the declaration the SDK sends with the parameters, come before the query
+		prefixLines := strings.Count(statement, "\n") - strings.Count(schemaStatement, "\n")
+		if parameters.Count() > 0 {
+			prefixLines++
+		}
+
+		client, err := clients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		options := append(serverTimeout(ctx), azkustodata.RequestReadonly())
+		if parameters.Count() > 0 {
+			options = append(options, azkustodata.QueryParameters(parameters))
+		}
+
+		dataset, err := client.Query(ctx, dbName, kql.New("").AddUnsafe(statement), options...)
+		if err != nil {
+			err = queryError(ctx, err)
+			toolError := classifyError(err)
+			if toolError.Category != categorySyntax && toolError.Category != categorySemantic {
+				return nil, err
+			}
+			toolError.Line, toolError.Column = originalPosition(query, insertions, prefixLines, toolError.Line, toolError.Column)
+			return invalidQuery(toolError)
+		}
+
+		response := ValidateQueryResponse{Valid: true, Results: []ResultSchema{}}
+		for _, table := range primaryResults(dataset) {
+			columns, err := schemaColumns(table)
+			if err != nil {
+				return nil, err
+			}
+			response.Results = append(response.Results, ResultSchema{Columns: columns})
+		}
+
+		jsonResult, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+}
+
+// invalidQuery returns the response for a query that failed validation. It is not an error result, as the
+// tool call itself succeeded.
+func invalidQuery(toolError ToolError) (*mcp.CallToolResult, error) {
+	jsonResult, err := json.Marshal(ValidateQueryResponse{Valid: false, Error: &toolError})
+	if err != nil {
+		return nil, err
+	}
+
+	return mcp.NewToolResultText(string(jsonResult)), nil
+}
+
+// schemaQuery appends getschema to every tabular statement of the query, after its last token so that
+// comments stay where they are. It returns the offsets in the query at which the suffix was inserted.
+func schemaQuery(query string) (string, []int, error) {
+	tokens, err := tokenizeKQL(query)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not parse query: %w", err)
+	}
+
+	insertions := []int{}
+	for _, statement := range splitKQLStatements(tokens) {
+		if first := statement[0]; first.kind == kqlIdentifier && slices.Contains(nonTabularStatements, first.text) {
+			continue
+		}
+		last := statement[len(statement)-1]
+		insertions = append(insertions, last.offset+len(last.text))
+	}
+	if len(insertions) == 0 {
+		return "", nil, errors.New("the query has no tabular statement, so it returns no result")
+	}
+
+	var builder strings.Builder
+	start := 0
+	for _, offset := range insertions {
+		builder.WriteString(query[start:offset])
+		builder.WriteString(schemaSuffix)
+		start = offset
+	}
+	builder.WriteString(query[start:])
+	return builder.String(), insertions, nil
+}
+
+// originalPosition maps a line and column reported for the query that was sent back to the query that was
+// validated, given the offsets at which getschema was inserted and the number of lines sent before the query.
+// A position that is not in the query becomes 0, 0.
+func originalPosition(query string, insertions []int, prefixLines, line, column int) (int, int) {
+	line -= prefixLines
+	if line < 1 || column < 1 {
+		return 0, 0
+	}
+
+	lineStart := 0
+	for i := 1; i < line; i++ {
+		next := strings.IndexByte(query[lineStart:], '\n')
+		if next < 0 {
+			return 0, 0
+		}
+		lineStart += next + 1
+	}
+	lineEnd := len(query)
+	if next := strings.IndexByte(query[lineStart:], '\n'); next >= 0 {
+		lineEnd = lineStart + next
+	}
+
+	// the suffixes inserted earlier on the line move the columns after them
+	shift := 0
+	for _, offset := range insertions {
+		if offset < lineStart || offset > lineEnd {
+			continue
+		}
+		inserted := offset - lineStart + 1 + shift
+		if column < inserted {
+			break
+		}
+		if column < inserted+len(schemaSuffix) {
+			// an error in getschema itself is an error in the statement it was appended to
+			return line, offset - lineStart + 1
+		}
+		shift += len(schemaSuffix)
+	}
+	return line, column - shift
+}
+
+// schemaColumns reads the columns of a result table from the result of getschema.
+func schemaColumns(table ResultTable) ([]ResultColumn, error) {
+	name, typ := -1, -1
+	for i, column := range table.Columns {
+		switch column.Name {
+		case "ColumnName":
+			name = i
+		case "ColumnType":
+			typ = i
+		}
+	}
+	if name < 0 || typ < 0 {
+		return nil, errors.New("unexpected result of getschema, expected ColumnName and ColumnType columns")
+	}
+
+	columns := []ResultColumn{}
+	for _, row := range table.Rows {
+		columnName, _ := row[name].(string)
+		columnType, _ := row[typ].(string)
+		columns = append(columns, ResultColumn{Name: columnName, Type: columnType})
+	}
+	return columns, nil
+}
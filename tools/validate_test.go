@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/types"
+)
+
+func TestSchemaQuery(t *testing.T) {
+	query := "let n = 5; // rows\nStormEvents | take n // first\n;\nStormEvents | count"
+	statement, insertions, err := schemaQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statement != "let n = 5; // rows\nStormEvents | take n | getschema // first\n;\nStormEvents | count | getschema" || len(insertions) != 2 {
+		t.Fatalf("Unexpected schema query %q, %v", statement, insertions)
+	}
+
+	for _, query := range []string{"let n = 5;", "print 'unterminated"} {
+		if _, _, err := schemaQuery(query); err == nil {
+			t.Fatalf("Expected %q to be rejected", query)
+		}
+	}
+}
+
+func TestOriginalPosition(t *testing.T) {
+	// sent as "T | take 1 | getschema; T | wher x | getschema"
+	query := "T | take 1; T | wher x"
+	insertions := []int{10, 22}
+
+	tests := []struct {
+		prefixLines, line, column int
+		expectedLine, expectedCol int
+	}{
+		{0, 1, 5, 1, 5},
+		{0, 1, 29, 1, 17},
+		{0, 1, 14, 1, 11},
+		{1, 2, 29, 1, 17},
+		{1, 1, 3, 0, 0},
+		{0, 0, 0, 0, 0},
+	}
+	for _, test := range tests {
+		line, column := originalPosition(query, insertions, test.prefixLines, test.line, test.column)
+		if line != test.expectedLine || column != test.expectedCol {
+			t.Fatalf("Expected %d,%d for %+v, got %d,%d", test.expectedLine, test.expectedCol, test, line, column)
+		}
+	}
+
+	// columns only move on the line of the insertion
+	if line, column := originalPosition("T\n| take 1;\nT | wher x", []int{10, 22}, 0, 3, 5); line != 3 || column != 5 {
+		t.Fatalf("Expected 3,5, got %d,%d", line, column)
+	}
+}
+
+func schemaResult(columns ...string) fakeTable {
+	table := fakeTable{columns: []string{"ColumnName", "ColumnOrdinal", "DataType", "ColumnType"}, types: []types.Column{types.String, types.Long, types.String, types.String}}
+	for i := 0; i+1 < len(columns); i += 2 {
+		table.rows = append(table.rows, []any{columns[i], i / 2, "System.String", columns[i+1]})
+	}
+	return table
+}
+
+func validate(t *testing.T, client *fakeClient, arguments map[string]any) ValidateQueryResponse {
+	t.Helper()
+	result, err := validateQueryHandler(client.factory)(context.Background(), fakeRequest("validate_query", arguments))
+	var response ValidateQueryResponse
+	if err := json.Unmarshal([]byte(resultText(t, result, err)), &response); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+	return response
+}
+
+func TestValidateQueryHandler(t *testing.T) {
+	client := &fakeClient{results: []fakeTable{schemaResult("State", "string", "Count", "long"), schemaResult("Count", "long")}}
+
+	response := validate(t, client, map[string]any{"cluster": "fake", "database": "Samples", "query": "StormEvents | summarize Count=count() by State; StormEvents | count"})
+	if !response.Valid || len(response.Results) != 2 || response.Results[0].Columns[1] != (ResultColumn{Name: "Count", Type: "long"}) {
+		t.Fatalf("Unexpected response %+v", response)
+	}
+	if client.queries[0] != "StormEvents | summarize Count=count() by State | getschema; StormEvents | count | getschema" {
+		t.Fatalf("Unexpected query %s", client.queries[0])
+	}
+
+	// control commands are invalid without reaching the cluster
+	response = validate(t, client, map[string]any{"cluster": "fake", "database": "Samples", "query": ".drop table StormEvents"})
+	if response.Valid || response.Error.Category != categoryInvalidRequest || len(client.queries) != 1 {
+		t.Fatalf("Expected the control command to be invalid, got %+v", response)
+	}
+}
+
+func TestValidateQueryErrors(t *testing.T) {
+	client := &fakeClient{queryErr: httpError(http.StatusBadRequest, `{"error": {"code": "General_BadRequest", "message": "Request is invalid and cannot be executed.", "@type": "Kusto.Data.Exceptions.SyntaxException", "@message": "Syntax error: Query could not be parsed at 'wher' on line [2,15]", "@permanent": true}}`)}
+
+	// the declaration of the parameters is sent on the first line
+	response := validate(t, client, map[string]any{"cluster": "fake", "database": "Samples", "query": "StormEvents | wher State == state", "parameters": map[string]any{"state": "TEXAS"}})
+	if response.Valid || response.Error.Category != categorySyntax || response.Error.Line != 1 || response.Error.Column != 15 {
+		t.Fatalf("Expected a syntax error at 1,15, got %+v", response.Error)
+	}
+
+	// errors that are not about the query fail the tool call
+	client.queryErr = httpError(http.StatusTooManyRequests, `{"error": {"code": "TooManyRequests"}}`)
+	if _, err := validateQueryHandler(client.factory)(context.Background(), fakeRequest("validate_query", map[string]any{"cluster": "fake", "database": "Samples", "query": "StormEvents"})); err == nil {
+		t.Fatal("Expected throttling to fail the tool call")
+	}
+}
@@ -0,0 +1,268 @@
+package transport
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Authenticator validates the bearer token of a request to an HTTP transport and returns the caller it identifies.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (common.Caller, error)
+}
+
+// NewAuthenticator returns the Authenticator for the settings, or nil if clients do not authenticate.
+func NewAuthenticator(config common.InboundAuthConfig) (Authenticator, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch config.Mode {
+	case common.InboundAuthJWT:
+		return NewJWTAuthenticator(config.Issuers(), config.Audience, config.KeySetURL()), nil
+	case common.InboundAuthAPIKey:
+		return NewAPIKeyAuthenticator(config.APIKeys), nil
+	}
+	return nil, nil
+}
+
+// authenticate rejects requests without a valid bearer token and adds the caller to the context of the others.
+// The health endpoint stays open for probes.
+func authenticate(next http.Handler, auth Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == HealthPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := bearerToken(r)
+		if !ok {
+			unauthorized(w, "missing bearer token")
+			return
+		}
+
+		caller, err := auth.Authenticate(r.Context(), token)
+		if err != nil {
+			// the reason is logged rather than returned, so that it does not help guessing keys
+			log.Printf("Rejected request from %s: %v", r.RemoteAddr, err)
+			unauthorized(w, "invalid bearer token")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(common.WithCaller(r.Context(), caller)))
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func unauthorized(w http.ResponseWriter, description string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, description))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token", "error_description": description})
+}
+
+// apiKeyAuthenticator accepts a fixed set of static keys.
+type apiKeyAuthenticator struct {
+	keys []common.APIKey
+}
+
+// NewAPIKeyAuthenticator returns an Authenticator that accepts the keys. The caller is named after the key.
+func NewAPIKeyAuthenticator(keys []common.APIKey) Authenticator {
+	return &apiKeyAuthenticator{keys: keys}
+}
+
+func (a *apiKeyAuthenticator) Authenticate(ctx context.Context, token string) (common.Caller, error) {
+	// every key is compared in constant time, so the time taken does not reveal which key almost matched
+	var caller common.Caller
+	found := false
+	for _, key := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(key.Key), []byte(token)) == 1 && !found {
+			caller = common.Caller{ID: "api-key:" + key.Name, Name: key.Name}
+			found = true
+		}
+	}
+	if !found {
+		return common.Caller{}, errors.New("unknown API key")
+	}
+	return caller, nil
+}
+
+// jwtAuthenticator validates RS256 signed JWTs, such as Microsoft Entra ID access tokens.
+type jwtAuthenticator struct {
+	issuers  []string
+	audience string
+	keys     *keySet
+}
+
+// NewJWTAuthenticator returns an Authenticator for JWTs with one of the issuers and the audience,
+// signed with a key of the JWKS at keySetURL.
+func NewJWTAuthenticator(issuers []string, audience, keySetURL string) Authenticator {
+	return &jwtAuthenticator{
+		issuers:  issuers,
+		audience: audience,
+		keys:     &keySet{url: keySetURL, client: &http.Client{Timeout: 10 * time.Second}},
+	}
+}
+
+// jwtLeeway allows for clock skew between the server and the token issuer.
+const jwtLeeway = time.Minute
+
+func (a *jwtAuthenticator) Authenticate(ctx context.Context, token string) (common.Caller, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims,
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			return a.keys.get(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithAudience(a.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	)
+	if err != nil {
+		return common.Caller{}, err
+	}
+
+	issuer, _ := claims.GetIssuer()
+	if !slices.Contains(a.issuers, issuer) {
+		return common.Caller{}, fmt.Errorf("token has unexpected issuer %q", issuer)
+	}
+
+	// Entra ID identifies principals by object ID, other issuers by subject
+	caller := common.Caller{ID: stringClaim(claims, "oid", "sub"), Name: stringClaim(claims, "preferred_username", "upn", "name", "appid", "azp"), Token: token}
+	if caller.ID == "" {
+		return common.Caller{}, errors.New("token identifies no principal")
+	}
+	if caller.Name == "" {
+		caller.Name = caller.ID
+	}
+	return caller, nil
+}
+
+// stringClaim returns the first of the claims that is set.
+func stringClaim(claims jwt.MapClaims, names ...string) string {
+	for _, name := range names {
+		if value, ok := claims[name].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+const (
+	// keySetMaxAge is how long signing keys are used before the key set is fetched again
+	keySetMaxAge = 24 * time.Hour
+	// keySetMinInterval limits how often tokens with unknown keys can make the key set be fetched
+	keySetMinInterval = 5 * time.Minute
+)
+
+// keySet caches the RSA keys of a JWKS. Issuers rotate their keys, so an unknown key ID fetches the set again.
+type keySet struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+func (k *keySet) get(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[kid]
+	age := time.Since(k.fetched)
+	if (ok && age < keySetMaxAge) || (!ok && age < keySetMinInterval) {
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return key, nil
+	}
+
+	keys, err := k.fetch(ctx)
+	if err != nil {
+		if ok {
+			// keep using a known key while the issuer is unavailable
+			log.Printf("Error refreshing signing keys, using cached keys: %v", err)
+			return key, nil
+		}
+		return nil, fmt.Errorf("error fetching signing keys: %w", err)
+	}
+	k.keys = keys
+	k.fetched = time.Now()
+
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+func (k *keySet) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", k.url, resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("error parsing key set: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range set.Keys {
+		if key.KeyType != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %s: %w", key.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent of key %s: %w", key.KeyID, err)
+		}
+		keys[key.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
@@ -0,0 +1,179 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://issuer.example/"
+	testAudience = "api://kusto-mcp"
+)
+
+// newKeySetServer serves a JWKS with the public key and counts how often it was fetched.
+func newKeySetServer(t *testing.T, kid string, key *rsa.PrivateKey) (*httptest.Server, *atomic.Int32) {
+	fetches := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(server.Close)
+	return server, fetches
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func signToken(t *testing.T, kid string, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":                testIssuer,
+		"aud":                testAudience,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"oid":                "00000000-0000-0000-0000-000000000001",
+		"sub":                "subject",
+		"preferred_username": "alice@example.com",
+	}
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	key := newRSAKey(t)
+	keySetServer, fetches := newKeySetServer(t, "key-1", key)
+	auth := NewJWTAuthenticator([]string{testIssuer}, testAudience, keySetServer.URL)
+	ctx := context.Background()
+
+	token := signToken(t, "key-1", key, validClaims())
+	caller, err := auth.Authenticate(ctx, token)
+	if err != nil {
+		t.Fatalf("Expected a valid token, got %v", err)
+	}
+	if caller.ID != "00000000-0000-0000-0000-000000000001" || caller.Name != "alice@example.com" || caller.Token != token {
+		t.Fatalf("Unexpected caller %+v", caller)
+	}
+
+	invalid := map[string]func(claims jwt.MapClaims){
+		"audience": func(claims jwt.MapClaims) { claims["aud"] = "api://other" },
+		"issuer":   func(claims jwt.MapClaims) { claims["iss"] = "https://other.example/" },
+		"expired":  func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"expiry":   func(claims jwt.MapClaims) { delete(claims, "exp") },
+	}
+	for name, modify := range invalid {
+		claims := validClaims()
+		modify(claims)
+		if _, err := auth.Authenticate(ctx, signToken(t, "key-1", key, claims)); err == nil {
+			t.Fatalf("Expected a token with an invalid %s to be rejected", name)
+		}
+	}
+
+	if _, err := auth.Authenticate(ctx, signToken(t, "key-1", newRSAKey(t), validClaims())); err == nil {
+		t.Fatal("Expected a token signed with another key to be rejected")
+	}
+
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, err := auth.Authenticate(ctx, unsigned); err == nil {
+		t.Fatal("Expected an unsigned token to be rejected")
+	}
+
+	// unknown keys fetch the key set again, but not more than once per interval
+	before := fetches.Load()
+	for range 3 {
+		if _, err := auth.Authenticate(ctx, signToken(t, "key-2", key, validClaims())); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+			t.Fatalf("Expected an unknown key to be rejected, got %v", err)
+		}
+	}
+	if fetched := fetches.Load() - before; fetched != 0 {
+		t.Fatalf("Expected the recently fetched key set to be reused, got %d fetches", fetched)
+	}
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	auth := NewAPIKeyAuthenticator([]common.APIKey{{Name: "ci", Key: "key-1"}, {Name: "ops", Key: "key-2"}})
+
+	caller, err := auth.Authenticate(context.Background(), "key-2")
+	if err != nil || caller.Name != "ops" || caller.Token != "" {
+		t.Fatalf("Unexpected caller %+v, %v", caller, err)
+	}
+	if _, err := auth.Authenticate(context.Background(), "key-3"); err == nil {
+		t.Fatal("Expected an unknown key to be rejected")
+	}
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	if auth, err := NewAuthenticator(common.InboundAuthConfig{}); auth != nil || err != nil {
+		t.Fatalf("Expected no authenticator by default, got %v, %v", auth, err)
+	}
+	if _, err := NewAuthenticator(common.InboundAuthConfig{Mode: common.InboundAuthJWT}); err == nil {
+		t.Fatal("Expected jwt mode without an audience to be rejected")
+	}
+	auth, err := NewAuthenticator(common.InboundAuthConfig{Mode: common.InboundAuthAPIKey, APIKeys: []common.APIKey{{Name: "ci", Key: "key"}}})
+	if _, ok := auth.(*apiKeyAuthenticator); !ok || err != nil {
+		t.Fatalf("Expected an API key authenticator, got %v, %v", auth, err)
+	}
+}
+
+func TestServeAuthenticated(t *testing.T) {
+	auth := NewAPIKeyAuthenticator([]common.APIKey{{Name: "ci", Key: "secret-key"}})
+	url, stop := startHTTP(t, ServeStreamableHTTP, HTTPConfig{Auth: auth})
+	defer stop()
+
+	resp, err := http.Get(url + HealthPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the health endpoint to be open, got %d", resp.StatusCode)
+	}
+
+	for _, token := range []string{"", "wrong-key"} {
+		resp, _ := postMCP(t, url, token, "", initializeMessage)
+		if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Bearer") {
+			t.Fatalf("Expected token %q to be rejected, got %d", token, resp.StatusCode)
+		}
+	}
+
+	resp, body := postMCP(t, url, "secret-key", "", initializeMessage)
+	sessionID := resp.Header.Get("Mcp-Session-Id")
+	if resp.StatusCode != http.StatusOK || sessionID == "" {
+		t.Fatalf("Unexpected initialize response %d %s", resp.StatusCode, body)
+	}
+
+	// the caller reaches the tool handlers through the context
+	_, body = postMCP(t, url, "secret-key", sessionID, echoMessage)
+	if !strings.Contains(body, "echoed for ci") {
+		t.Fatalf("Expected the tool to see the caller, got %s", body)
+	}
+}
@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const methodNotificationCancelled = "notifications/cancelled"
+
+// Canceller tracks in-flight tool calls so that a notifications/cancelled message
+// from the client cancels the context of the call it refers to.
+type Canceller struct {
+	mu    sync.Mutex
+	calls map[string]context.CancelFunc
+}
+
+func NewCanceller() *Canceller {
+	return &Canceller{calls: map[string]context.CancelFunc{}}
+}
+
+// track returns a context for a request that is cancelled when the client cancels the request.
+// The returned function must be called once the request completes.
+func (c *Canceller) track(ctx context.Context, sessionID string, id json.RawMessage) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	key := callKey(sessionID, id)
+
+	c.mu.Lock()
+	c.calls[key] = cancel
+	c.mu.Unlock()
+
+	return ctx, func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel cancels an in-flight request. Unknown or completed requests are ignored.
+func (c *Canceller) cancel(sessionID string, id json.RawMessage) bool {
+	c.mu.Lock()
+	cancel, ok := c.calls[callKey(sessionID, id)]
+	c.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// request ids are compared by their JSON representation, so that 1 and "1" stay distinct
+func callKey(sessionID string, id json.RawMessage) string {
+	return sessionID + "|" + string(id)
+}
+
+type message struct {
+	Method string          `json:"method"`
+	ID     json.RawMessage `json:"id,omitempty"`
+	Params struct {
+		RequestID json.RawMessage `json:"requestId,omitempty"`
+	} `json:"params"`
+}
+
+// isToolCall reports whether the raw message is a tools/call request, which may run for a long time.
+func isToolCall(raw json.RawMessage) bool {
+	var m message
+	return json.Unmarshal(raw, &m) == nil && m.Method == string(mcp.MethodToolsCall) && len(m.ID) > 0
+}
+
+// HandleMessage passes a message to the server. Tool calls get a context that is cancelled
+// when the client sends notifications/cancelled for them.
+func (c *Canceller) HandleMessage(ctx context.Context, s *server.MCPServer, sessionID string, raw json.RawMessage) mcp.JSONRPCMessage {
+	var m message
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return s.HandleMessage(ctx, raw)
+	}
+
+	switch {
+	case m.Method == methodNotificationCancelled && len(m.Params.RequestID) > 0:
+		c.cancel(sessionID, m.Params.RequestID)
+	case m.Method == string(mcp.MethodToolsCall) && len(m.ID) > 0:
+		var done func()
+		ctx, done = c.track(ctx, sessionID, m.ID)
+		defer done()
+	}
+
+	return s.HandleMessage(ctx, raw)
+}
+
+// requestIDKey is the context key of the id of the tools/call request that an HTTP request carries.
+type requestIDKey struct{}
+
+// HandleHTTP passes the messages posted to the HTTP transports to next, after cancelling the calls that
+// notifications/cancelled refers to. The ids of tool calls are added to the request context, so that
+// ToolMiddleware can track the calls: the SSE transport handles messages with a context that is detached
+// from the HTTP request, and mcp-go ignores notifications/cancelled.
+func (c *Canceller) HandleHTTP(next http.Handler, sessionID func(r *http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "could not read the request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var m message
+		if json.Unmarshal(body, &m) == nil {
+			switch {
+			case m.Method == methodNotificationCancelled && len(m.Params.RequestID) > 0:
+				c.cancel(sessionID(r), m.Params.RequestID)
+			case m.Method == string(mcp.MethodToolsCall) && len(m.ID) > 0:
+				r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, m.ID))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ToolMiddleware gives the tool calls that HandleHTTP saw a context that is cancelled when the client
+// sends notifications/cancelled for them.
+func (c *Canceller) ToolMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, ok := ctx.Value(requestIDKey{}).(json.RawMessage)
+		session := server.ClientSessionFromContext(ctx)
+		if !ok || session == nil {
+			return next(ctx, request)
+		}
+
+		ctx, done := c.track(ctx, session.SessionID(), id)
+		defer done()
+		return next(ctx, request)
+	}
+}
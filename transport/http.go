@@ -0,0 +1,166 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Paths served by the HTTP transports.
+const (
+	SSEPath        = "/sse"
+	MessagePath    = "/message"
+	StreamablePath = "/mcp"
+	HealthPath     = "/healthz"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+// sessionIDHeader carries the session of the streamable HTTP transport.
+const sessionIDHeader = "Mcp-Session-Id"
+
+// HTTPConfig configures the SSE and streamable HTTP transports.
+type HTTPConfig struct {
+	// Addr is the listen address, e.g. :8080 or localhost:8080.
+	Addr string
+	// CertFile and KeyFile enable TLS. Both or neither have to be set.
+	CertFile string
+	KeyFile  string
+	// ShutdownTimeout bounds the graceful shutdown, after which the remaining connections are closed.
+	// It defaults to 30 seconds.
+	ShutdownTimeout time.Duration
+	// Auth authenticates the clients. If it is nil, the transport accepts every request.
+	Auth Authenticator
+	// Subscriber receives the resources/subscribe and resources/unsubscribe requests of the clients.
+	// If it is nil, the requests are passed to the server, which does not support them.
+	Subscriber Subscriber
+
+	// onListen is called with the address the server listens on, for tests that listen on a random port
+	onListen func(addr net.Addr)
+}
+
+// Validate checks the TLS settings.
+func (c HTTPConfig) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("TLS requires both a certificate file and a key file")
+	}
+	return nil
+}
+
+// TLS reports whether the transport serves HTTPS.
+func (c HTTPConfig) TLS() bool {
+	return c.CertFile != ""
+}
+
+// ServeSSE serves the MCP server over the HTTP+SSE transport until ctx is cancelled. Clients connect to
+// /sse and post their messages to the endpoint announced on the stream. Tool calls are cancelled by
+// notifications/cancelled for them.
+func ServeSSE(ctx context.Context, s *server.MCPServer, config HTTPConfig) error {
+	httpServer := &http.Server{}
+	sseServer := server.NewSSEServer(s,
+		server.WithHTTPServer(httpServer),
+		server.WithSSEEndpoint(SSEPath),
+		server.WithMessageEndpoint(MessagePath),
+		// the message endpoint is announced as a relative URL, so that it also works behind a proxy
+		server.WithUseFullURLForMessageEndpoint(false),
+		server.WithKeepAlive(true),
+	)
+
+	canceller := NewCanceller()
+	server.WithToolHandlerMiddleware(canceller.ToolMiddleware)(s)
+
+	sessionID := func(r *http.Request) string {
+		return r.URL.Query().Get("sessionId")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(SSEPath, sseServer)
+	mux.Handle(MessagePath, canceller.HandleHTTP(subscribeHTTP(sseServer, config.Subscriber, sessionID), sessionID))
+
+	// closing the sessions ends the event streams, which would otherwise keep the shutdown waiting
+	return serveHTTP(ctx, httpServer, mux, config, sseServer.Shutdown)
+}
+
+// ServeStreamableHTTP serves the MCP server over the streamable HTTP transport at /mcp until ctx is cancelled.
+// Tool calls are cancelled by notifications/cancelled for them, or when the client closes the connection.
+func ServeStreamableHTTP(ctx context.Context, s *server.MCPServer, config HTTPConfig) error {
+	httpServer := &http.Server{}
+	streamableServer := server.NewStreamableHTTPServer(s,
+		server.WithStreamableHTTPServer(httpServer),
+		server.WithEndpointPath(StreamablePath),
+	)
+
+	canceller := NewCanceller()
+	server.WithToolHandlerMiddleware(canceller.ToolMiddleware)(s)
+
+	sessionID := func(r *http.Request) string {
+		return r.Header.Get(sessionIDHeader)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(StreamablePath, canceller.HandleHTTP(subscribeHTTP(streamableServer, config.Subscriber, sessionID), sessionID))
+
+	return serveHTTP(ctx, httpServer, mux, config, streamableServer.Shutdown)
+}
+
+// serveHTTP serves the handler along with the health endpoint. Once ctx is cancelled, it stops accepting
+// connections and waits for running requests to complete, up to the shutdown timeout.
+func serveHTTP(ctx context.Context, httpServer *http.Server, handler *http.ServeMux, config HTTPConfig, shutdown func(context.Context) error) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	handler.HandleFunc(HealthPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+	httpServer.Handler = handler
+	if config.Auth != nil {
+		httpServer.Handler = authenticate(handler, config.Auth)
+	}
+	httpServer.ReadHeaderTimeout = 10 * time.Second
+
+	listener, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		return err
+	}
+	if config.onListen != nil {
+		config.onListen(listener.Addr())
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if config.TLS() {
+			serveErr <- httpServer.ServeTLS(listener, config.CertFile, config.KeyFile)
+		} else {
+			serveErr <- httpServer.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := shutdown(shutdownCtx); err != nil {
+		httpServer.Close()
+		return fmt.Errorf("graceful shutdown did not complete: %w", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
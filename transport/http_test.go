@@ -0,0 +1,275 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abhirockzz/mcp_kusto/common"
+	"github.com/abhirockzz/mcp_kusto/kustotest"
+	"github.com/abhirockzz/mcp_kusto/tools"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func newTestMCPServer() *server.MCPServer {
+	s := server.NewMCPServer("test", "0.0.1")
+	s.AddTool(mcp.NewTool("echo"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if caller, ok := common.CallerFromContext(ctx); ok {
+			return mcp.NewToolResultText("echoed for " + caller.Name), nil
+		}
+		return mcp.NewToolResultText("echoed"), nil
+	})
+	return s
+}
+
+// startHTTP runs a transport on a random port and returns its base URL and a function that
+// shuts it down and returns the error of the transport.
+func startHTTP(t *testing.T, serve func(ctx context.Context, s *server.MCPServer, config HTTPConfig) error, config HTTPConfig) (string, func() error) {
+	t.Helper()
+	return startServer(t, newTestMCPServer(), serve, config)
+}
+
+// startServer runs a transport for the MCP server on a random port, like startHTTP.
+func startServer(t *testing.T, s *server.MCPServer, serve func(ctx context.Context, s *server.MCPServer, config HTTPConfig) error, config HTTPConfig) (string, func() error) {
+	t.Helper()
+
+	addr := make(chan net.Addr, 1)
+	config.Addr = "127.0.0.1:0"
+	config.ShutdownTimeout = 5 * time.Second
+	config.onListen = func(a net.Addr) { addr <- a }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, s, config)
+	}()
+
+	select {
+	case a := <-addr:
+		return "http://" + a.String(), func() error {
+			cancel()
+			select {
+			case err := <-done:
+				return err
+			case <-time.After(10 * time.Second):
+				t.Fatal("Expected the transport to shut down")
+				return nil
+			}
+		}
+	case err := <-done:
+		cancel()
+		t.Fatalf("Transport failed to start: %v", err)
+		return "", nil
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	url, stop := startHTTP(t, ServeStreamableHTTP, HTTPConfig{})
+
+	resp, err := http.Get(url + HealthPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != `{"status":"ok"}` {
+		t.Fatalf("Unexpected health response %d %s", resp.StatusCode, body)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatalf("Expected a clean shutdown, got %v", err)
+	}
+}
+
+const (
+	initializeMessage = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","clientInfo":{"name":"test","version":"1"},"capabilities":{}}}`
+	echoMessage       = `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{}}}`
+)
+
+// postMCP posts a message to the streamable HTTP transport and returns the response and its body.
+func postMCP(t *testing.T, url, token, sessionID, message string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+StreamablePath, strings.NewReader(message))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestServeStreamableHTTP(t *testing.T) {
+	url, stop := startHTTP(t, ServeStreamableHTTP, HTTPConfig{})
+	defer stop()
+
+	resp, body := postMCP(t, url, "", "", initializeMessage)
+	sessionID := resp.Header.Get("Mcp-Session-Id")
+	if resp.StatusCode != http.StatusOK || sessionID == "" {
+		t.Fatalf("Unexpected initialize response %d %s", resp.StatusCode, body)
+	}
+
+	_, body = postMCP(t, url, "", sessionID, echoMessage)
+	if !strings.Contains(body, "echoed") {
+		t.Fatalf("Unexpected tool call response %s", body)
+	}
+}
+
+func TestServeStreamableHTTPSubscriptions(t *testing.T) {
+	subscriber := &recordingSubscriber{subscriptions: map[string]bool{}}
+	url, stop := startHTTP(t, ServeStreamableHTTP, HTTPConfig{Subscriber: subscriber})
+	defer stop()
+
+	resp, _ := postMCP(t, url, "", "", initializeMessage)
+	sessionID := resp.Header.Get("Mcp-Session-Id")
+
+	_, body := postMCP(t, url, "", sessionID, `{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"kusto://help/Samples"}}`)
+	if !strings.Contains(body, `"result":{}`) {
+		t.Fatalf("Unexpected response to resources/subscribe: %s", body)
+	}
+	if !subscriber.subscriptions[sessionID+"|kusto://help/Samples"] {
+		t.Fatalf("Expected the subscription of session %s, got %v", sessionID, subscriber.subscriptions)
+	}
+}
+
+func TestServeSSEShutsDownWithOpenStreams(t *testing.T) {
+	url, stop := startHTTP(t, ServeSSE, HTTPConfig{})
+
+	resp, err := http.Get(url + SSEPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	events := bufio.NewScanner(resp.Body)
+	endpoint := ""
+	for events.Scan() {
+		if data, ok := strings.CutPrefix(events.Text(), "data: "); ok {
+			endpoint = data
+			break
+		}
+	}
+	if !strings.HasPrefix(endpoint, MessagePath+"?sessionId=") {
+		t.Fatalf("Expected a relative message endpoint, got %q", endpoint)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatalf("Expected the open event stream not to block the shutdown, got %v", err)
+	}
+}
+
+// slowQueryServer returns an MCP server with execute_query, and a fake cluster whose queries take a minute.
+func slowQueryServer(t *testing.T) (*server.MCPServer, *kustotest.Server) {
+	cluster := kustotest.NewServer()
+	t.Cleanup(cluster.Close)
+	cluster.AddTable("Samples", kustotest.Table{Name: "StormEvents", Columns: []kustotest.Column{{Name: "State", Type: "string"}}, Rows: [][]any{{"TEXAS"}}})
+	cluster.InjectFault(kustotest.Slow(time.Minute))
+
+	// the fake cluster does not authenticate
+	clients := func(ctx context.Context, c common.Cluster) (common.KustoClient, error) {
+		c.Auth = common.AuthConfig{Mode: common.AuthNone}
+		return common.PooledClients(ctx, c)
+	}
+
+	s := server.NewMCPServer("test", "0.0.1")
+	s.AddTool(tools.ExecuteQuery(clients))
+	return s, cluster
+}
+
+// cancelWhenQueried posts notifications/cancelled for tool call 2 once the query reached the fake cluster.
+func cancelWhenQueried(cluster *kustotest.Server, post func(message string)) {
+	for i := 0; i < 500 && len(cluster.Requests()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	post(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":2,"reason":"user pressed stop"}}`)
+}
+
+const slowQueryMessage = `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"execute_query","arguments":{"cluster":"%s","database":"Samples","query":"StormEvents"}}}`
+
+func TestServeStreamableHTTPCancelsQuery(t *testing.T) {
+	s, cluster := slowQueryServer(t)
+	url, stop := startServer(t, s, ServeStreamableHTTP, HTTPConfig{})
+	defer stop()
+
+	resp, _ := postMCP(t, url, "", "", initializeMessage)
+	sessionID := resp.Header.Get("Mcp-Session-Id")
+
+	go cancelWhenQueried(cluster, func(message string) {
+		req, _ := http.NewRequest(http.MethodPost, url+StreamablePath, strings.NewReader(message))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Mcp-Session-Id", sessionID)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	})
+
+	start := time.Now()
+	_, body := postMCP(t, url, "", sessionID, fmt.Sprintf(slowQueryMessage, cluster.URL))
+	if time.Since(start) > 10*time.Second || !strings.Contains(body, "context canceled") {
+		t.Fatalf("Expected the query to be cancelled, got %s after %v", body, time.Since(start))
+	}
+}
+
+func TestServeSSECancelsQuery(t *testing.T) {
+	s, cluster := slowQueryServer(t)
+	url, stop := startServer(t, s, ServeSSE, HTTPConfig{})
+	defer stop()
+
+	stream, err := http.Get(url + SSEPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+
+	events := bufio.NewScanner(stream.Body)
+	nextEvent := func() string {
+		for events.Scan() {
+			if data, ok := strings.CutPrefix(events.Text(), "data: "); ok {
+				return data
+			}
+		}
+		t.Fatal("Expected another event")
+		return ""
+	}
+	endpoint := url + nextEvent()
+
+	post := func(message string) {
+		if resp, err := http.Post(endpoint, "application/json", strings.NewReader(message)); err == nil {
+			resp.Body.Close()
+		}
+	}
+	post(initializeMessage)
+	nextEvent()
+
+	start := time.Now()
+	post(fmt.Sprintf(slowQueryMessage, cluster.URL))
+	go cancelWhenQueried(cluster, post)
+
+	if response := nextEvent(); time.Since(start) > 10*time.Second || !strings.Contains(response, `"id":2`) || !strings.Contains(response, "context canceled") {
+		t.Fatalf("Expected the query to be cancelled, got %s after %v", response, time.Since(start))
+	}
+}
+
+func TestHTTPConfigValidate(t *testing.T) {
+	if err := (HTTPConfig{CertFile: "cert.pem"}).Validate(); err == nil {
+		t.Fatal("Expected a certificate without a key to be rejected")
+	}
+	if err := (HTTPConfig{CertFile: "cert.pem", KeyFile: "key.pem"}).Validate(); err != nil {
+		t.Fatalf("Expected certificate and key to be valid, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// stdioSession is the single client session of the stdio transport.
+type stdioSession struct {
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+}
+
+func (s *stdioSession) SessionID() string {
+	return "stdio"
+}
+
+func (s *stdioSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func (s *stdioSession) Initialize() {
+	s.initialized.Store(true)
+}
+
+func (s *stdioSession) Initialized() bool {
+	return s.initialized.Load()
+}
+
+var _ server.ClientSession = (*stdioSession)(nil)
+
+// ServeStdio serves the MCP server over stdin and stdout until stdin is closed or ctx is cancelled.
+//
+// Unlike server.ServeStdio, tool calls run concurrently with reading input, so that
+// notifications/cancelled can reach a tool call that is still running. resources/subscribe and
+// resources/unsubscribe requests are passed to subscriber, which may be nil.
+func ServeStdio(ctx context.Context, s *server.MCPServer, subscriber Subscriber) error {
+	return serveStdio(ctx, s, subscriber, os.Stdin, os.Stdout)
+}
+
+func serveStdio(ctx context.Context, s *server.MCPServer, subscriber Subscriber, stdin io.Reader, stdout io.Writer) error {
+	session := &stdioSession{notifications: make(chan mcp.JSONRPCNotification, 100)}
+	if err := s.RegisterSession(ctx, session); err != nil {
+		return fmt.Errorf("register session: %w", err)
+	}
+	defer s.UnregisterSession(ctx, session.SessionID())
+
+	ctx, cancel := context.WithCancel(s.WithContext(ctx, session))
+
+	canceller := NewCanceller()
+	writer := &responseWriter{out: stdout}
+
+	go func() {
+		for {
+			select {
+			case notification := <-session.notifications:
+				writer.write(notification)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// once the client goes away, running tool calls are cancelled
+	var calls sync.WaitGroup
+	defer func() {
+		cancel()
+		calls.Wait()
+	}()
+
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+
+	go func() {
+		reader := bufio.NewReader(stdin)
+		for {
+			line, err := reader.ReadString('\n')
+			if len(line) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case line := <-lines:
+			var raw json.RawMessage
+			if err := json.Unmarshal([]byte(line), &raw); err != nil {
+				writer.write(mcp.JSONRPCError{
+					JSONRPC: mcp.JSONRPC_VERSION,
+					Error: struct {
+						Code    int         `json:"code"`
+						Message string      `json:"message"`
+						Data    interface{} `json:"data,omitempty"`
+					}{Code: mcp.PARSE_ERROR, Message: "Parse error"},
+				})
+				continue
+			}
+			raw = handleSubscription(subscriber, session.SessionID(), raw)
+
+			// other messages are handled in order, e.g. initialize must complete before anything else
+			if !isToolCall(raw) {
+				writer.write(canceller.HandleMessage(ctx, s, session.SessionID(), raw))
+				continue
+			}
+
+			calls.Add(1)
+			go func() {
+				defer calls.Done()
+				writer.write(canceller.HandleMessage(ctx, s, session.SessionID(), raw))
+			}()
+		}
+	}
+}
+
+// responseWriter serializes writes of concurrent responses to stdout.
+type responseWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (w *responseWriter) write(message mcp.JSONRPCMessage) {
+	if message == nil {
+		return
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w.out, "%s\n", data); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestServeStdioCancelsToolCall(t *testing.T) {
+	s := server.NewMCPServer("test", "0.0.1")
+
+	started := make(chan struct{})
+	s.AddTool(mcp.NewTool("slow"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		close(started)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Second):
+			return mcp.NewToolResultText("finished"), nil
+		}
+	})
+
+	stdinReader, stdin := io.Pipe()
+	stdoutReader, stdout := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- serveStdio(context.Background(), s, nil, stdinReader, stdout)
+	}()
+
+	responses := bufio.NewScanner(stdoutReader)
+	send := func(message string) {
+		if _, err := io.WriteString(stdin, message+"\n"); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","clientInfo":{"name":"test","version":"1"},"capabilities":{}}}`)
+	if !responses.Scan() {
+		t.Fatal("Expected a response to initialize")
+	}
+
+	send(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"slow","arguments":{}}}`)
+	<-started
+
+	// the ping is answered while the tool call is still running
+	send(`{"jsonrpc":"2.0","id":3,"method":"ping"}`)
+	if !responses.Scan() || !strings.Contains(responses.Text(), `"id":3`) {
+		t.Fatalf("Expected the ping to be answered first, got %s", responses.Text())
+	}
+
+	start := time.Now()
+	send(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":2,"reason":"user pressed stop"}}`)
+
+	if !responses.Scan() {
+		t.Fatal("Expected a response to the cancelled tool call")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("Tool call was not cancelled")
+	}
+
+	var response struct {
+		ID    int `json:"id"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(responses.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.ID != 2 || !strings.Contains(response.Error.Message, "context canceled") {
+		t.Fatalf("Expected tool call 2 to fail with context canceled, got %s", responses.Text())
+	}
+
+	stdin.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("serveStdio failed: %v", err)
+	}
+}
+
+// recordingSubscriber records the subscriptions it is passed, as session|uri.
+type recordingSubscriber struct {
+	mu            sync.Mutex
+	subscriptions map[string]bool
+}
+
+func (r *recordingSubscriber) Subscribe(sessionID, uri string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscriptions[sessionID+"|"+uri] = true
+}
+
+func (r *recordingSubscriber) Unsubscribe(sessionID, uri string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.subscriptions, sessionID+"|"+uri)
+}
+
+func (r *recordingSubscriber) uris() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	uris := []string{}
+	for subscription := range r.subscriptions {
+		_, uri, _ := strings.Cut(subscription, "|")
+		uris = append(uris, uri)
+	}
+	return uris
+}
+
+func TestServeStdioSubscriptions(t *testing.T) {
+	s := server.NewMCPServer("test", "0.0.1", server.WithResourceCapabilities(true, false))
+	subscriber := &recordingSubscriber{subscriptions: map[string]bool{}}
+
+	stdinReader, stdin := io.Pipe()
+	stdoutReader, stdout := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- serveStdio(context.Background(), s, subscriber, stdinReader, stdout)
+	}()
+
+	responses := bufio.NewScanner(stdoutReader)
+	call := func(message string) string {
+		if _, err := io.WriteString(stdin, message+"\n"); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if !responses.Scan() {
+			t.Fatalf("Expected a response to %s", message)
+		}
+		return responses.Text()
+	}
+
+	call(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","clientInfo":{"name":"test","version":"1"},"capabilities":{}}}`)
+
+	// the requests get an empty result, which mcp-go would answer with method not found
+	if response := call(`{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"kusto://help/Samples"}}`); response != `{"jsonrpc":"2.0","id":2,"result":{}}` {
+		t.Fatalf("Unexpected response to resources/subscribe: %s", response)
+	}
+	call(`{"jsonrpc":"2.0","id":3,"method":"resources/subscribe","params":{"uri":"kusto://help/Samples/tables/StormEvents/schema"}}`)
+	if uris := subscriber.uris(); len(uris) != 2 {
+		t.Fatalf("Expected 2 subscriptions, got %v", uris)
+	}
+
+	if response := call(`{"jsonrpc":"2.0","id":"4","method":"resources/unsubscribe","params":{"uri":"kusto://help/Samples"}}`); response != `{"jsonrpc":"2.0","id":"4","result":{}}` {
+		t.Fatalf("Unexpected response to resources/unsubscribe: %s", response)
+	}
+	if uris := subscriber.uris(); len(uris) != 1 || uris[0] != "kusto://help/Samples/tables/StormEvents/schema" {
+		t.Fatalf("Expected the schema subscription to remain, got %v", uris)
+	}
+
+	stdin.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("serveStdio failed: %v", err)
+	}
+}
+
+func TestCancellerIgnoresOtherSessions(t *testing.T) {
+	c := NewCanceller()
+
+	ctx, done := c.track(context.Background(), "a", json.RawMessage(`1`))
+	defer done()
+
+	if c.cancel("b", json.RawMessage(`1`)) || c.cancel("a", json.RawMessage(`"1"`)) {
+		t.Fatal("Expected only the matching session and request id to be cancelled")
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Context must not be cancelled")
+	}
+
+	if !c.cancel("a", json.RawMessage(`1`)) || ctx.Err() == nil {
+		t.Fatal("Expected the request to be cancelled")
+	}
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	methodResourcesSubscribe   = "resources/subscribe"
+	methodResourcesUnsubscribe = "resources/unsubscribe"
+)
+
+// Subscriber keeps the resources that each session subscribed to.
+type Subscriber interface {
+	Subscribe(sessionID, uri string)
+	Unsubscribe(sessionID, uri string)
+}
+
+type subscriptionRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params struct {
+		URI string `json:"uri"`
+	} `json:"params"`
+}
+
+// handleSubscription passes resources/subscribe and resources/unsubscribe requests, which mcp-go does not
+// handle, to the subscriber. They are replaced by a ping with the same id, as the empty result of the ping
+// is the result of the request. Other messages are returned as they are.
+func handleSubscription(subscriber Subscriber, sessionID string, raw []byte) []byte {
+	var request subscriptionRequest
+	if subscriber == nil || json.Unmarshal(raw, &request) != nil || len(request.ID) == 0 || request.Params.URI == "" {
+		return raw
+	}
+
+	switch request.Method {
+	case methodResourcesSubscribe:
+		subscriber.Subscribe(sessionID, request.Params.URI)
+	case methodResourcesUnsubscribe:
+		subscriber.Unsubscribe(sessionID, request.Params.URI)
+	default:
+		return raw
+	}
+
+	ping, err := json.Marshal(map[string]any{"jsonrpc": mcp.JSONRPC_VERSION, "id": request.ID, "method": mcp.MethodPing})
+	if err != nil {
+		return raw
+	}
+	return ping
+}
+
+// subscribeHTTP passes the subscription requests posted to the HTTP transports to the subscriber, see handleSubscription.
+func subscribeHTTP(next http.Handler, subscriber Subscriber, sessionID func(r *http.Request) string) http.Handler {
+	if subscriber == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "could not read the request body", http.StatusBadRequest)
+			return
+		}
+		body = handleSubscription(subscriber, sessionID(r), body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+
+		next.ServeHTTP(w, r)
+	})
+}